@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/migrations"
+	"github.com/joho/godotenv"
+)
+
+var available = map[string]func(ctx context.Context, dryRun bool) (migrations.Report, error){
+	"money":         migrations.MigrateMoney,
+	"legacy":        migrations.MigrateLegacy,
+	"menu-versions": migrations.MigrateMenuVersions,
+	"venue-points":  migrations.MigrateVenuePoints,
+	"stripe-links":  migrations.MigrateStripeLinks,
+}
+
+func main() {
+	name := flag.String("migration", "", "migration to run")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing anything")
+	flag.Parse()
+
+	migrate, ok := available[*name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "usage: migrate -migration <name> [-dry-run]")
+		for migration := range available {
+			fmt.Fprintln(os.Stderr, "  ", migration)
+		}
+		os.Exit(2)
+	}
+
+	if os.Getenv("SERVER_ENV") == "" {
+		if err := godotenv.Load(); err != nil {
+			log.Fatalf("Error loading .env file: %v", err)
+		}
+	}
+
+	mongoURI := os.Getenv("MONGO_URI")
+	if mongoURI == "" {
+		log.Fatal("MONGO_URI not found in .env file")
+	}
+	db.ConnectMongo(mongoURI)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	report, err := migrate(ctx, *dryRun)
+	fmt.Print(report)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
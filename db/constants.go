@@ -1,7 +1,21 @@
 package db
 
+// V1 collections, only read by the V1 routes and the migration to V2
+const CollectionNameMenus = "menus"
+const CollectionNameUsers = "users"
+
+const CollectionNameUserV2 = "usersV2"
 const CollectionNameMenuV2 = "menusV2"
 const CollectionNameOrders = "orders"
 const CollectionNamePayments = "payments"
 const CollectionNameVenue = "venues"
 const CollectionNameStripeAccounts = "stripeAccounts"
+const CollectionNameStripeEvents = "stripeEvents"
+const CollectionNameRefunds = "refunds"
+const CollectionNameOrderEvents = "orderEvents"
+const CollectionNameOrderCounters = "orderCounters"
+const CollectionNameOrderEventCounters = "orderEventCounters"
+const CollectionNameTables = "tables"
+const CollectionNameParseJobs = "parseJobs"
+const CollectionNameMenuDrafts = "menuDrafts"
+const CollectionNameMenuVersions = "menuVersions"
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrderEventRetention is how long the kitchen feed can be replayed for
+const OrderEventRetention = 48 * time.Hour
+
+// A day's counter is never written to again once the business day is over
+const orderCounterRetention = 7 * 24 * time.Hour
+
+// Finished parse jobs only matter until the merchant has seen how they went
+const parseJobRetention = 30 * 24 * time.Hour
+
+var indexes = map[string][]mongo.IndexModel{
+	CollectionNameVenue: {
+		{Keys: bson.D{{Key: "location.point", Value: "2dsphere"}}},
+	},
+	CollectionNameOrders: {
+		{
+			Keys:    bson.D{{Key: "venue_id", Value: 1}, {Key: "business_day", Value: 1}, {Key: "number", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"number": bson.M{"$exists": true}}),
+		},
+	},
+	CollectionNameOrderCounters: {
+		{Keys: bson.D{{Key: "created_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(orderCounterRetention.Seconds()))},
+	},
+	CollectionNameParseJobs: {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "finished_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(parseJobRetention.Seconds()))},
+	},
+	CollectionNameMenuVersions: {
+		{Keys: bson.D{{Key: "menu_id", Value: 1}, {Key: "version", Value: -1}}, Options: options.Index().SetUnique(true)},
+	},
+	CollectionNameMenuDrafts: {
+		{Keys: bson.D{{Key: "venue_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	CollectionNameOrderEvents: {
+		{
+			Keys:    bson.D{{Key: "venue_id", Value: 1}, {Key: "sequence", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"sequence": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(OrderEventRetention.Seconds()))},
+	},
+}
+
+// EnsureIndexes creates the indexes the server relies on, creating an index that already exists is a no-op
+func EnsureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for collection, models := range indexes {
+		if _, err := DB.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			log.Println("[db]", "unable to create indexes on", collection, err)
+		}
+	}
+}
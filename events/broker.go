@@ -0,0 +1,81 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How many events a subscriber may fall behind before it's dropped, it then reconnects and replays from the log
+const subscriberBuffer = 64
+
+// Broker fans order events out to the kitchen displays subscribed to a venue
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[primitive.ObjectID]map[chan models.OrderEvent]struct{}
+}
+
+// Orders is the broker the order feed is served from
+var Orders = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[primitive.ObjectID]map[chan models.OrderEvent]struct{}{}}
+}
+
+// Subscribe returns a channel with the venue's events from now on. The channel is closed when the subscriber
+// falls too far behind or unsubscribes.
+func (b *Broker) Subscribe(venueID primitive.ObjectID) (<-chan models.OrderEvent, func()) {
+	ch := make(chan models.OrderEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[venueID] == nil {
+		b.subscribers[venueID] = map[chan models.OrderEvent]struct{}{}
+	}
+	b.subscribers[venueID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(venueID, ch)
+	}
+}
+
+func (b *Broker) Publish(event models.OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[event.VenueID] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(event.VenueID, ch)
+		}
+	}
+}
+
+// DropAll closes every subscription, for when events may have been missed. Subscribers reconnect and replay them
+// from the log.
+func (b *Broker) DropAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for venueID, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			b.remove(venueID, ch)
+		}
+	}
+}
+
+// remove expects b.mu to be held
+func (b *Broker) remove(venueID primitive.ObjectID, ch chan models.OrderEvent) {
+	if _, ok := b.subscribers[venueID][ch]; !ok {
+		return
+	}
+	delete(b.subscribers[venueID], ch)
+	close(ch)
+	if len(b.subscribers[venueID]) == 0 {
+		delete(b.subscribers, venueID)
+	}
+}
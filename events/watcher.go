@@ -0,0 +1,75 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const watcherTag = "[order-events]"
+
+// How long to wait before reopening a change stream that failed
+const retryInterval = 2 * time.Second
+
+// WatchOrderEvents publishes every event appended to the order event log to the Orders broker until ctx is done.
+// It follows a change stream, which also picks up events written by other server instances. Change streams need
+// a replica set, which orders need anyway for their transactions. A stream that fails is reopened where it left
+// off, so no event is skipped.
+func WatchOrderEvents(ctx context.Context) {
+	var resumeToken bson.Raw
+	for {
+		err := watchChangeStream(ctx, &resumeToken)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println(watcherTag, "change stream failed, reopening:", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// watchChangeStream publishes events until the stream fails, resuming after resumeToken and keeping it up to date
+func watchChangeStream(ctx context.Context, resumeToken *bson.Raw) error {
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.M{"operationType": "insert"}}}}
+	opts := options.ChangeStream()
+	if *resumeToken != nil {
+		opts.SetResumeAfter(*resumeToken)
+	}
+	stream, err := db.DB.Collection(db.CollectionNameOrderEvents).Watch(ctx, pipeline, opts)
+	if err != nil {
+		// The token may have fallen off the oplog, start over from now rather than failing forever and have the
+		// subscribers reconnect to replay what they missed
+		if *resumeToken != nil {
+			*resumeToken = nil
+			Orders.DropAll()
+		}
+		return err
+	}
+	defer stream.Close(ctx)
+
+	log.Println(watcherTag, "watching change stream")
+	for stream.Next(ctx) {
+		*resumeToken = stream.ResumeToken()
+
+		var change struct {
+			FullDocument models.OrderEvent `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			log.Println(watcherTag, err)
+			continue
+		}
+		Orders.Publish(change.FullDocument)
+	}
+
+	return stream.Err()
+}
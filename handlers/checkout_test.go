@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/stripe/stripe-go/v78"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// linkStripeAccount onboards a Stripe account with the fake and links it to the venue
+func (s *testServer) linkStripeAccount(venue models.Venue) string {
+	s.t.Helper()
+
+	var created struct {
+		Account string `json:"account"`
+	}
+	s.expect(s.do(http.MethodPost, "/payments/account", nil), http.StatusOK, &created)
+	s.expect(s.do(http.MethodPost, "/payments/linkAccount", map[string]interface{}{"venue_id": venue.ID, "stripe_account_id": created.Account}), http.StatusOK, nil)
+
+	return created.Account
+}
+
+// checkout starts paying for the order and returns the ID of the fake's checkout session
+func (s *testServer) checkout(order models.Order) string {
+	s.t.Helper()
+
+	var checkout struct {
+		URL string `json:"url"`
+	}
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+order.ID.Hex(), nil), http.StatusOK, &checkout)
+
+	return path.Base(checkout.URL)
+}
+
+func TestPayAndRefundOrder(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	s.linkStripeAccount(venue)
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1, 2)), http.StatusCreated, &order)
+
+	sessionID := s.checkout(order)
+	session, err := s.stripe.Pay(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.AmountTotal != 1850 || session.ClientReferenceID != order.ID.Hex() {
+		t.Fatalf("unexpected checkout session %+v", session)
+	}
+
+	// The signed checkout.session.completed event has gone through the webhook
+	s.expect(s.do(http.MethodGet, "/orders/"+order.ID.Hex(), nil), http.StatusOK, &order)
+	if order.Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to be paid, got %s", order.Status)
+	}
+
+	// Refund the soda, then the rest
+	refund := map[string]interface{}{"items": []map[string]interface{}{{"menu_item_id": menu.Items[1].ID, "quantity": 1}}}
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+order.ID.Hex(), refund), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, "/orders/"+order.ID.Hex(), nil), http.StatusOK, &order)
+	if order.Status != models.OrderStatusPartiallyRefunded {
+		t.Fatalf("expected the order to be partially refunded, got %s", order.Status)
+	}
+
+	// The charge.refunded event for the refund doesn't record it again, nor does refunding another soda
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+order.ID.Hex(), refund), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, "/orders/"+order.ID.Hex(), nil), http.StatusOK, &order)
+	if len(order.StatusHistory) != 3 || order.StatusHistory[2].To != models.OrderStatusPartiallyRefunded {
+		t.Fatalf("expected one partial refund in the history, got %+v", order.StatusHistory)
+	}
+	events, err := s.store.GetOrderEventsAfter(context.Background(), venue.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refunded int
+	for _, event := range events {
+		if event.Order.Status == models.OrderStatusPartiallyRefunded {
+			refunded++
+		}
+	}
+	if refunded != 1 {
+		t.Fatalf("expected one partial refund in the feed, got %d", refunded)
+	}
+
+	// The kitchen carries on with the pizza
+	for _, status := range []models.OrderStatus{models.OrderStatusAccepted, models.OrderStatusPreparing, models.OrderStatusReady} {
+		s.expect(s.do(http.MethodPut, "/orders/"+order.ID.Hex(), map[string]interface{}{"status": status}), http.StatusOK, nil)
+	}
+
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+order.ID.Hex(), map[string]interface{}{}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, "/orders/"+order.ID.Hex(), nil), http.StatusOK, &order)
+	if order.Status != models.OrderStatusRefunded {
+		t.Fatalf("expected the order to be refunded, got %s", order.Status)
+	}
+
+	var refunds []models.Refund
+	s.expect(s.do(http.MethodGet, "/payments/refunds/"+order.ID.Hex(), nil), http.StatusOK, &refunds)
+	if len(refunds) != 3 || refunds[0].Amount.Amount != 300 || refunds[1].Amount.Amount != 300 || refunds[2].Amount.Amount != 1250 || refunds[2].StripeRefundID == "" {
+		t.Fatalf("unexpected refunds %+v", refunds)
+	}
+
+	var types []string
+	for _, event := range s.stripe.Events() {
+		types = append(types, string(event.Type))
+	}
+	if len(types) != 4 || types[0] != "checkout.session.completed" || types[3] != "charge.refunded" {
+		t.Fatalf("unexpected events %v", types)
+	}
+
+	// Nothing is left to refund
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+order.ID.Hex(), map[string]interface{}{}), http.StatusConflict, nil)
+}
+
+func TestPartiallyRefundedOrderOnlyMovesForward(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	s.linkStripeAccount(venue)
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1, 1)), http.StatusCreated, &order)
+	if _, err := s.stripe.Pay(s.checkout(order)); err != nil {
+		t.Fatal(err)
+	}
+	path := "/orders/" + order.ID.Hex()
+	for _, status := range []models.OrderStatus{models.OrderStatusAccepted, models.OrderStatusPreparing, models.OrderStatusReady, models.OrderStatusServed} {
+		s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": status}), http.StatusOK, nil)
+	}
+
+	refund := map[string]interface{}{"items": []map[string]interface{}{{"menu_item_id": menu.Items[1].ID, "quantity": 1}}}
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+order.ID.Hex(), refund), http.StatusOK, nil)
+
+	// The order was served before the refund, it can't go back to the kitchen
+	for _, status := range []models.OrderStatus{models.OrderStatusAccepted, models.OrderStatusReady, models.OrderStatusServed} {
+		s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": status}), http.StatusConflict, nil)
+	}
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": models.OrderStatusCompleted}), http.StatusOK, nil)
+}
+
+func TestDeclinedPaymentCanBeRetried(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	s.linkStripeAccount(venue)
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+
+	sessionID := s.checkout(order)
+	if _, err := s.stripe.Decline(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodGet, "/orders/"+order.ID.Hex(), nil), http.StatusOK, &order)
+	if order.Status != models.OrderStatusAwaitingPayment {
+		t.Fatalf("expected the order to still await payment, got %s", order.Status)
+	}
+
+	// The guest gives up on the first session and starts over
+	if _, err := s.stripe.Expire(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.stripe.Pay(s.checkout(order)); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodGet, "/orders/"+order.ID.Hex(), nil), http.StatusOK, &order)
+	if order.Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to be paid, got %s", order.Status)
+	}
+
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+order.ID.Hex(), nil), http.StatusConflict, nil)
+}
+
+func TestCheckoutNeedsChargesEnabled(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+order.ID.Hex(), nil), http.StatusBadRequest, nil)
+
+	account := s.linkStripeAccount(venue)
+	if err := s.stripe.SetChargesEnabled(account, false); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+order.ID.Hex(), nil), http.StatusBadRequest, nil)
+
+	var session struct {
+		ClientSecret string `json:"client_secret"`
+	}
+	s.expect(s.do(http.MethodPost, "/payments/accountSession", map[string]string{"account": account}), http.StatusOK, &session)
+	if session.ClientSecret == "" {
+		t.Fatal("expected a client secret to finish onboarding with")
+	}
+}
+
+func TestFakeCheckoutPage(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	s.linkStripeAccount(venue)
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	page := "/fake-stripe/checkout/" + s.checkout(order)
+
+	// The guest pays in their browser, without a token
+	s.token = ""
+	s.expect(s.do(http.MethodGet, page, nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPost, page+"/refund", nil), http.StatusNotFound, nil)
+
+	rec := s.do(http.MethodPost, page+"/pay", nil)
+	s.expect(rec, http.StatusSeeOther, nil)
+	if rec.Header().Get("Location") != "https://menu.example.com/order-received?order_id="+order.ID.Hex()+"&order_number=1" {
+		t.Fatalf("expected to land on the order received page, got %s", rec.Header().Get("Location"))
+	}
+	s.expect(s.do(http.MethodPost, page+"/pay", nil), http.StatusBadRequest, nil)
+
+	if paid, _ := s.store.GetOrderByID(context.Background(), order.ID); paid.Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to be paid, got %s", paid.Status)
+	}
+}
+
+func TestCheckoutWithLinkFromBeforeVenueID(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	// Linked the way it was before venue_id and Venue.StripeAccountID
+	account, err := s.stripe.NewAccount(&stripe.AccountParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.store.PutStripeAccount(models.StripeAccount{ID: primitive.NewObjectID(), StripeAccountID: account.ID, LegacyVenueID: venue.ID})
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	if _, err := s.stripe.Pay(s.checkout(order)); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := s.store.GetCapturedPaymentForOrder(context.Background(), order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.StripeAccountID != account.ID {
+		t.Fatalf("expected the payment to go to %s, got %s", account.ID, payment.StripeAccountID)
+	}
+}
+
+func TestCheckoutWithoutVenue(t *testing.T) {
+	s := newTestServer(t)
+
+	order := models.Order{
+		ID:      primitive.NewObjectID(),
+		VenueID: primitive.NewObjectID(),
+		Status:  models.OrderStatusAwaitingPayment,
+		Items:   []models.OrderItem{{Name: "Pizza", Quantity: 1, Price: models.NewMoney(1250, "EUR")}},
+		Total:   models.NewMoney(1250, "EUR"),
+	}
+	if err := s.store.CreateOrder(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+order.ID.Hex(), nil), http.StatusNotFound, nil)
+}
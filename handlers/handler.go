@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/SaplingPay/server/events"
+	"github.com/SaplingPay/server/menuparser"
+	"github.com/SaplingPay/server/payments"
+	"github.com/SaplingPay/server/repositories"
+)
+
+// Handler serves the API from the given store, main wires it to MongoDB and the tests to memory.New
+type Handler struct {
+	store     repositories.Store
+	orders    *events.Broker
+	payments  *payments.Handler
+	parseJobs *menuparser.Jobs
+
+	searchIndex *searchIndex
+}
+
+// NewHandler serves the order feed from the orders broker, which has to be fed the store's order events,
+// takes payments through the given Stripe client and imports menu cards with parseJobs
+func NewHandler(store repositories.Store, orders *events.Broker, stripeClient payments.Client, parseJobs *menuparser.Jobs) *Handler {
+	return &Handler{
+		store:     store,
+		orders:    orders,
+		payments:  payments.NewHandler(store, stripeClient),
+		parseJobs: parseJobs,
+
+		searchIndex: newSearchIndex(store),
+	}
+}
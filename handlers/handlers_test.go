@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/events"
+	"github.com/SaplingPay/server/menuparser"
+	parser "github.com/SaplingPay/server/menuparser/fake"
+	"github.com/SaplingPay/server/middleware"
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/payments/fake"
+	"github.com/SaplingPay/server/repositories/memory"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testServer is the API running on an in-memory store, requests go out with a valid token
+type testServer struct {
+	t       *testing.T
+	router  *gin.Engine
+	handler *Handler
+	store   *memory.Store
+	stripe  *fake.Client
+	parser  *parser.Parser
+	token   string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_USERNAME", "tester")
+	t.Setenv("QR_SIGNING_SECRET", "test-qr-secret")
+	t.Setenv("MENU_URL_ORIGIN", "https://menu.example.com")
+	t.Setenv("LEGACY_ROUTES", "")
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	t.Setenv("STRIPE_SUCCESS_URL_ORIGIN", "https://menu.example.com")
+
+	token, err := middleware.GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	store := memory.New()
+	broker := events.NewBroker()
+	store.PublishTo(broker)
+
+	stripe := fake.New("https://api.example.com", "whsec_test")
+
+	menuParser := parser.New("testdata/menus")
+	parseJobs := menuparser.NewJobs(store, menuParser, 2, 5*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go parseJobs.Run(ctx)
+
+	router := gin.New()
+	stripe.AddRoutes(router, "/payments/webhook")
+	handler := NewHandler(store, broker, stripe, parseJobs)
+	SetUpRoutes(router, handler)
+
+	return &testServer{t: t, router: router, handler: handler, store: store, stripe: stripe, parser: menuParser, token: token}
+}
+
+// do sends the request, body is marshalled to JSON unless nil
+func (s *testServer) do(method string, path string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// expect fails the test unless the response has the given status, and decodes the body into out if not nil
+func (s *testServer) expect(rec *httptest.ResponseRecorder, status int, out interface{}) {
+	s.t.Helper()
+
+	if rec.Code != status {
+		s.t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+}
+
+// seedMenu stores a venue that takes orders with a menu of a pizza for 12.50 and a soda for 3.00
+func (s *testServer) seedMenu() (models.Venue, models.MenuV2) {
+	s.t.Helper()
+
+	venue, err := s.store.CreateVenue(context.Background(), models.Venue{Name: "Trattoria", OrderingSupported: true, MenuIDs: []primitive.ObjectID{}})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	menu := models.MenuV2{
+		ID:      primitive.NewObjectID(),
+		Name:    "Dinner",
+		VenueID: venue.ID,
+		Items: []models.MenuItemV2{
+			{ID: primitive.NewObjectID(), Name: "Pizza", Price: models.NewMoney(1250, "EUR")},
+			{ID: primitive.NewObjectID(), Name: "Soda", Price: models.NewMoney(300, "EUR")},
+		},
+	}
+	if _, err := s.store.CreateMenu(context.Background(), menu); err != nil {
+		s.t.Fatal(err)
+	}
+
+	return venue, menu
+}
+
+func TestRoutesRequireToken(t *testing.T) {
+	s := newTestServer(t)
+	s.token = ""
+
+	s.expect(s.do(http.MethodGet, "/venues/", nil), http.StatusUnauthorized, nil)
+}
+
+func TestInvalidIDs(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, path := range []string{"/venues/nope", "/orders/nope", "/payments/nope", "/venues/nope/menu/nope"} {
+		s.expect(s.do(http.MethodGet, path, nil), http.StatusBadRequest, nil)
+	}
+}
+
+func TestLegacyRoutesReadOnly(t *testing.T) {
+	s := newTestServer(t)
+	t.Setenv("LEGACY_ROUTES", legacyRoutesReadOnly)
+
+	s.expect(s.do(http.MethodPost, "/menus/", map[string]string{"name": "Lunch"}), http.StatusGone, nil)
+	s.expect(s.do(http.MethodDelete, "/users/"+primitive.NewObjectID().Hex(), nil), http.StatusGone, nil)
+}
+
+func TestLegacyRoutesRedirect(t *testing.T) {
+	s := newTestServer(t)
+	t.Setenv("LEGACY_ROUTES", legacyRoutesRedirect)
+
+	// V1 addresses users by their app user ID, not a document ID
+	user, err := s.store.CreateUser(context.Background(), models.UserV2{UserID: "google-oauth2|1042", LegacyUserID: primitive.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do(http.MethodGet, "/users/google-oauth2%7C1042", nil)
+	s.expect(rec, http.StatusPermanentRedirect, nil)
+	if location := rec.Header().Get("Location"); location != "/usersV2/google-oauth2%7C1042" {
+		t.Fatalf("expected a redirect to the V2 user, got %q", location)
+	}
+
+	var redirected models.UserV2
+	s.expect(s.do(http.MethodGet, rec.Header().Get("Location"), nil), http.StatusOK, &redirected)
+	if redirected.ID != user.ID {
+		t.Fatalf("expected the redirect to find user %s, got %+v", user.ID.Hex(), redirected)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ItemAvailabilityRequest marks an item available, sold out or hidden. Sold out items come back at Until, or at the
+// start of the next business day without one.
+type ItemAvailabilityRequest struct {
+	Availability string     `json:"availability" binding:"required"`
+	Until        *time.Time `json:"until"`
+}
+
+// ItemAvailabilityResponse has where the item was changed, every menu of the venue serving the same dish
+type ItemAvailabilityResponse struct {
+	Availability string              `json:"availability"`
+	SoldOutUntil *primitive.DateTime `json:"sold_out_until,omitempty"`
+	Items        []MenuItemRef       `json:"items"`
+}
+
+// ItemStockRequest counts an item's portions from now on, a null stock stops counting them. Staff get a low stock alert
+// on the order feed once orders bring the stock down to LowStockAt.
+type ItemStockRequest struct {
+	Stock      *int `json:"stock"`
+	LowStockAt int  `json:"low_stock_at"`
+}
+
+type MenuItemRef struct {
+	MenuID primitive.ObjectID `json:"menu_id"`
+	ItemID primitive.ObjectID `json:"item_id"`
+}
+
+// SetItemAvailability is for staff to 86 a dish, or bring it back, on every menu of the venue at once
+func (h *Handler) SetItemAvailability(c *gin.Context) {
+	log.Println("SetItemAvailability")
+
+	var request ItemAvailabilityRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsItemAvailability(request.Availability) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "availability must be available, sold_out or hidden"})
+		return
+	}
+	if request.Until != nil && request.Availability != models.ItemSoldOut {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until only applies to sold out items"})
+		return
+	}
+
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+	itemID, err := primitive.ObjectIDFromHex(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+	var item models.MenuItemV2
+	for _, menuItem := range menu.Items {
+		if menuItem.ID == itemID && menuItem.DeletedAt == nil {
+			item = menuItem
+		}
+	}
+	if item.ID.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu item not found"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	var until *primitive.DateTime
+	if request.Availability == models.ItemSoldOut {
+		restock := now
+		if request.Until != nil {
+			restock = *request.Until
+		} else {
+			venue, err := h.store.GetVenueByID(ctx, menu.VenueID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			restock, err = venue.NextBusinessDayStart(now)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if !restock.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		}
+		t := primitive.NewDateTimeFromTime(restock)
+		until = &t
+	}
+
+	menus, err := h.store.GetMenusByVenueID(ctx, menu.VenueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := ItemAvailabilityResponse{Availability: request.Availability, SoldOutUntil: until, Items: []MenuItemRef{}}
+	for _, venueMenu := range menus {
+		var itemIDs []primitive.ObjectID
+		for _, menuItem := range venueMenu.Items {
+			if menuItem.DeletedAt == nil && menuItem.SameItem(item) {
+				itemIDs = append(itemIDs, menuItem.ID)
+				response.Items = append(response.Items, MenuItemRef{MenuID: venueMenu.ID, ItemID: menuItem.ID})
+			}
+		}
+		if len(itemIDs) == 0 {
+			continue
+		}
+
+		err := h.store.SetMenuItemAvailability(ctx, venueMenu.ID, itemIDs, request.Availability, until)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetItemStock sets how many portions of the item are left on this menu, paid orders count it down and the item is
+// sold out when none are left
+func (h *Handler) SetItemStock(c *gin.Context) {
+	log.Println("SetItemStock")
+
+	var request ItemStockRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (request.Stock != nil && *request.Stock < 0) || request.LowStockAt < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stock can't be negative"})
+		return
+	}
+
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+	itemID, err := primitive.ObjectIDFromHex(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+	if item, found := menu.Item(itemID); !found || item.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu item not found"})
+		return
+	}
+
+	item, err := h.store.SetMenuItemStock(c.Request.Context(), menu.ID, itemID, request.Stock, request.LowStockAt)
+	if errors.Is(err, repositories.ErrMenuItemNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu item not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSoldOutAcrossMenus(t *testing.T) {
+	s := newTestServer(t)
+	venue, dinner := s.seedMenu()
+	menus := "/venues/" + venue.ID.Hex() + "/menu/"
+	pizza := menus + dinner.ID.Hex() + "/items/" + dinner.Items[0].ID.Hex() + "/availability"
+
+	var lunch models.MenuV2
+	s.expect(s.do(http.MethodPost, menus, map[string]interface{}{
+		"name":  "Lunch",
+		"items": []map[string]interface{}{{"name": " pizza", "price": 11}},
+	}), http.StatusOK, &lunch)
+
+	var response ItemAvailabilityResponse
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: models.ItemSoldOut}), http.StatusOK, &response)
+	if len(response.Items) != 2 || response.Items[1].MenuID != lunch.ID {
+		t.Fatalf("expected the pizza to be sold out on both menus, got %+v", response.Items)
+	}
+	restock, err := venue.NextBusinessDayStart(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.SoldOutUntil == nil || !response.SoldOutUntil.Time().Equal(restock) {
+		t.Fatalf("expected the pizza back at %s, got %v", restock, response.SoldOutUntil)
+	}
+
+	var soldOut struct {
+		SoldOut []primitive.ObjectID `json:"sold_out"`
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, dinner, 1, 1)), http.StatusConflict, &soldOut)
+	if len(soldOut.SoldOut) != 1 || soldOut.SoldOut[0] != dinner.Items[0].ID {
+		t.Fatalf("expected the pizza to be sold out, got %+v", soldOut.SoldOut)
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, lunch, 1)), http.StatusConflict, nil)
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, dinner, 0, 1)), http.StatusBadRequest, nil)
+
+	soda := orderBody(venue, dinner, 1)
+	soda["items"] = []map[string]interface{}{{"menu_item_id": dinner.Items[1].ID, "quantity": 1}}
+	s.expect(s.do(http.MethodPost, "/orders/", soda), http.StatusCreated, nil)
+
+	// Running out isn't a change to the menu
+	versions, err := s.store.GetMenuVersions(context.Background(), dinner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected no new menu versions, got %d", len(versions))
+	}
+
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: models.ItemAvailable}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, lunch, 1)), http.StatusCreated, nil)
+}
+
+func TestSoldOutItemsRestock(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	pizza := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex() + "/items/" + menu.Items[0].ID.Hex() + "/availability"
+
+	past := time.Now().Add(-time.Minute)
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: models.ItemSoldOut, Until: &past}), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: models.ItemHidden, Until: &past}), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: "gone"}), http.StatusBadRequest, nil)
+
+	soon := time.Now().Add(time.Hour)
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: models.ItemSoldOut, Until: &soon}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusConflict, nil)
+
+	// The hour goes by
+	until := primitive.NewDateTimeFromTime(past)
+	err := s.store.SetMenuItemAvailability(context.Background(), menu.ID, []primitive.ObjectID{menu.Items[0].ID}, models.ItemSoldOut, &until)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restocked models.MenuV2
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menu/"+menu.ID.Hex(), nil), http.StatusOK, &restocked)
+	if restocked.Items[0].Availability != models.ItemAvailable || restocked.Items[0].SoldOutUntil != nil {
+		t.Fatalf("expected the pizza to be back, got %+v", restocked.Items[0])
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, nil)
+}
+
+func TestHiddenItems(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	pizza := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex() + "/items/" + menu.Items[0].ID.Hex() + "/availability"
+
+	s.expect(s.do(http.MethodPut, pizza, ItemAvailabilityRequest{Availability: models.ItemHidden}), http.StatusOK, nil)
+
+	var active []models.MenuV2
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menus/active", nil), http.StatusOK, &active)
+	if len(active) != 1 || len(active[0].Items) != 1 || active[0].Items[0].Name != "Soda" {
+		t.Fatalf("expected guests to only see the soda, got %+v", active)
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusBadRequest, nil)
+
+	var staff models.MenuV2
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menu/"+menu.ID.Hex(), nil), http.StatusOK, &staff)
+	if len(staff.Items) != 2 || staff.Items[0].Availability != models.ItemHidden {
+		t.Fatalf("expected staff to still see the hidden pizza, got %+v", staff.Items)
+	}
+
+	s.expect(s.do(http.MethodPut, "/venues/"+venue.ID.Hex()+"/menu/"+menu.ID.Hex()+"/items/"+primitive.NewObjectID().Hex()+"/availability",
+		ItemAvailabilityRequest{Availability: models.ItemHidden}), http.StatusNotFound, nil)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Modes for the V1 /menus and /users routes, set with LEGACY_ROUTES once `migrate -migration legacy` has run.
+// Read-only rejects every write, redirect also sends reads of a single menu or user to its V2 copy.
+const (
+	legacyRoutesReadOnly = "readonly"
+	legacyRoutesRedirect = "redirect"
+)
+
+func (h *Handler) legacyMenuRoutes() gin.HandlerFunc {
+	return legacyRoutes("/venues/:venueId/menu", func(c *gin.Context, menuID string) (string, error) {
+		id, err := primitive.ObjectIDFromHex(menuID)
+		if err != nil {
+			return "", err
+		}
+		menu, err := h.store.GetMenuByLegacyID(c.Request.Context(), id)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("/venues/%s/menu/%s", menu.VenueID.Hex(), menu.ID.Hex()), nil
+	}, "menuId")
+}
+
+// V1 users are addressed by their app user ID, which the migration kept as the V2 user_id
+func (h *Handler) legacyUserRoutes() gin.HandlerFunc {
+	return legacyRoutes("/usersV2", func(c *gin.Context, userID string) (string, error) {
+		user, err := h.store.GetUserByUserID(c.Request.Context(), userID)
+		if err != nil {
+			return "", err
+		}
+		return "/usersV2/" + url.PathEscape(user.UserID), nil
+	}, "userId")
+}
+
+// legacyRoutes applies the LEGACY_ROUTES mode, locate finds where a V1 document lives now
+func legacyRoutes(replacement string, locate func(c *gin.Context, id string) (string, error), param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := os.Getenv("LEGACY_ROUTES")
+		if mode != legacyRoutesReadOnly && mode != legacyRoutesRedirect {
+			c.Next()
+			return
+		}
+
+		if c.Request.Method != http.MethodGet {
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "this route is read-only, use " + replacement})
+			return
+		}
+
+		// Only the plain single document route has a V2 equivalent, e.g. not /users/:userId/saves
+		if mode == legacyRoutesRedirect && strings.HasSuffix(c.FullPath(), "/:"+param) {
+			if location, err := locate(c, c.Param(param)); err == nil {
+				c.Redirect(http.StatusPermanentRedirect, location)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MenuDraftRequest edits a draft, fields left out stay as they are
+type MenuDraftRequest struct {
+	Name  *string              `json:"name"`
+	Items *[]models.MenuItemV2 `json:"items"`
+}
+
+// PublishMenuDraftRequest merges the draft into MenuID, or publishes it as a new menu without one
+type PublishMenuDraftRequest struct {
+	MenuID primitive.ObjectID `json:"menu_id"`
+}
+
+type PublishMenuDraftResponse struct {
+	Menu    models.MenuV2 `json:"menu"`
+	Added   int           `json:"added"`
+	Updated int           `json:"updated"`
+}
+
+// GetMenuDrafts lists the venue's drafts waiting to be reviewed
+func (h *Handler) GetMenuDrafts(c *gin.Context) {
+	log.Println("GetMenuDrafts")
+
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	drafts, err := h.store.GetOpenMenuDrafts(c.Request.Context(), venueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, drafts)
+}
+
+func (h *Handler) GetMenuDraft(c *gin.Context) {
+	log.Println("GetMenuDraft")
+
+	venueID, draftID, ok := menuDraftParams(c)
+	if !ok {
+		return
+	}
+
+	draft, err := h.store.GetMenuDraft(c.Request.Context(), venueID, draftID)
+	if err != nil {
+		menuDraftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// UpdateMenuDraft renames the draft or replaces its items, and reviews it again
+func (h *Handler) UpdateMenuDraft(c *gin.Context) {
+	log.Println("UpdateMenuDraft")
+
+	var request MenuDraftRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, ok := h.openMenuDraft(c)
+	if !ok {
+		return
+	}
+
+	if request.Name != nil {
+		draft.Name = *request.Name
+	}
+	if request.Items != nil {
+		draft.Items = *request.Items
+		for i := range draft.Items {
+			if draft.Items[i].ID.IsZero() {
+				draft.Items[i].ID = primitive.NewObjectID()
+			}
+			if err := draft.Items[i].Prepare(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	h.saveMenuDraft(c, draft)
+}
+
+// UpdateMenuDraftItem replaces one item of the draft
+func (h *Handler) UpdateMenuDraftItem(c *gin.Context) {
+	log.Println("UpdateMenuDraftItem")
+
+	var item models.MenuItemV2
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := item.Prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, ok := h.openMenuDraft(c)
+	if !ok {
+		return
+	}
+
+	i, ok := draftItemIndex(c, draft)
+	if !ok {
+		return
+	}
+	item.ID = draft.Items[i].ID
+	draft.Items[i] = item
+
+	h.saveMenuDraft(c, draft)
+}
+
+// DeleteMenuDraftItem leaves an item out of the draft, usually one the parser shouldn't have read as an item
+func (h *Handler) DeleteMenuDraftItem(c *gin.Context) {
+	log.Println("DeleteMenuDraftItem")
+
+	draft, ok := h.openMenuDraft(c)
+	if !ok {
+		return
+	}
+
+	i, ok := draftItemIndex(c, draft)
+	if !ok {
+		return
+	}
+	draft.Items = append(draft.Items[:i], draft.Items[i+1:]...)
+
+	h.saveMenuDraft(c, draft)
+}
+
+// PublishMenuDraft makes the draft a live menu, or merges it into one of the venue's menus. Drafts with blocking
+// warnings aren't published.
+func (h *Handler) PublishMenuDraft(c *gin.Context) {
+	log.Println("PublishMenuDraft")
+
+	var request PublishMenuDraftRequest
+	// The body is optional, without one the draft becomes a new menu
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, ok := h.openMenuDraft(c)
+	if !ok {
+		return
+	}
+
+	if !draft.Publishable() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the draft has warnings to fix before publishing", "warnings": draft.Warnings})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var response PublishMenuDraftResponse
+	if request.MenuID.IsZero() {
+		menu, err := h.store.CreateMenu(ctx, models.MenuV2{
+			ID:      primitive.NewObjectID(),
+			VenueID: draft.VenueID,
+			Name:    draft.Name,
+			Items:   draft.Items,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response = PublishMenuDraftResponse{Menu: menu, Added: len(menu.Items)}
+	} else {
+		menu, err := h.store.GetMenuByID(ctx, request.MenuID)
+		if errors.Is(err, repositories.ErrMenuNotFound) || (err == nil && (menu.VenueID != draft.VenueID || menu.DeletedAt != nil)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		items, added, updated := draft.MergeInto(menu)
+		menu, err = h.store.UpdateMenu(ctx, menu.ID, repositories.Fields{"items": items})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response = PublishMenuDraftResponse{Menu: menu, Added: added, Updated: updated}
+	}
+
+	err := h.store.CloseMenuDraft(ctx, draft.VenueID, draft.ID, models.MenuDraftPublished, response.Menu.ID)
+	if err != nil {
+		// Published twice at once, the other request's menu stays
+		if request.MenuID.IsZero() {
+			if err := h.store.SoftDeleteMenu(ctx, response.Menu.ID); err != nil {
+				log.Println("unable to delete the menu of draft", draft.ID.Hex(), err)
+			}
+		}
+		menuDraftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DiscardMenuDraft drops the draft without publishing it
+func (h *Handler) DiscardMenuDraft(c *gin.Context) {
+	log.Println("DiscardMenuDraft")
+
+	venueID, draftID, ok := menuDraftParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.store.CloseMenuDraft(c.Request.Context(), venueID, draftID, models.MenuDraftDiscarded, primitive.NilObjectID)
+	if err != nil {
+		menuDraftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Menu draft discarded successfully"})
+}
+
+// openMenuDraft loads the draft named in the URL, responding with an error unless it can still be edited
+func (h *Handler) openMenuDraft(c *gin.Context) (models.MenuDraft, bool) {
+	venueID, draftID, ok := menuDraftParams(c)
+	if !ok {
+		return models.MenuDraft{}, false
+	}
+
+	draft, err := h.store.GetMenuDraft(c.Request.Context(), venueID, draftID)
+	if err == nil && draft.Status != models.MenuDraftOpen {
+		err = repositories.ErrMenuDraftClosed
+	}
+	if err != nil {
+		menuDraftError(c, err)
+		return draft, false
+	}
+
+	return draft, true
+}
+
+func (h *Handler) saveMenuDraft(c *gin.Context, draft models.MenuDraft) {
+	draft.Review()
+
+	if err := h.store.UpdateMenuDraft(c.Request.Context(), draft); err != nil {
+		menuDraftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+func menuDraftParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return venueID, venueID, false
+	}
+	draftID, err := primitive.ObjectIDFromHex(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return venueID, draftID, false
+	}
+	return venueID, draftID, true
+}
+
+func draftItemIndex(c *gin.Context, draft models.MenuDraft) (int, bool) {
+	itemID, err := primitive.ObjectIDFromHex(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return 0, false
+	}
+	for i, item := range draft.Items {
+		if item.ID == itemID {
+			return i, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "menu item not found"})
+	return 0, false
+}
+
+func menuDraftError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrMenuDraftNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrMenuDraftClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
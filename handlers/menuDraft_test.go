@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseDraft uploads the menu card and returns the draft the parser made of it
+func (s *testServer) parseDraft(venue models.Venue, name string) models.MenuDraft {
+	s.t.Helper()
+
+	var job models.ParseJob
+	s.expect(s.upload(venue, name, "application/pdf", []byte("%PDF-1.4")), http.StatusAccepted, &job)
+
+	return *s.waitForParseJob(job, models.ParseJobSucceeded).Draft
+}
+
+func warningCodes(draft models.MenuDraft) map[string]int {
+	codes := map[string]int{}
+	for _, warning := range draft.Warnings {
+		codes[warning.Code]++
+	}
+	return codes
+}
+
+func TestPublishMenuDraftAsNewMenu(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+	draft := s.parseDraft(venue, "pizzeria.pdf")
+	path := "/venues/" + venue.ID.Hex() + "/menu/drafts/" + draft.ID.Hex()
+
+	var published PublishMenuDraftResponse
+	s.expect(s.do(http.MethodPost, path+"/publish", nil), http.StatusOK, &published)
+	if published.Menu.Name != draft.Name || len(published.Menu.Items) != 2 || published.Added != 2 {
+		t.Fatalf("expected the draft as a new menu, got %+v", published)
+	}
+
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex(), nil), http.StatusOK, &venue)
+	if len(venue.MenuIDs) != 2 || venue.MenuIDs[1] != published.Menu.ID {
+		t.Fatalf("expected the published menu on the venue, got %v", venue.MenuIDs)
+	}
+
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &draft)
+	if draft.Status != models.MenuDraftPublished || draft.MenuID != published.Menu.ID {
+		t.Fatalf("expected the draft to be published, got %+v", draft)
+	}
+	s.expect(s.do(http.MethodPost, path+"/publish", nil), http.StatusConflict, nil)
+}
+
+func TestMergeMenuDraft(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	draft := s.parseDraft(venue, "review.pdf")
+	path := "/venues/" + venue.ID.Hex() + "/menu/drafts/" + draft.ID.Hex()
+
+	codes := warningCodes(draft)
+	if codes[models.DraftWarningDuplicateName] != 2 || codes[models.DraftWarningMissingPrice] != 1 || codes[models.DraftWarningSuspiciousPrice] != 1 {
+		t.Fatalf("unexpected warnings %+v", draft.Warnings)
+	}
+
+	var rejected struct {
+		Warnings []models.DraftWarning `json:"warnings"`
+	}
+	s.expect(s.do(http.MethodPost, path+"/publish", map[string]interface{}{"menu_id": menu.ID}), http.StatusUnprocessableEntity, &rejected)
+	if len(rejected.Warnings) != len(draft.Warnings) {
+		t.Fatalf("expected the warnings with the rejection, got %+v", rejected)
+	}
+
+	// Price the water and drop the duplicate
+	water := draft.Items[3]
+	water.Price = models.NewMoney(250, "EUR")
+	s.expect(s.do(http.MethodPut, path+"/items/"+water.ID.Hex(), water), http.StatusOK, &draft)
+	s.expect(s.do(http.MethodDelete, path+"/items/"+draft.Items[2].ID.Hex(), nil), http.StatusOK, &draft)
+	if codes := warningCodes(draft); len(draft.Items) != 4 || len(codes) != 1 || codes[models.DraftWarningSuspiciousPrice] != 1 {
+		t.Fatalf("expected only the suspicious price left, got %+v", draft.Warnings)
+	}
+
+	var published PublishMenuDraftResponse
+	s.expect(s.do(http.MethodPost, path+"/publish", map[string]interface{}{"menu_id": menu.ID}), http.StatusOK, &published)
+	if published.Menu.ID != menu.ID || published.Added != 3 || published.Updated != 1 || len(published.Menu.Items) != 5 {
+		t.Fatalf("expected the draft merged into the menu, got %+v", published)
+	}
+	pizza := published.Menu.Items[0]
+	if pizza.ID != menu.Items[0].ID || pizza.Price != models.NewMoney(1350, "EUR") {
+		t.Fatalf("expected the pizza to keep its ID with the new price, got %+v", pizza)
+	}
+
+	var drafts []models.MenuDraft
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menu/drafts/", nil), http.StatusOK, &drafts)
+	if len(drafts) != 0 {
+		t.Fatalf("expected no open drafts, got %d", len(drafts))
+	}
+}
+
+func TestEditAndDiscardMenuDraft(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+	other, otherMenu := s.seedMenu()
+	draft := s.parseDraft(venue, "pizzeria.pdf")
+	path := "/venues/" + venue.ID.Hex() + "/menu/drafts/" + draft.ID.Hex()
+
+	items := append(draft.Items, models.MenuItemV2{Name: "Tiramisu", Price: models.NewMoney(600, "EUR"), Allergens: []models.Allergen{"glitter"}})
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"items": items}), http.StatusBadRequest, nil)
+
+	items[2].Allergens = []models.Allergen{"egg"}
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"name": "Lunch", "items": items}), http.StatusOK, &draft)
+	if draft.Name != "Lunch" || len(draft.Items) != 3 || draft.Items[2].ID.IsZero() {
+		t.Fatalf("expected the edited draft, got %+v", draft)
+	}
+	if codes := warningCodes(draft); codes[models.DraftWarningMissingCategory] != 1 {
+		t.Fatalf("expected the new item to miss a category, got %+v", draft.Warnings)
+	}
+
+	// Only the venue's own menus and drafts
+	s.expect(s.do(http.MethodPost, path+"/publish", map[string]interface{}{"menu_id": otherMenu.ID}), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodGet, "/venues/"+other.ID.Hex()+"/menu/drafts/"+draft.ID.Hex(), nil), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodPut, path+"/items/"+primitive.NewObjectID().Hex(), items[0]), http.StatusNotFound, nil)
+
+	s.expect(s.do(http.MethodDelete, path, nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &draft)
+	if draft.Status != models.MenuDraftDiscarded {
+		t.Fatalf("expected the draft to be discarded, got %s", draft.Status)
+	}
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"name": "Dinner"}), http.StatusConflict, nil)
+	s.expect(s.do(http.MethodDelete, path, nil), http.StatusConflict, nil)
+}
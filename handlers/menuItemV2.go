@@ -1,23 +1,18 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"log"
 	"net/http"
-	"reflect"
-	"time"
 
-	"github.com/SaplingPay/server/repositories"
-
-	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/SaplingPay/server/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CreateMenuItemV2(c *gin.Context) {
+func (h *Handler) CreateMenuItemV2(c *gin.Context) {
 	log.Println("CreateMenuItem V2")
 
 	menuID := c.Param("menuId") // Assuming the menu ID is passed as a URL parameter
@@ -36,11 +31,19 @@ func CreateMenuItemV2(c *gin.Context) {
 		return
 	}
 
+	if err := menuItem.Prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Generate a new ObjectID for the menu item
 	menuItem.ID = primitive.NewObjectID()
 
-	_, err = repositories.AddMenuItem(objMenuID, menuItem)
-
+	_, err = h.store.AddMenuItem(c.Request.Context(), objMenuID, menuItem)
+	if errors.Is(err, repositories.ErrMenuNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -51,14 +54,11 @@ func CreateMenuItemV2(c *gin.Context) {
 	c.JSON(http.StatusOK, menuItem)
 }
 
-func GetMenuItemV2(c *gin.Context) {
+func (h *Handler) GetMenuItemV2(c *gin.Context) {
 	log.Println("GetMenuItem V2")
 	menuID := c.Param("menuId")
 	menuItemID := c.Param("itemId")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	// Convert menuID and menuItemID from string to primitive.ObjectID
 	objMenuID, err := primitive.ObjectIDFromHex(menuID)
 	if err != nil {
@@ -71,14 +71,13 @@ func GetMenuItemV2(c *gin.Context) {
 		return
 	}
 
-	var menu models.MenuV2
-	err = db.DB.Collection(CollectionNameMenuV2).FindOne(ctx, bson.M{"_id": objMenuID}).Decode(&menu)
+	menu, err := h.store.GetMenuByID(c.Request.Context(), objMenuID)
+	if errors.Is(err, repositories.ErrMenuNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+		return
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -98,20 +97,21 @@ func GetMenuItemV2(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"error": "menu item not found"})
 }
 
-func UpdateMenuItemV2(c *gin.Context) {
+func (h *Handler) UpdateMenuItemV2(c *gin.Context) {
 	log.Println("UpdateMenuItem V2")
 
 	menuID := c.Param("menuId")
 	menuItemID := c.Param("itemId")
-	log.Println("UpdateMenuItem")
 	var menuItem models.MenuItemV2
 	if err := c.ShouldBindJSON(&menuItem); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if err := menuItem.Prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Convert menuID from string to primitive.ObjectID
 	objMenuID, err := primitive.ObjectIDFromHex(menuID)
@@ -120,8 +120,6 @@ func UpdateMenuItemV2(c *gin.Context) {
 		return
 	}
 
-	log.Println(objMenuID)
-
 	// Convert menuItemID from string to primitive.ObjectID for matching in array
 	objMenuItemID, err := primitive.ObjectIDFromHex(menuItemID)
 	if err != nil {
@@ -129,33 +127,18 @@ func UpdateMenuItemV2(c *gin.Context) {
 		return
 	}
 
-	log.Println(objMenuItemID)
-
-	// Prepare update document
-	update := bson.M{}
-	menuItemType := reflect.TypeOf(menuItem)
-	menuItemValue := reflect.ValueOf(menuItem)
-	for i := 0; i < menuItemType.NumField(); i++ {
-		field := menuItemType.Field(i)
-		fieldValue := menuItemValue.Field(i).Interface()
-		fieldType := field.Type.Kind()
-
-		// Check if the field is a boolean or not empty
-		if fieldType == reflect.Bool || !reflect.DeepEqual(fieldValue, reflect.Zero(field.Type).Interface()) {
-			bsonTag := field.Tag.Get("bson")
-			// Skip if bson tag is not set or is "-"
-			if bsonTag == "" || bsonTag == "-" {
-				continue
-			}
-			update["items.$."+bsonTag] = fieldValue
-		}
+	// Availability and stock change during service through their own endpoints, without a new version of the menu
+	fields := utils.UpdateFields(menuItem)
+	for _, field := range []string{"availability", "sold_out_until", "stock", "low_stock_at"} {
+		delete(fields, field)
 	}
 
-	log.Println(update)
-
 	// Update the specified menu item within the menu document
-	filter := bson.M{"_id": objMenuID, "items._id": objMenuItemID}
-	_, err = db.DB.Collection(CollectionNameMenuV2).UpdateOne(ctx, filter, bson.M{"$set": update})
+	err = h.store.UpdateMenuItem(c.Request.Context(), objMenuID, objMenuItemID, fields)
+	if errors.Is(err, repositories.ErrMenuItemNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu item not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -199,12 +182,10 @@ func UpdateMenuItemV2(c *gin.Context) {
 // 	c.JSON(http.StatusOK, gin.H{"message": "Menu item deleted successfully"})
 // }
 
-func SoftDeleteMenuItemV2(c *gin.Context) {
+func (h *Handler) SoftDeleteMenuItemV2(c *gin.Context) {
 	log.Println("SoftDeleteMenuItem V2")
 	menuID := c.Param("menuId")
 	menuItemID := c.Param("itemId")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	objMenuID, err := primitive.ObjectIDFromHex(menuID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid menu ID format"})
@@ -215,11 +196,7 @@ func SoftDeleteMenuItemV2(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid menu item ID format"})
 		return
 	}
-	update := bson.M{
-		"$set": bson.M{"items.$.deleted_at": primitive.NewDateTimeFromTime(time.Now())},
-	}
-	filter := bson.M{"_id": objMenuID, "items._id": objMenuItemID}
-	_, err = db.DB.Collection(CollectionNameMenuV2).UpdateOne(ctx, filter, update)
+	err = h.store.SoftDeleteMenuItem(c.Request.Context(), objMenuID, objMenuItemID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -227,28 +204,24 @@ func SoftDeleteMenuItemV2(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Menu item soft deleted"})
 }
 
-func GetAllMenuItemsV2(c *gin.Context) {
+func (h *Handler) GetAllMenuItemsV2(c *gin.Context) {
 	log.Println("GetAllMenuItems V2")
 
 	menuID := c.Param("menuId") // Assuming the menu ID is passed as a URL parameter
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var menu models.MenuV2
 	objID, err := primitive.ObjectIDFromHex(menuID) // Convert menuID to ObjectID
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid menu ID format"})
 		return
 	}
 
-	err = db.DB.Collection(CollectionNameMenuV2).FindOne(ctx, bson.M{"_id": objID}).Decode(&menu)
+	menu, err := h.store.GetMenuByID(c.Request.Context(), objID)
+	if errors.Is(err, repositories.ErrMenuNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+		return
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -260,9 +233,5 @@ func GetAllMenuItemsV2(c *gin.Context) {
 		}
 	}
 
-	if len(filteredItems) == 0 {
-		filteredItems = []models.MenuItemV2{} // Ensure the response is an empty array rather than null if no items exist
-	}
-
 	c.JSON(http.StatusOK, filteredItems)
 }
@@ -1,298 +1,152 @@
 package handlers
 
 import (
-	"bytes"
-	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/SaplingPay/server/menuparser"
 	"github.com/SaplingPay/server/models"
 	"github.com/SaplingPay/server/repositories"
 	"github.com/gin-gonic/gin"
-	"github.com/sashabaranov/go-openai"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"strings"
-	"time"
 )
 
 const loggerTag = "[menu-parser]"
 
-const instructions = `
-		You are a parse for restaurant menus. Your job is to return the categories, items, descriptions and prices.
-		The menu is in a PDF format, and is attached to this request.
-		The returned message should be just a JSON object, in a valid text/json format.
-		There's no need for any text, explanation, markdown, or anything else besides the JSON.
-		The return format should be JSON, and should be in the following format:
-		[
-			{
-				  "name": "Veggie Pizza",
-				  "price": 15.99,
-				  "categories": ["Vegetarian", "Pizza", "Main Course"]
-			},
-			{
-				  "name": "Pepperoni Pizza",
-				  "price": 18.99,
-				  "categories": ["Pizza", "Main Course"]
-			}
-		]
-	`
-
-func uploadFile(client *openai.Client, r io.Reader) (string, error) {
-	log.Println(loggerTag, "Uploading file")
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(r)
-
-	if err != nil {
-		return "", err
-	}
-
-	file, err := client.CreateFileBytes(context.Background(), openai.FileBytesRequest{
-		Name:    "menu.pdf",
-		Bytes:   buf.Bytes(),
-		Purpose: openai.PurposeAssistants,
-	})
+// Menu cards bigger than this are photos at a needless resolution or not menus at all. Jobs keep the file in
+// their document until they're done, so it has to stay well within MongoDB's 16MB document limit.
+const maxMenuCardBytes = 12 << 20
 
-	return file.ID, err
+// ParseJobResponse is a parse job with the draft it produced, once it has succeeded
+type ParseJobResponse struct {
+	models.ParseJob
+	Draft *models.MenuDraft `json:"draft,omitempty"`
 }
 
-func createAssistant(client *openai.Client, fileId string) (string, error) {
-	name := "menu-parser"
-	model := openai.GPT4TurboPreview
-	instructions := instructions
-	log.Println(loggerTag, "Creating assistant")
-	assistant, err := client.CreateAssistant(
-		context.Background(),
-		openai.AssistantRequest{
-			Model: model,
-			Name:  &name,
-			Tools: []openai.AssistantTool{
-				{
-					Type: openai.AssistantToolTypeRetrieval,
-				},
-			},
-			FileIDs:      []string{fileId},
-			Instructions: &instructions,
-		},
-	)
-
-	return assistant.ID, err
-}
-
-func createThread(client *openai.Client) (string, error) {
-	log.Println(loggerTag, "Creating thread")
-	thread, err := client.CreateThread(
-		context.Background(),
-		openai.ThreadRequest{
-			Messages: []openai.ThreadMessage{
-				{
-					Role:    openai.ThreadMessageRoleUser,
-					Content: "I would like to parse this menu, that is attached to this request.",
-				},
-			},
-		},
-	)
-
-	return thread.ID, err
-}
-
-func runThread(client *openai.Client, threadId string, assistantId string) (openai.RunStatus, error) {
-	log.Println(loggerTag, "Running thread")
-	run, err := client.CreateRun(context.Background(), threadId, openai.RunRequest{
-		AssistantID: assistantId,
-	})
+// ParseMenuCard queues the uploaded menu card to be parsed, GetParseJob tells how it went
+func (h *Handler) ParseMenuCard(c *gin.Context) {
+	venueIDStr := c.Param("venueId")
 
-	for run.Status == openai.RunStatusQueued || run.Status == openai.RunStatusInProgress || run.Status == openai.RunStatusCancelling {
-		time.Sleep(1 * time.Second)
-		log.Println(loggerTag, "Waiting for thread to complete. Status:", run.Status)
-		run, err = client.RetrieveRun(context.Background(), threadId, run.ID)
+	venueID, err := primitive.ObjectIDFromHex(venueIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
 	}
 
-	log.Println(loggerTag, "Thread completed with status:", run.Status)
-
-	return run.Status, err
-}
-
-func getResult(client *openai.Client, threadId string) (string, error) {
-	log.Println(loggerTag, "Retrieving result")
-	msgs, err := client.ListMessage(context.Background(), threadId, nil, nil, nil, nil)
+	file, err := c.FormFile("menu")
 	if err != nil {
-		return "", err
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing menu file"})
+		return
 	}
 
-	log.Println(loggerTag, "Message retrieved", msgs)
-	msg := msgs.Messages[0]
-
-	return msg.Content[0].Text.Value, nil
-}
-
-func cleanup(client *openai.Client, assistantId string, fileId string, threadId string) {
-	log.Println(loggerTag, "Cleaning up")
-	if threadId != "" {
-		_, _ = client.DeleteThread(context.Background(), threadId)
-	}
+	log.Println(loggerTag, file.Header)
+	log.Println(loggerTag, file.Filename)
 
-	if assistantId != "" {
-		_, _ = client.DeleteAssistant(context.Background(), assistantId)
+	contentType := file.Header.Get("Content-Type")
+	if contentType != menuparser.ContentTypePDF && contentType != menuparser.ContentTypeJPEG && contentType != menuparser.ContentTypePNG && contentType != menuparser.ContentTypeWebP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type"})
+		return
 	}
-
-	if fileId != "" {
-		_ = client.DeleteFile(context.Background(), fileId)
+	if file.Size > maxMenuCardBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "menu file too large"})
+		return
 	}
-}
-
-func parseFileUsingGPTAssistant(r io.Reader) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
-
-	fileId, err := uploadFile(client, r)
 
+	openFile, err := file.Open()
 	if err != nil {
-		cleanup(client, "", fileId, "")
-		return "", err
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	assistantId, err := createAssistant(client, fileId)
-
+	data, err := io.ReadAll(openFile)
+	openFile.Close()
 	if err != nil {
-		cleanup(client, assistantId, fileId, "")
-		return "", err
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	threadId, err := createThread(client)
-
-	if err != nil {
-		cleanup(client, assistantId, fileId, threadId)
-		return "", err
+	if _, err := h.store.GetVenueByID(c.Request.Context(), venueID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
 	}
 
-	status, err := runThread(client, threadId, assistantId)
-
+	job, err := h.parseJobs.Submit(c.Request.Context(), venueID, menuparser.File{Name: file.Filename, ContentType: contentType, Data: data})
 	if err != nil {
-		cleanup(client, assistantId, fileId, threadId)
-		return "", err
-	}
-
-	var result string
-	if status == openai.RunStatusCompleted {
-		r, _ := getResult(client, threadId)
-		result = r
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	cleanup(client, assistantId, fileId, threadId)
-	return result, nil
+	c.JSON(http.StatusAccepted, job)
 }
 
-func parseImageUsingGPT4Vision(r io.Reader) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
-
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(r)
+func (h *Handler) GetParseJob(c *gin.Context) {
+	venueID, jobID, ok := parseJobParams(c)
+	if !ok {
+		return
+	}
 
+	job, err := h.store.GetParseJob(c.Request.Context(), venueID, jobID)
+	if errors.Is(err, repositories.ErrParseJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		return "", err
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	imgBase64Str := base64.StdEncoding.EncodeToString(buf.Bytes())
-
-	result, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model: openai.GPT4VisionPreview,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role: openai.ChatMessageRoleUser,
-				MultiContent: []openai.ChatMessagePart{
-					{
-						Type: openai.ChatMessagePartTypeText,
-						Text: instructions,
-					},
-					{
-						Type: openai.ChatMessagePartTypeImageURL,
-						ImageURL: &openai.ChatMessageImageURL{
-							URL:    "data:image/jpeg;base64," + imgBase64Str,
-							Detail: openai.ImageURLDetailHigh,
-						},
-					},
-				},
-			},
-		},
-		MaxTokens: 3000,
-	})
-
-	for _, choice := range result.Choices {
-		log.Println(loggerTag, "Choice:", choice.Message.Content)
-
-		for _, part := range choice.Message.MultiContent {
-			if part.Type == openai.ChatMessagePartTypeText {
-				log.Println(loggerTag, "Partial text:", part.Text)
-			}
+	response := ParseJobResponse{ParseJob: job}
+	if job.Status == models.ParseJobSucceeded {
+		draft, err := h.store.GetMenuDraft(c.Request.Context(), venueID, job.DraftID)
+		if err == nil {
+			response.Draft = &draft
 		}
 	}
 
-	return result.Choices[0].Message.Content, err
-}
-
-func ParseMenuCard(c *gin.Context) {
-	var err error
-	file, _ := c.FormFile("menu")
-	openFile, _ := file.Open()
-
-	venueIDStr := c.Param("venueId")
-
-	venueID, err := primitive.ObjectIDFromHex(venueIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+	// The menu card was read, but what came out of it isn't a menu even after a repair. The job lists the problems.
+	if len(job.Problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
 	}
 
-	log.Println(loggerTag, file.Header)
-	log.Println(loggerTag, file.Filename)
+	c.JSON(http.StatusOK, response)
+}
 
-	contentType := file.Header.Get("Content-Type")
-	if contentType != "application/pdf" && contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/webp" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type"})
+// CancelParseJob stops a job that hasn't finished yet
+func (h *Handler) CancelParseJob(c *gin.Context) {
+	venueID, jobID, ok := parseJobParams(c)
+	if !ok {
 		return
 	}
 
-	var result string
-	if contentType == "application/pdf" {
-		r, e := parseFileUsingGPTAssistant(openFile)
-		result = r
-		err = e
-	} else {
-		r, e := parseImageUsingGPT4Vision(openFile)
-		result = r
-		err = e
+	job, err := h.parseJobs.Cancel(c.Request.Context(), venueID, jobID)
+	if errors.Is(err, repositories.ErrParseJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrParseJobFinished) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		return
 	}
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	result = strings.ReplaceAll(result, "```json", "")
-	result = strings.ReplaceAll(result, "```", "")
-	resultBytes := []byte(result)
-	openFile.Close()
-
-	var menuItems []models.MenuItemV2
-	if err := json.Unmarshal(resultBytes, &menuItems); err != nil {
-		log.Println(loggerTag, err)
-		c.JSON(http.StatusInternalServerError, err)
-	}
+	c.JSON(http.StatusOK, job)
+}
 
-	menu := models.MenuV2{
-		VenueID: venueID,
-		ID:      primitive.NewObjectID(),
-		Items:   menuItems,
-		Name:    "Parsed Menu from " + time.Now().Format("01-02-2006 15:04:05"),
+func parseJobParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return venueID, venueID, false
 	}
-
-	menu, err = repositories.CreateMenu(menu)
-
+	jobID, err := primitive.ObjectIDFromHex(c.Param("jobId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return venueID, jobID, false
 	}
-
-	c.JSON(http.StatusOK, menu)
+	return venueID, jobID, true
 }
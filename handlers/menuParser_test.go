@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// upload sends the file as the menu card of the venue
+func (s *testServer) upload(venue models.Venue, name string, contentType string, data []byte) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="menu"; filename="`+name+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/venues/"+venue.ID.Hex()+"/menu/parse/", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// waitForParseJob polls the job until it's in the given status
+func (s *testServer) waitForParseJob(job models.ParseJob, status string) ParseJobResponse {
+	s.t.Helper()
+
+	var response ParseJobResponse
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rec := s.do(http.MethodGet, "/venues/"+job.VenueID.Hex()+"/menu/parse/"+job.ID.Hex(), nil)
+		if rec.Code == http.StatusUnprocessableEntity {
+			// Failed on invalid parser output
+			s.expect(rec, http.StatusUnprocessableEntity, &response)
+		} else {
+			s.expect(rec, http.StatusOK, &response)
+		}
+		if response.Status == status {
+			return response
+		}
+	}
+	s.t.Fatalf("expected job %s to be %s, it's %s", job.ID.Hex(), status, response.Status)
+	return response
+}
+
+func TestParseMenuCard(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	var job models.ParseJob
+	s.expect(s.upload(venue, "pizzeria.pdf", "application/pdf", []byte("%PDF-1.4")), http.StatusAccepted, &job)
+	if job.Status != models.ParseJobQueued || job.FileName != "pizzeria.pdf" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	response := s.waitForParseJob(job, models.ParseJobSucceeded)
+	draft := response.Draft
+	if draft == nil || draft.ID != response.DraftID || draft.ParseJobID != job.ID || response.Attempts != 1 {
+		t.Fatalf("expected the job to have the parsed draft, got %+v", response)
+	}
+	if draft.Status != models.MenuDraftOpen || len(draft.Warnings) != 0 {
+		t.Fatalf("expected an open draft without warnings, got %+v", draft)
+	}
+	if len(draft.Items) != 2 || draft.Items[0].Price != models.NewMoney(950, "EUR") || draft.Items[1].Categories[0] != "Drinks" {
+		t.Fatalf("unexpected items %+v", draft.Items)
+	}
+	if draft.Items[0].ID.IsZero() || draft.Items[0].ID == draft.Items[1].ID {
+		t.Fatalf("expected the items to get IDs, got %+v", draft.Items)
+	}
+	// Allergens the parser made up are dropped
+	if len(draft.Items[0].Allergens) != 2 {
+		t.Fatalf("expected gluten and milk, got %v", draft.Items[0].Allergens)
+	}
+
+	// Nothing goes live before the draft is published
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex(), nil), http.StatusOK, &venue)
+	if len(venue.MenuIDs) != 1 {
+		t.Fatalf("expected only the seeded menu on the venue, got %v", venue.MenuIDs)
+	}
+
+	// The job can only be seen through its own venue
+	s.expect(s.do(http.MethodGet, "/venues/"+primitive.NewObjectID().Hex()+"/menu/parse/"+job.ID.Hex(), nil), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodDelete, "/venues/"+venue.ID.Hex()+"/menu/parse/"+job.ID.Hex(), nil), http.StatusConflict, nil)
+}
+
+func TestParseMenuCardFails(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	var job models.ParseJob
+	s.expect(s.upload(venue, "unreadable.pdf", "application/pdf", []byte("%PDF-1.4")), http.StatusAccepted, &job)
+
+	response := s.waitForParseJob(job, models.ParseJobFailed)
+	if response.Error == "" || response.Draft != nil {
+		t.Fatalf("expected an error and no draft, got %+v", response)
+	}
+}
+
+func TestParseMenuCardWithInvalidOutput(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	var job models.ParseJob
+	s.expect(s.upload(venue, "garbled.pdf", "application/pdf", []byte("%PDF-1.4")), http.StatusAccepted, &job)
+	s.waitForParseJob(job, models.ParseJobFailed)
+
+	var response ParseJobResponse
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menu/parse/"+job.ID.Hex(), nil), http.StatusUnprocessableEntity, &response)
+	expected := []models.ParseProblem{{Item: 1, Field: "name"}, {Item: 2, Field: "price"}}
+	if len(response.Problems) != len(expected) || response.Draft != nil {
+		t.Fatalf("expected the problems and no draft, got %+v", response)
+	}
+	for i, problem := range response.Problems {
+		if problem.Item != expected[i].Item || problem.Field != expected[i].Field || problem.Message == "" {
+			t.Fatalf("expected a problem with item %d %s, got %+v", expected[i].Item, expected[i].Field, problem)
+		}
+	}
+}
+
+func TestCancelParseJob(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+	s.parser.SetDelay(time.Hour)
+
+	var job models.ParseJob
+	s.expect(s.upload(venue, "pizzeria.pdf", "application/pdf", []byte("%PDF-1.4")), http.StatusAccepted, &job)
+	s.waitForParseJob(job, models.ParseJobRunning)
+
+	s.expect(s.do(http.MethodDelete, "/venues/"+venue.ID.Hex()+"/menu/parse/"+job.ID.Hex(), nil), http.StatusOK, &job)
+	if job.Status != models.ParseJobCancelled {
+		t.Fatalf("expected the job to be cancelled, got %s", job.Status)
+	}
+
+	// The worker is free for the next job straight away
+	s.parser.SetDelay(0)
+	s.expect(s.upload(venue, "pizzeria.pdf", "application/pdf", []byte("%PDF-1.4")), http.StatusAccepted, &job)
+	s.waitForParseJob(job, models.ParseJobSucceeded)
+
+	// Only the draft of the second job
+	var drafts []models.MenuDraft
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menu/drafts/", nil), http.StatusOK, &drafts)
+	if len(drafts) != 1 || drafts[0].ParseJobID != job.ID {
+		t.Fatalf("expected the cancelled job to leave no draft, got %d drafts", len(drafts))
+	}
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menu/parse/"+primitive.NewObjectID().Hex(), nil), http.StatusNotFound, nil)
+}
+
+func TestParseMenuCardRejectsOtherFiles(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	s.expect(s.upload(venue, "menu.docx", "application/msword", []byte("doc")), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/menu/parse/", nil), http.StatusBadRequest, nil)
+
+	venue.ID = primitive.NewObjectID()
+	s.expect(s.upload(venue, "pizzeria.pdf", "application/pdf", []byte("%PDF-1.4")), http.StatusNotFound, nil)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SetMenuSchedule replaces when the menu is served
+func (h *Handler) SetMenuSchedule(c *gin.Context) {
+	log.Println("SetMenuSchedule")
+
+	var schedule models.Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.updateMenuSchedule(c, &schedule)
+}
+
+// DeleteMenuSchedule has the menu served whenever the venue takes orders
+func (h *Handler) DeleteMenuSchedule(c *gin.Context) {
+	log.Println("DeleteMenuSchedule")
+
+	h.updateMenuSchedule(c, nil)
+}
+
+func (h *Handler) updateMenuSchedule(c *gin.Context, schedule *models.Schedule) {
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+
+	menu, err := h.store.UpdateMenu(c.Request.Context(), menu.ID, repositories.Fields{"schedule": schedule})
+	if errors.Is(err, repositories.ErrMenuNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, withoutDeletedItems(menu))
+}
+
+// GetActiveMenus returns the venue's menus served now, or at the RFC 3339 time in ?at=
+func (h *Handler) GetActiveMenus(c *gin.Context) {
+	log.Println("GetActiveMenus")
+
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	at := time.Now()
+	if c.Query("at") != "" {
+		at, err = time.Parse(time.RFC3339, c.Query("at"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid time, expected RFC 3339"})
+			return
+		}
+	}
+
+	venue, err := h.store.GetVenueByID(c.Request.Context(), venueID)
+	if errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	location, err := venue.TimeLocation()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	menus, err := h.store.GetMenusByVenueID(c.Request.Context(), venueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	active := []models.MenuV2{}
+	for _, menu := range menus {
+		if menu.ServedAt(at.In(location)) {
+			active = append(active, withoutHiddenItems(withoutDeletedItems(menu)))
+		}
+	}
+
+	c.JSON(http.StatusOK, active)
+}
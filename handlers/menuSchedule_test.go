@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestActiveMenus(t *testing.T) {
+	s := newTestServer(t)
+	venue, dinner := s.seedMenu()
+	if _, err := s.store.UpdateVenue(context.Background(), venue.ID, repositories.Fields{"time_zone": "Europe/Amsterdam"}); err != nil {
+		t.Fatal(err)
+	}
+	menus := "/venues/" + venue.ID.Hex() + "/menu/"
+
+	breakfast := models.Schedule{
+		Weekly: []models.WeeklyHours{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, TimeRange: models.TimeRange{From: "07:00", To: "11:00"}}},
+		Overrides: []models.ScheduleOverride{
+			{Date: "2024-12-24", Hours: []models.TimeRange{{From: "10:00", To: "14:00"}}},
+			{Date: "2024-12-25", Closed: true},
+		},
+	}
+	happyHour := map[string]interface{}{
+		"name":     "Happy hour",
+		"schedule": map[string]interface{}{"weekly": []map[string]interface{}{{"days": []string{"fri", "sat"}, "from": "22:00", "to": "02:00"}}},
+	}
+
+	var breakfastMenu, happyHourMenu models.MenuV2
+	s.expect(s.do(http.MethodPost, menus, map[string]interface{}{"name": "Breakfast"}), http.StatusOK, &breakfastMenu)
+	s.expect(s.do(http.MethodPut, menus+breakfastMenu.ID.Hex()+"/schedule", breakfast), http.StatusOK, &breakfastMenu)
+	s.expect(s.do(http.MethodPost, menus, happyHour), http.StatusOK, &happyHourMenu)
+
+	tests := map[string][]primitive.ObjectID{
+		"2024-03-15T08:00:00+01:00": {dinner.ID, breakfastMenu.ID}, // Friday breakfast
+		"2024-03-15T11:00:00+01:00": {dinner.ID},                   // breakfast is over
+		"2024-03-15T23:00:00+01:00": {dinner.ID, happyHourMenu.ID}, // Friday night
+		"2024-03-16T00:30:00Z":      {dinner.ID, happyHourMenu.ID}, // 01:30 in Amsterdam, still Friday's happy hour
+		"2024-03-17T01:30:00+01:00": {dinner.ID, happyHourMenu.ID}, // Saturday's happy hour
+		"2024-03-18T01:30:00+01:00": {dinner.ID},                   // no happy hour on Sunday
+		"2024-12-24T12:00:00+01:00": {dinner.ID, breakfastMenu.ID}, // late breakfast on Christmas Eve
+		"2024-12-25T08:00:00+01:00": {dinner.ID},                   // none on Christmas
+		"2024-12-26T08:00:00+01:00": {dinner.ID, breakfastMenu.ID}, // back to the weekly hours
+	}
+	for at, expected := range tests {
+		var active []models.MenuV2
+		s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menus/active?at="+url.QueryEscape(at), nil), http.StatusOK, &active)
+		if len(active) != len(expected) {
+			t.Fatalf("expected %d menus at %s, got %d", len(expected), at, len(active))
+		}
+		for i, menu := range active {
+			if menu.ID != expected[i] {
+				t.Fatalf("expected menu %s at %s, got %s", expected[i].Hex(), at, menu.Name)
+			}
+		}
+	}
+
+	// Without its schedule breakfast is served all day
+	var unscheduled models.MenuV2
+	s.expect(s.do(http.MethodDelete, menus+breakfastMenu.ID.Hex()+"/schedule", nil), http.StatusOK, &unscheduled)
+	var active []models.MenuV2
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menus/active?at=2024-12-25T20:00:00Z", nil), http.StatusOK, &active)
+	if unscheduled.Schedule != nil || len(active) != 2 {
+		t.Fatalf("expected breakfast to be served without its schedule, got %d menus", len(active))
+	}
+
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menus/active?at=tonight", nil), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodGet, "/venues/"+primitive.NewObjectID().Hex()+"/menus/active", nil), http.StatusNotFound, nil)
+}
+
+func TestInvalidMenuSchedules(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex() + "/schedule"
+
+	for _, schedule := range []map[string]interface{}{
+		{},
+		{"weekly": []map[string]interface{}{{"days": []string{"monday"}, "from": "07:00", "to": "11:00"}}},
+		{"weekly": []map[string]interface{}{{"days": []string{"mon"}, "from": "7am", "to": "11:00"}}},
+		{"weekly": []map[string]interface{}{{"days": []string{"mon"}, "from": "07:00", "to": "07:00"}}},
+		{"weekly": []map[string]interface{}{{"days": []string{}, "from": "07:00", "to": "11:00"}}},
+		{"overrides": []map[string]interface{}{{"date": "25-12-2024", "closed": true}}},
+		{"overrides": []map[string]interface{}{{"date": "2024-12-25"}}},
+	} {
+		s.expect(s.do(http.MethodPut, path, schedule), http.StatusBadRequest, nil)
+	}
+
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"weekly": []map[string]interface{}{{"days": []string{"sun"}, "from": "18:00", "to": "24:00"}}}), http.StatusOK, nil)
+}
+
+func TestOrderFromMenuNotServed(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	// Closed the one day it has hours on, so never served
+	never := map[string]interface{}{"overrides": []map[string]interface{}{{"date": "2020-01-01", "closed": true}}}
+	s.expect(s.do(http.MethodPut, "/venues/"+venue.ID.Hex()+"/menu/"+menu.ID.Hex()+"/schedule", never), http.StatusOK, nil)
+
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateMenuAddsItToVenue(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	body := map[string]interface{}{
+		"name": "Brunch",
+		"items": []map[string]interface{}{
+			{"name": "Pancakes", "price": 8.5, "allergens": []string{"gluten", "eggs", "milk"}},
+		},
+	}
+	var menu models.MenuV2
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/menu/", body), http.StatusOK, &menu)
+	if menu.VenueID != venue.ID || len(menu.Items) != 1 || menu.Items[0].Price != models.NewMoney(850, "EUR") {
+		t.Fatalf("unexpected menu %+v", menu)
+	}
+
+	var menus []models.MenuV2
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/menus/", nil), http.StatusOK, &menus)
+	if len(menus) != 2 {
+		t.Fatalf("expected 2 menus for the venue, got %d", len(menus))
+	}
+
+	stored, err := s.store.GetVenueByID(context.Background(), venue.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.MenuIDs) != 2 || stored.MenuIDs[1] != menu.ID {
+		t.Fatalf("expected the menu on the venue, got %v", stored.MenuIDs)
+	}
+}
+
+func TestCreateMenuRejectsInvalidItems(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	body := map[string]interface{}{
+		"name": "Broken",
+		"items": []map[string]interface{}{
+			{"name": "Pizza", "price": 10, "allergens": []string{"glitter"}},
+		},
+	}
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/menu/", body), http.StatusBadRequest, nil)
+}
+
+func TestMenuItemLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	items := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex() + "/items/"
+
+	var item models.MenuItemV2
+	s.expect(s.do(http.MethodPost, items, map[string]interface{}{"name": "Tiramisu", "price": 6}), http.StatusOK, &item)
+
+	s.expect(s.do(http.MethodPut, items+item.ID.Hex(), map[string]interface{}{"description": "With mascarpone"}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, items+item.ID.Hex(), nil), http.StatusOK, &item)
+	if item.Name != "Tiramisu" || item.Description != "With mascarpone" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	s.expect(s.do(http.MethodDelete, items+item.ID.Hex(), nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, items+item.ID.Hex(), nil), http.StatusNotFound, nil)
+
+	var listed []models.MenuItemV2
+	s.expect(s.do(http.MethodGet, items, nil), http.StatusOK, &listed)
+	if len(listed) != 2 {
+		t.Fatalf("expected the deleted item to be left out, got %d items", len(listed))
+	}
+
+	s.expect(s.do(http.MethodPut, items+primitive.NewObjectID().Hex(), map[string]interface{}{"name": "Ghost"}), http.StatusNotFound, nil)
+}
+
+func TestSoftDeleteMenu(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex()
+
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodDelete, path, nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusNotFound, nil)
+
+	stored, err := s.store.GetMenuByID(context.Background(), menu.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range stored.Items {
+		if item.DeletedAt == nil {
+			t.Fatalf("expected item %s to be deleted with the menu", item.Name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetMenuVersions lists the menu's versions newest first, GetMenuVersion has the items of each
+func (h *Handler) GetMenuVersions(c *gin.Context) {
+	log.Println("GetMenuVersions")
+
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.store.GetMenuVersions(c.Request.Context(), menu.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+func (h *Handler) GetMenuVersion(c *gin.Context) {
+	log.Println("GetMenuVersion")
+
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+	version, ok := menuVersionParam(c, c.Param("version"))
+	if !ok {
+		return
+	}
+
+	menuVersion, err := h.store.GetMenuVersion(c.Request.Context(), menu.ID, version)
+	if err != nil {
+		menuVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, menuVersion)
+}
+
+// DiffMenuVersions compares the versions in ?from= and ?to=, which default to the current version and the one before
+func (h *Handler) DiffMenuVersions(c *gin.Context) {
+	log.Println("DiffMenuVersions")
+
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+
+	to := menu.Version
+	if c.Query("to") != "" {
+		if to, ok = menuVersionParam(c, c.Query("to")); !ok {
+			return
+		}
+	}
+	from := to - 1
+	if c.Query("from") != "" {
+		if from, ok = menuVersionParam(c, c.Query("from")); !ok {
+			return
+		}
+	}
+
+	versions := make([]models.MenuVersion, 2)
+	for i, version := range []int{from, to} {
+		var err error
+		versions[i], err = h.store.GetMenuVersion(c.Request.Context(), menu.ID, version)
+		if err != nil {
+			menuVersionError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.DiffMenuVersions(versions[0], versions[1]))
+}
+
+// RollbackMenu puts an earlier version of the menu back live, which makes it the newest version
+func (h *Handler) RollbackMenu(c *gin.Context) {
+	log.Println("RollbackMenu")
+
+	menu, ok := h.venueMenu(c)
+	if !ok {
+		return
+	}
+	version, ok := menuVersionParam(c, c.Param("version"))
+	if !ok {
+		return
+	}
+
+	menu, err := h.store.RollbackMenu(c.Request.Context(), menu.ID, version)
+	if err != nil {
+		menuVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, withoutDeletedItems(menu))
+}
+
+// venueMenu loads the live menu named in the URL, responding with an error unless it's one of the venue's
+func (h *Handler) venueMenu(c *gin.Context) (models.MenuV2, bool) {
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return models.MenuV2{}, false
+	}
+	menuID, err := primitive.ObjectIDFromHex(c.Param("menuId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return models.MenuV2{}, false
+	}
+
+	menu, err := h.store.GetMenuByID(c.Request.Context(), menuID)
+	if errors.Is(err, repositories.ErrMenuNotFound) || (err == nil && (menu.VenueID != venueID || menu.DeletedAt != nil)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+		return menu, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return menu, false
+	}
+
+	return menu, true
+}
+
+func menuVersionParam(c *gin.Context, param string) (int, bool) {
+	version, err := strconv.Atoi(param)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid menu version"})
+		return 0, false
+	}
+	return version, true
+}
+
+func menuVersionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrMenuVersionNotFound), errors.Is(err, repositories.ErrMenuNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
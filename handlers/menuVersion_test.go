@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMenuVersions(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex()
+	pizza, soda := menu.Items[0], menu.Items[1]
+
+	// Every change is a version, on top of the menu being created
+	var tiramisu models.MenuItemV2
+	s.expect(s.do(http.MethodPut, path+"/items/"+pizza.ID.Hex(), map[string]interface{}{"price": 13.5}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPost, path+"/items/", map[string]interface{}{"name": "Tiramisu", "price": 6}), http.StatusOK, &tiramisu)
+	s.expect(s.do(http.MethodDelete, path+"/items/"+soda.ID.Hex(), nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"name": "Dinner & Dessert", "version": 1}), http.StatusOK, &menu)
+	if menu.Version != 5 {
+		t.Fatalf("expected the menu at version 5, got %d", menu.Version)
+	}
+
+	var versions []models.MenuVersion
+	s.expect(s.do(http.MethodGet, path+"/versions/", nil), http.StatusOK, &versions)
+	changes := []string{models.MenuChangeUpdated, models.MenuChangeItemDeleted, models.MenuChangeItemAdded, models.MenuChangeItemUpdated, models.MenuChangeCreated}
+	if len(versions) != len(changes) {
+		t.Fatalf("expected %d versions, got %+v", len(changes), versions)
+	}
+	for i, version := range versions {
+		if version.Version != 5-i || version.Change != changes[i] || version.Items != nil {
+			t.Fatalf("expected version %d %s without items, got %+v", 5-i, changes[i], version)
+		}
+	}
+
+	var version models.MenuVersion
+	s.expect(s.do(http.MethodGet, path+"/versions/1", nil), http.StatusOK, &version)
+	if version.Name != "Dinner" || len(version.Items) != 2 || version.Items[0].Price != models.NewMoney(1250, "EUR") {
+		t.Fatalf("expected the menu as it was created, got %+v", version)
+	}
+
+	var diff models.MenuDiff
+	s.expect(s.do(http.MethodGet, path+"/diff?from=1", nil), http.StatusOK, &diff)
+	if diff.From != 1 || diff.To != 5 || len(diff.Added) != 1 || diff.Added[0].ID != tiramisu.ID || len(diff.Removed) != 1 || diff.Removed[0].ID != soda.ID {
+		t.Fatalf("expected the tiramisu added and the soda removed, got %+v", diff)
+	}
+	if len(diff.PriceChanged) != 1 || diff.PriceChanged[0].From != models.NewMoney(1250, "EUR") || diff.PriceChanged[0].To != models.NewMoney(1350, "EUR") {
+		t.Fatalf("expected the pizza's price change, got %+v", diff.PriceChanged)
+	}
+
+	// Only the name changed in the last version
+	s.expect(s.do(http.MethodGet, path+"/diff", nil), http.StatusOK, &diff)
+	if diff.From != 4 || len(diff.Added)+len(diff.Removed)+len(diff.PriceChanged)+len(diff.Changed) != 0 {
+		t.Fatalf("expected no item changes from 4 to 5, got %+v", diff)
+	}
+
+	s.expect(s.do(http.MethodGet, path+"/diff?from=9", nil), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodGet, path+"/diff?from=first", nil), http.StatusBadRequest, nil)
+	other, _ := s.seedMenu()
+	s.expect(s.do(http.MethodGet, "/venues/"+other.ID.Hex()+"/menu/"+menu.ID.Hex()+"/versions/", nil), http.StatusNotFound, nil)
+}
+
+func TestRollbackMenu(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex()
+
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"items": []models.MenuItemV2{menu.Items[0]}}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPost, path+"/versions/1/rollback", nil), http.StatusOK, &menu)
+	if menu.Version != 3 || len(menu.Items) != 2 {
+		t.Fatalf("expected both items back as version 3, got %+v", menu)
+	}
+
+	var versions []models.MenuVersion
+	s.expect(s.do(http.MethodGet, path+"/versions/", nil), http.StatusOK, &versions)
+	if versions[0].Change != models.MenuChangeRolledBack || versions[0].RolledBackTo != 1 {
+		t.Fatalf("expected the rollback as the newest version, got %+v", versions[0])
+	}
+
+	// Orders remember which version priced them
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	if order.MenuVersion != 3 {
+		t.Fatalf("expected the order priced from version 3, got %d", order.MenuVersion)
+	}
+
+	s.expect(s.do(http.MethodPost, path+"/versions/7/rollback", nil), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/menu/"+primitive.NewObjectID().Hex()+"/versions/1/rollback", nil), http.StatusNotFound, nil)
+}
+
+func TestSoftDeleteMenuRecordsVersion(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex()
+
+	s.expect(s.do(http.MethodDelete, path, nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodDelete, path, nil), http.StatusOK, nil)
+
+	versions, err := s.store.GetMenuVersions(context.Background(), menu.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Change != models.MenuChangeDeleted || versions[0].Version != 2 {
+		t.Fatalf("expected the deletion recorded once as version 2, got %+v", versions)
+	}
+}
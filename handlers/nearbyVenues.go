@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// In meters
+const defaultNearbyRadius = 5000
+const maxNearbyRadius = 50000
+
+const defaultNearbyLimit = 20
+const maxNearbyLimit = 50
+
+// NearbyVenueResponse is a venue with whether it's open right now and how far away it is in meters
+type NearbyVenueResponse struct {
+	VenueResponse
+	Distance float64 `json:"distance"`
+}
+
+// NearbyVenuesResponse is a page of nearby venues, NextCursor fetches the next one and is empty on the last page
+type NearbyVenuesResponse struct {
+	Venues     []NearbyVenueResponse `json:"venues"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// GetNearbyVenues lists the venues around lat and lng, nearest first. They can be narrowed down to a city, to the
+// venues open right now and to the ones that take orders.
+func (h *Handler) GetNearbyVenues(c *gin.Context) {
+	log.Println("GetNearbyVenues")
+
+	query, ok := nearbyVenuesQuery(c)
+	if !ok {
+		return
+	}
+	openNow := c.Query("open_now") == "true"
+	now := time.Now()
+
+	// Whether a venue is open can't be asked of the store, so closed venues are dropped here and the store is asked
+	// for more until the page is full or it runs out
+	response := NearbyVenuesResponse{Venues: []NearbyVenueResponse{}}
+	for {
+		venues, err := h.store.GetNearbyVenues(c.Request.Context(), query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, venue := range venues {
+			query.After = &repositories.NearbyVenue{Venue: models.Venue{ID: venue.ID}, Distance: venue.Distance}
+
+			status, err := venue.OpeningStatusAt(now)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if openNow && !status.IsOpenNow {
+				continue
+			}
+
+			response.Venues = append(response.Venues, NearbyVenueResponse{
+				VenueResponse: VenueResponse{Venue: venue.Venue, OpeningStatus: status},
+				Distance:      venue.Distance,
+			})
+			if len(response.Venues) == query.Limit {
+				response.NextCursor = encodeNearbyCursor(*query.After)
+				c.JSON(http.StatusOK, response)
+				return
+			}
+		}
+
+		if len(venues) < query.Limit {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+}
+
+func nearbyVenuesQuery(c *gin.Context) (repositories.NearbyVenuesQuery, bool) {
+	query := repositories.NearbyVenuesQuery{
+		City:              strings.TrimSpace(c.Query("city")),
+		OrderingSupported: c.Query("ordering_supported") == "true",
+	}
+
+	point, radius, ok := pointParams(c)
+	if !ok {
+		return query, false
+	}
+	query.Point, query.Radius = point, radius
+
+	if query.Limit, ok = limitParam(c, defaultNearbyLimit, maxNearbyLimit); !ok {
+		return query, false
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		after, ok := decodeNearbyCursor(s)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return query, false
+		}
+		query.After = &after
+	}
+
+	return query, true
+}
+
+// pointParams reads lat and lng, and the radius around them in meters
+func pointParams(c *gin.Context) (models.GeoPoint, float64, bool) {
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+	if latErr != nil || lngErr != nil || !models.ValidCoordinates(lat, lng) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng are required, " + models.ErrInvalidLocation.Error()})
+		return models.GeoPoint{}, 0, false
+	}
+
+	radius := float64(defaultNearbyRadius)
+	if s := c.Query("radius"); s != "" {
+		var err error
+		radius, err = strconv.ParseFloat(s, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be more than 0 and at most " + strconv.Itoa(maxNearbyRadius) + " meters"})
+			return models.GeoPoint{}, 0, false
+		}
+	}
+
+	return models.NewGeoPoint(lat, lng), radius, true
+}
+
+// limitParam reads how many results to return, up to max
+func limitParam(c *gin.Context, defaultLimit int, max int) (int, bool) {
+	s := c.Query("limit")
+	if s == "" {
+		return defaultLimit, true
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(max)})
+		return 0, false
+	}
+	return limit, true
+}
+
+// The cursor is the last venue on the page, its distance and ID
+func encodeNearbyCursor(last repositories.NearbyVenue) string {
+	cursor := strconv.FormatFloat(last.Distance, 'g', -1, 64) + ":" + last.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeNearbyCursor(cursor string) (repositories.NearbyVenue, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return repositories.NearbyVenue{}, false
+	}
+	distance, id, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return repositories.NearbyVenue{}, false
+	}
+
+	var last repositories.NearbyVenue
+	if last.Distance, err = strconv.ParseFloat(distance, 64); err != nil || last.Distance < 0 {
+		return repositories.NearbyVenue{}, false
+	}
+	if last.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return repositories.NearbyVenue{}, false
+	}
+	return last, true
+}
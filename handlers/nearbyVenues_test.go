@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Dam Square
+const damLat, damLng = 52.3731, 4.8926
+
+func (s *testServer) createVenue(venue map[string]interface{}) primitive.ObjectID {
+	var created struct {
+		InsertedID primitive.ObjectID `json:"InsertedID"`
+	}
+	s.expect(s.do(http.MethodPost, "/venues/", venue), http.StatusOK, &created)
+	return created.InsertedID
+}
+
+func (s *testServer) nearby(params url.Values) NearbyVenuesResponse {
+	params.Set("lat", strconv.FormatFloat(damLat, 'f', -1, 64))
+	params.Set("lng", strconv.FormatFloat(damLng, 'f', -1, 64))
+
+	var response NearbyVenuesResponse
+	s.expect(s.do(http.MethodGet, "/venues/nearby?"+params.Encode(), nil), http.StatusOK, &response)
+	return response
+}
+
+func nearbyNames(response NearbyVenuesResponse) []string {
+	names := []string{}
+	for _, venue := range response.Venues {
+		names = append(names, venue.Name)
+	}
+	return names
+}
+
+func expectNames(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestNearbyVenues(t *testing.T) {
+	s := newTestServer(t)
+
+	at := func(lat, lng float64, city string) map[string]interface{} {
+		return map[string]interface{}{"latitude": lat, "longitude": lng, "city": city}
+	}
+	closedToday := models.Schedule{
+		Weekly:    []models.WeeklyHours{{Days: everyDay, TimeRange: models.TimeRange{From: "00:00", To: "24:00"}}},
+		Overrides: []models.ScheduleOverride{{Date: time.Now().UTC().Format(time.DateOnly), Closed: true}},
+	}
+
+	s.createVenue(map[string]interface{}{"name": "Cafe", "location": at(52.3740, 4.8897, "Amsterdam"), "ordering_supported": true})
+	s.createVenue(map[string]interface{}{"name": "Bakery", "location": at(52.3600, 4.8852, "Amsterdam"), "opening_hours": closedToday})
+	s.createVenue(map[string]interface{}{"name": "Bar", "location": at(52.3676, 4.9041, "amsterdam"), "ordering_supported": true})
+	s.createVenue(map[string]interface{}{"name": "Harbour", "location": at(51.9225, 4.4792, "Rotterdam")})
+	s.createVenue(map[string]interface{}{"name": "Unplaced"})
+	deleted := s.createVenue(map[string]interface{}{"name": "Gone", "location": at(damLat, damLng, "Amsterdam")})
+	s.expect(s.do(http.MethodDelete, "/venues/"+deleted.Hex(), nil), http.StatusOK, nil)
+
+	// Nearest first with their distance, leaving out deleted venues, unplaced ones and ones out of range
+	all := s.nearby(url.Values{})
+	expectNames(t, nearbyNames(all), "Cafe", "Bar", "Bakery")
+	if all.NextCursor != "" {
+		t.Fatalf("expected no next page, got %q", all.NextCursor)
+	}
+	if d := all.Venues[0].Distance; d < 150 || d > 300 {
+		t.Fatalf("expected the cafe about 220m away, got %v", d)
+	}
+	if all.Venues[0].Location.Point == nil || all.Venues[0].Location.Point.Coordinates[0] != 4.8897 {
+		t.Fatalf("expected the cafe's GeoJSON point, got %+v", all.Venues[0].Location)
+	}
+	expectNames(t, nearbyNames(s.nearby(url.Values{"radius": {"1200"}})), "Cafe", "Bar")
+
+	// Filters
+	expectNames(t, nearbyNames(s.nearby(url.Values{"city": {"AMSTERDAM"}})), "Cafe", "Bar", "Bakery")
+	expectNames(t, nearbyNames(s.nearby(url.Values{"city": {"Rotterdam"}})))
+	expectNames(t, nearbyNames(s.nearby(url.Values{"ordering_supported": {"true"}})), "Cafe", "Bar")
+	openNow := s.nearby(url.Values{"open_now": {"true"}})
+	expectNames(t, nearbyNames(openNow), "Cafe", "Bar")
+	if !openNow.Venues[0].IsOpenNow {
+		t.Fatalf("expected the opening status with the venue, got %+v", openNow.Venues[0].OpeningStatus)
+	}
+
+	// A page at a time, the cursor picks up after the last venue and the closed bakery is skipped on the way
+	pages := func(params url.Values) []string {
+		names := []string{}
+		for {
+			page := s.nearby(params)
+			if len(page.Venues) > 1 {
+				t.Fatalf("expected a venue per page, got %v", nearbyNames(page))
+			}
+			names = append(names, nearbyNames(page)...)
+			if page.NextCursor == "" {
+				return names
+			}
+			params.Set("cursor", page.NextCursor)
+		}
+	}
+	expectNames(t, pages(url.Values{"limit": {"1"}}), "Cafe", "Bar", "Bakery")
+	expectNames(t, pages(url.Values{"limit": {"1"}, "open_now": {"true"}}), "Cafe", "Bar")
+
+	// GetAllVenues leaves out the deleted venue too
+	var venues []models.Venue
+	s.expect(s.do(http.MethodGet, "/venues/", nil), http.StatusOK, &venues)
+	if len(venues) != 5 {
+		t.Fatalf("expected 5 venues, got %d", len(venues))
+	}
+}
+
+func TestNearbyVenuesTiesPageByID(t *testing.T) {
+	s := newTestServer(t)
+
+	location := map[string]interface{}{"latitude": damLat, "longitude": damLng}
+	first := s.createVenue(map[string]interface{}{"name": "First", "location": location})
+	second := s.createVenue(map[string]interface{}{"name": "Second", "location": location})
+	if second.Hex() < first.Hex() {
+		t.Fatal("expected IDs to count up")
+	}
+
+	page := s.nearby(url.Values{"limit": {"1"}})
+	expectNames(t, nearbyNames(page), "First")
+	page = s.nearby(url.Values{"limit": {"1"}, "cursor": {page.NextCursor}})
+	expectNames(t, nearbyNames(page), "Second")
+	if page.Venues[0].Distance != 0 {
+		t.Fatalf("expected no distance, got %v", page.Venues[0].Distance)
+	}
+}
+
+func TestNearbyVenuesRejectsBadParams(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, query := range []string{
+		"",
+		"lat=52.37",
+		"lat=91&lng=4.89",
+		"lat=52.37&lng=abc",
+		"lat=52.37&lng=4.89&radius=0",
+		"lat=52.37&lng=4.89&radius=50001",
+		"lat=52.37&lng=4.89&limit=0",
+		"lat=52.37&lng=4.89&limit=51",
+		"lat=52.37&lng=4.89&cursor=nope",
+	} {
+		rec := s.do(http.MethodGet, "/venues/nearby?"+query, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, rec.Code)
+		}
+	}
+
+	s.expect(s.do(http.MethodPost, "/venues/", map[string]interface{}{"name": "Cafe", "location": map[string]interface{}{"latitude": 91}}), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OpeningHoursRequest replaces the venue's opening hours, and how many minutes before closing the kitchen stops
+// taking orders
+type OpeningHoursRequest struct {
+	OpeningHours        models.Schedule `json:"opening_hours"`
+	KitchenClosesBefore int             `json:"kitchen_closes_before"`
+}
+
+func (h *Handler) SetOpeningHours(c *gin.Context) {
+	log.Println("SetOpeningHours")
+
+	var request OpeningHoursRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	venue := models.Venue{OpeningHours: &request.OpeningHours, KitchenClosesBefore: request.KitchenClosesBefore}
+	if err := venue.ValidateOpeningHours(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.updateOpeningHours(c, venue.OpeningHours, venue.KitchenClosesBefore)
+}
+
+// DeleteOpeningHours has the venue open all the time, it takes orders whenever ordering is supported
+func (h *Handler) DeleteOpeningHours(c *gin.Context) {
+	log.Println("DeleteOpeningHours")
+
+	h.updateOpeningHours(c, nil, 0)
+}
+
+func (h *Handler) updateOpeningHours(c *gin.Context, openingHours *models.Schedule, kitchenClosesBefore int) {
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	fields := repositories.Fields{"opening_hours": openingHours, "kitchen_closes_before": kitchenClosesBefore}
+	venue, err := h.store.UpdateVenue(c.Request.Context(), venueID, fields)
+	if errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := venue.OpeningStatusAt(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, VenueResponse{Venue: venue, OpeningStatus: status})
+}
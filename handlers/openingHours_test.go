@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+)
+
+var everyDay = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+func TestVenueOpeningHours(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.UpdateVenue(context.Background(), venue.ID, repositories.Fields{"time_zone": "Europe/Amsterdam"}); err != nil {
+		t.Fatal(err)
+	}
+	path := "/venues/" + venue.ID.Hex()
+
+	// Always open without opening hours, and round the clock with hours that run into each other
+	var response VenueResponse
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &response)
+	if !response.IsOpenNow || !response.TakingOrders || response.ClosesAt != nil || response.NextOpen != nil {
+		t.Fatalf("expected the venue to be open, got %+v", response.OpeningStatus)
+	}
+	allDay := models.Schedule{Weekly: []models.WeeklyHours{{Days: everyDay, TimeRange: models.TimeRange{From: "00:00", To: "24:00"}}}}
+	s.expect(s.do(http.MethodPut, path+"/hours", OpeningHoursRequest{OpeningHours: allDay}), http.StatusOK, &response)
+	if !response.IsOpenNow || response.ClosesAt != nil {
+		t.Fatalf("expected the venue to be open round the clock, got %+v", response.OpeningStatus)
+	}
+
+	// Closed today, open again at midnight
+	today := time.Now().In(amsterdam)
+	closed := allDay
+	closed.Overrides = []models.ScheduleOverride{{Date: today.Format(time.DateOnly), Closed: true}}
+	s.expect(s.do(http.MethodPut, path+"/hours", OpeningHoursRequest{OpeningHours: closed}), http.StatusOK, &response)
+	tomorrow := time.Date(today.Year(), today.Month(), today.Day()+1, 0, 0, 0, 0, amsterdam)
+	if response.IsOpenNow || response.TakingOrders || response.NextOpen == nil || !response.NextOpen.Equal(tomorrow) {
+		t.Fatalf("expected the venue to open at %s, got %+v", tomorrow, response.OpeningStatus)
+	}
+
+	var refused struct {
+		Error    string     `json:"error"`
+		NextOpen *time.Time `json:"next_open"`
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusConflict, &refused)
+	if refused.Error != models.ErrVenueClosed.Error() || refused.NextOpen == nil || !refused.NextOpen.Equal(tomorrow) {
+		t.Fatalf("unexpected response %+v", refused)
+	}
+
+	// Open for another half hour, but the kitchen closes 45 minutes before
+	now := time.Now().In(amsterdam)
+	closing := models.Schedule{Weekly: []models.WeeklyHours{{Days: everyDay, TimeRange: models.TimeRange{
+		From: now.Add(-time.Hour).Format("15:04"),
+		To:   now.Add(30 * time.Minute).Format("15:04"),
+	}}}}
+	s.expect(s.do(http.MethodPut, path+"/hours", OpeningHoursRequest{OpeningHours: closing, KitchenClosesBefore: 45}), http.StatusOK, &response)
+	if !response.IsOpenNow || response.TakingOrders || response.ClosesAt == nil {
+		t.Fatalf("expected the kitchen to be closed, got %+v", response.OpeningStatus)
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusConflict, &refused)
+	if !strings.Contains(refused.Error, "kitchen") {
+		t.Fatalf("expected the kitchen to be closed, got %q", refused.Error)
+	}
+
+	s.expect(s.do(http.MethodPut, path+"/hours", OpeningHoursRequest{OpeningHours: closing, KitchenClosesBefore: 15}), http.StatusOK, &response)
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, nil)
+
+	var always VenueResponse
+	s.expect(s.do(http.MethodDelete, path+"/hours", nil), http.StatusOK, &always)
+	if always.OpeningHours != nil || always.KitchenClosesBefore != 0 || !always.TakingOrders {
+		t.Fatalf("expected the venue to be open without opening hours, got %+v", always)
+	}
+}
+
+func TestOrderingNotSupported(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	s.linkStripeAccount(venue)
+
+	var order, draft models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	draftBody := orderBody(venue, menu, 1)
+	draftBody["status"] = models.OrderStatusDraft
+	s.expect(s.do(http.MethodPost, "/orders/", draftBody), http.StatusCreated, &draft)
+
+	// Updating other fields leaves ordering on
+	s.expect(s.do(http.MethodPut, "/venues/"+venue.ID.Hex(), map[string]interface{}{"name": "Trattoria Roma"}), http.StatusOK, &venue)
+	if !venue.OrderingSupported {
+		t.Fatal("expected the venue to still take orders")
+	}
+
+	s.expect(s.do(http.MethodPut, "/venues/"+venue.ID.Hex(), map[string]interface{}{"ordering_supported": false}), http.StatusOK, &venue)
+	var refused struct {
+		Error string `json:"error"`
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusConflict, &refused)
+	if refused.Error != models.ErrOrderingNotSupported.Error() {
+		t.Fatalf("unexpected response %+v", refused)
+	}
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+order.ID.Hex(), nil), http.StatusConflict, nil)
+
+	// A draft that can't be checked out stays a draft
+	s.expect(s.do(http.MethodPost, "/payments/checkout/"+draft.ID.Hex(), nil), http.StatusConflict, nil)
+	s.expect(s.do(http.MethodGet, "/orders/"+draft.ID.Hex(), nil), http.StatusOK, &draft)
+	if draft.Status != models.OrderStatusDraft {
+		t.Fatalf("expected the order to still be a draft, got %s", draft.Status)
+	}
+}
+
+func TestInvalidOpeningHours(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/hours"
+
+	s.expect(s.do(http.MethodPut, path, OpeningHoursRequest{}), http.StatusBadRequest, nil)
+	badHours := models.Schedule{Weekly: []models.WeeklyHours{{Days: []string{"mon"}, TimeRange: models.TimeRange{From: "9", To: "17:00"}}}}
+	s.expect(s.do(http.MethodPut, path, OpeningHoursRequest{OpeningHours: badHours}), http.StatusBadRequest, nil)
+	hours := models.Schedule{Weekly: []models.WeeklyHours{{Days: []string{"mon"}, TimeRange: models.TimeRange{From: "09:00", To: "17:00"}}}}
+	s.expect(s.do(http.MethodPut, path, OpeningHoursRequest{OpeningHours: hours, KitchenClosesBefore: -5}), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPost, "/venues/", map[string]interface{}{"name": "Cafe", "opening_hours": map[string]interface{}{}}), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Keeps proxies and tablets from dropping an idle stream
+const feedHeartbeatInterval = 20 * time.Second
+
+const feedReplayBatch = 200
+
+// StreamVenueOrders streams the venue's order events as Server-Sent Events. Clients that reconnect with the
+// Last-Event-ID header (or last_event_id query parameter) first get every event they missed.
+//
+// A browser EventSource can't set the Authorization header, it passes the token as the token query parameter
+// instead. Tokens expire quickly and EventSource reconnects to the same URL, so such clients reconnect on their
+// own: a new EventSource with a fresh token and the last event ID they saw as last_event_id.
+func (h *Handler) StreamVenueOrders(c *gin.Context) {
+	log.Println("StreamVenueOrders")
+
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastSent int64
+	replay := false
+	switch {
+	case lastEventID == "":
+	case primitive.IsValidObjectID(lastEventID):
+		// Events used to be numbered by their ObjectID, those can't be placed in the sequence so only new events
+		// are streamed to a client still holding one
+	default:
+		lastSent, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastSent < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid last event ID"})
+			return
+		}
+		replay = true
+	}
+
+	// Subscribe before replaying so nothing written in between is lost, duplicates are skipped below
+	live, unsubscribe := h.orders.Subscribe(venueID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event models.OrderEvent) bool {
+		if event.Sequence <= lastSent {
+			return true
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Println("StreamVenueOrders", err)
+			return true
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		lastSent = event.Sequence
+		return true
+	}
+
+	if replay {
+		for {
+			missed, err := h.store.GetOrderEventsAfter(c.Request.Context(), venueID, lastSent, feedReplayBatch)
+			if err != nil {
+				log.Println("StreamVenueOrders", "replay failed", err)
+				return
+			}
+			for _, event := range missed {
+				if !send(event) {
+					return
+				}
+			}
+			if len(missed) < feedReplayBatch {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(feedHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case event, ok := <-live:
+			if !ok {
+				// Fell behind, the client reconnects and replays from its last event ID
+				return
+			}
+			if !send(event) {
+				return
+			}
+		}
+	}
+}
+
+// GetOrdersByVenueID returns the venue's orders, optionally only those in the given statuses, so a display
+// can load the open tickets before following the feed
+func (h *Handler) GetOrdersByVenueID(c *gin.Context) {
+	log.Println("GetOrdersByVenueID")
+
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	var statuses []models.OrderStatus
+	for _, status := range c.QueryArray("status") {
+		statuses = append(statuses, models.OrderStatus(status))
+	}
+
+	orders, err := h.store.GetOrdersByVenueID(c.Request.Context(), venueID, statuses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
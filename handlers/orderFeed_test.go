@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stream opens the venue's order feed the way a browser EventSource does, with the token in the query, and
+// returns what came through before ctx ran out
+func (s *testServer) stream(path string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestStreamVenueOrdersReplaysBySequence(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	for i := 0; i < 3; i++ {
+		s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, nil)
+	}
+
+	rec := s.stream("/venues/" + venue.ID.Hex() + "/orders/stream?last_event_id=1&token=" + s.token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "id: 1\n") || !strings.Contains(body, "id: 2\nevent: order.created\n") || !strings.Contains(body, "id: 3\n") {
+		t.Fatalf("expected events 2 and 3, got %q", body)
+	}
+
+	// Old ObjectID event IDs only get new events, anything else isn't an event ID
+	rec = s.stream("/venues/" + venue.ID.Hex() + "/orders/stream?last_event_id=" + venue.ID.Hex() + "&token=" + s.token)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "id: ") {
+		t.Fatalf("expected no replay, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = s.stream("/venues/" + venue.ID.Hex() + "/orders/stream?last_event_id=-1&token=" + s.token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestStreamVenueOrdersTokenOnlyForEventStreams(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	req := httptest.NewRequest(http.MethodGet, "/venues/"+venue.ID.Hex()+"/orders/?token="+s.token, nil)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
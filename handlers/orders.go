@@ -2,33 +2,104 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/SaplingPay/server/qr"
 	"github.com/SaplingPay/server/repositories"
 
-	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func CreateOrder(c *gin.Context) {
+func (h *Handler) CreateOrder(c *gin.Context) {
 	var order models.Order
 	if err := c.ShouldBindJSON(&order); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Orders start as a draft the guest is still building, or ready to be paid
+	if order.Status == "" {
+		order.Status = models.OrderStatusAwaitingPayment
+	}
+	if order.Status != models.OrderStatusDraft && order.Status != models.OrderStatusAwaitingPayment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "orders can only be created as draft or awaiting_payment"})
+		return
+	}
+
+	venue, err := h.store.GetVenueByID(c.Request.Context(), order.VenueID)
+	if errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "venue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !takingOrders(c, venue) {
+		return
+	}
+
+	items, menuVersion, err := h.priceOrderItems(c.Request.Context(), venue, order.MenuID, order.Items)
+	if orderItemsError(c, err) {
+		return
+	}
+	order.Items = items
+	order.MenuVersion = menuVersion
+	order.Stock = nil
+
+	if !order.TableID.IsZero() {
+		if !qr.VerifyTable(order.VenueID, order.TableID, order.TableSignature) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid table signature"})
+			return
+		}
+		table, err := h.store.GetVenueTable(c.Request.Context(), order.VenueID, order.TableID)
+		if errors.Is(err, repositories.ErrTableNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		order.TableName = table.Name
+		order.Zone = table.Zone
+	} else {
+		order.TableName = ""
+		order.Zone = ""
+	}
+	order.TableSignature = ""
+
 	order.ID = primitive.NewObjectID() // Generate a new ID for the order
 	order.Timestamp = primitive.NewDateTimeFromTime(time.Now())
-	order.Status = "sent" // Set the default status
 
-	// Assuming there's logic to calculate the total from order.Items
+	order.BusinessDay, err = venue.BusinessDay(order.Timestamp.Time())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	order.Number, err = h.store.NextOrderNumber(c.Request.Context(), order.VenueID, order.BusinessDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	order.StatusHistory = []models.OrderStatusChange{{
+		To:      order.Status,
+		At:      order.Timestamp,
+		Trigger: models.OrderTriggerCreated,
+	}}
+
 	order.Total = calculateTotal(order.Items)
 
-	_, err := db.DB.Collection(db.CollectionNameOrders).InsertOne(context.Background(), order)
+	err = h.store.CreateOrder(c.Request.Context(), order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -37,7 +108,7 @@ func CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, order)
 }
 
-func GetOrder(c *gin.Context) {
+func (h *Handler) GetOrder(c *gin.Context) {
 	orderID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(orderID)
 	if err != nil {
@@ -45,7 +116,7 @@ func GetOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := repositories.GetOrderByID(objID)
+	order, err := h.store.GetOrderByID(c.Request.Context(), objID)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
@@ -54,7 +125,14 @@ func GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
-func UpdateOrder(c *gin.Context) {
+// readOnlyOrderFields are the fields of an order that are ignored when a client sends them back in an update
+var readOnlyOrderFields = map[string]bool{
+	"id": true, "_id": true, "venue_id": true, "menu_id": true, "menu_version": true, "number": true, "business_day": true,
+	"table_id": true, "table_name": true, "zone": true, "table_signature": true, "total": true, "timestamp": true,
+	"status_history": true, "stock": true, "deleted_at": true,
+}
+
+func (h *Handler) UpdateOrder(c *gin.Context) {
 	orderID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(orderID)
 	if err != nil {
@@ -68,17 +146,96 @@ func UpdateOrder(c *gin.Context) {
 		return
 	}
 
-	if items, exists := updates["items"]; exists {
-		// Calculate new total if items are updated
-		updates["total"] = calculateTotal(items.([]models.OrderItem))
+	// Only the status and items can change. The rest of an order, sent back as it was read, is left alone: the
+	// history is only ever appended to by status transitions, prices and the menu version only ever come from the
+	// menu and numbers from the venue's counter, tables only from a signed QR code, stock only from paying.
+	for field := range updates {
+		if field == "status" || field == "items" {
+			continue
+		}
+		if !readOnlyOrderFields[field] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order field " + field + " can't be updated"})
+			return
+		}
+		delete(updates, field)
 	}
 
-	_, err = db.DB.Collection(db.CollectionNameOrders).UpdateOne(context.Background(), bson.M{"_id": objID}, bson.M{"$set": updates})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Either one is written on its own, so a status change can't go through while the items it came with are refused
+	_, hasStatus := updates["status"]
+	_, hasItems := updates["items"]
+	if hasStatus && hasItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order status and items can't be updated together"})
 		return
 	}
 
+	if status, exists := updates["status"]; exists {
+		delete(updates, "status")
+
+		to, ok := status.(string)
+		if !ok || !models.OrderStatus(to).IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order status"})
+			return
+		}
+
+		_, err = h.store.TransitionOrder(c.Request.Context(), objID, models.OrderStatus(to), models.OrderTriggerAPI, "")
+		if errors.Is(err, repositories.ErrIllegalTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, repositories.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if items, exists := updates["items"]; exists {
+		order, err := h.store.GetOrderByID(c.Request.Context(), objID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		if !order.Status.IsUnpaid() {
+			c.JSON(http.StatusConflict, gin.H{"error": repositories.ErrOrderPaid.Error()})
+			return
+		}
+
+		var requested []models.OrderItem
+		if err := remarshal(items, &requested); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid items"})
+			return
+		}
+
+		venue, err := h.store.GetVenueByID(c.Request.Context(), order.VenueID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		priced, menuVersion, err := h.priceOrderItems(c.Request.Context(), venue, order.MenuID, requested)
+		if orderItemsError(c, err) {
+			return
+		}
+
+		// The order can be paid for while it's repriced, the store only writes the items if it hasn't been
+		err = h.store.UpdateOrderItems(c.Request.Context(), objID, priced, calculateTotal(priced), menuVersion)
+		if errors.Is(err, repositories.ErrOrderPaid) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, repositories.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "order updated"})
 }
 
@@ -99,7 +256,7 @@ func UpdateOrder(c *gin.Context) {
 // 	c.JSON(http.StatusOK, gin.H{"message": "order deleted"})
 // }
 
-func SoftDeleteOrder(c *gin.Context) {
+func (h *Handler) SoftDeleteOrder(c *gin.Context) {
 	orderID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(orderID)
 	if err != nil {
@@ -107,11 +264,7 @@ func SoftDeleteOrder(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())},
-	}
-
-	_, err = db.DB.Collection("orders").UpdateOne(context.Background(), bson.M{"_id": objID}, update)
+	err = h.store.SoftDeleteOrder(c.Request.Context(), objID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -120,32 +273,166 @@ func SoftDeleteOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "order soft deleted"})
 }
 
-func GetAllOrders(c *gin.Context) {
-	var orders []models.Order
-	cursor, err := db.DB.Collection(db.CollectionNameOrders).Find(context.Background(), bson.M{})
+func (h *Handler) GetAllOrders(c *gin.Context) {
+	orders, err := h.store.GetAllOrders(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(context.Background())
-
-	for cursor.Next(context.Background()) {
-		var order models.Order
-		if err := cursor.Decode(&order); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		orders = append(orders, order)
-	}
 
 	c.JSON(http.StatusOK, orders)
 }
 
-func calculateTotal(items []models.OrderItem) float64 {
-	var total float64
+func calculateTotal(items []models.OrderItem) models.Money {
+	var total models.Money
 	// Calculation logic based on items
 	for _, item := range items {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Times(item.Quantity))
 	}
 	return total
 }
+
+// takingOrders responds with why the venue doesn't take orders right now, if it doesn't
+func takingOrders(c *gin.Context, venue models.Venue) bool {
+	status, err := venue.OpeningStatusAt(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := venue.CheckOrdering(status); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "next_open": status.NextOpen})
+		return false
+	}
+	return true
+}
+
+var errInvalidOrderItems = errors.New("invalid order items")
+
+// priceOrderItems looks up every item on the venue's menu and snapshots its current name, modifiers and price,
+// so what the guest pays never comes from the request. It also returns the version of the menu it priced them from.
+// The menu has to be served at the time, and a *soldOutError lists the items that are sold out.
+func (h *Handler) priceOrderItems(ctx context.Context, venue models.Venue, menuID primitive.ObjectID, items []models.OrderItem) ([]models.OrderItem, int, error) {
+	if len(items) == 0 {
+		return nil, 0, fmt.Errorf("%w: order has no items", errInvalidOrderItems)
+	}
+
+	menu, err := h.store.GetMenuByID(ctx, menuID)
+	if errors.Is(err, repositories.ErrMenuNotFound) {
+		return nil, 0, fmt.Errorf("%w: menu not found", errInvalidOrderItems)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if menu.DeletedAt != nil || menu.VenueID != venue.ID {
+		return nil, 0, fmt.Errorf("%w: menu not found for this venue", errInvalidOrderItems)
+	}
+	location, err := venue.TimeLocation()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !menu.ServedAt(time.Now().In(location)) {
+		return nil, 0, fmt.Errorf("%w: %s isn't served at this time", errInvalidOrderItems, menu.Name)
+	}
+
+	menuItems := map[primitive.ObjectID]models.MenuItemV2{}
+	for _, item := range menu.Items {
+		menuItems[item.ID] = item
+	}
+
+	soldOut := &soldOutError{}
+	ordered := map[primitive.ObjectID]int{}
+	priced := make([]models.OrderItem, 0, len(items))
+	for _, item := range items {
+		menuItem, found := menuItems[item.MenuItemID]
+		availability := menuItem.AvailabilityAt(time.Now())
+		if !found || menuItem.DeletedAt != nil || availability == models.ItemHidden {
+			return nil, 0, fmt.Errorf("%w: item %s is not on the menu", errInvalidOrderItems, item.MenuItemID.Hex())
+		}
+		if item.Quantity <= 0 {
+			return nil, 0, fmt.Errorf("%w: quantity for %s must be positive", errInvalidOrderItems, menuItem.Name)
+		}
+		ordered[menuItem.ID] += item.Quantity
+		if availability == models.ItemSoldOut || (menuItem.Counted() && ordered[menuItem.ID] > *menuItem.Stock) {
+			soldOut.add(menuItem)
+			continue
+		}
+		if len(priced) > 0 && !priced[0].Price.SameCurrency(menuItem.Price) {
+			return nil, 0, fmt.Errorf("%w: items in different currencies can't be ordered together", errInvalidOrderItems)
+		}
+
+		modifiers, err := menuItem.SelectModifiers(item.Modifiers)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s", errInvalidOrderItems, err)
+		}
+		price := menuItem.Price
+		for _, modifier := range modifiers {
+			price = price.Add(modifier.PriceDelta)
+		}
+		if price.IsNegative() {
+			return nil, 0, fmt.Errorf("%w: modifiers make %s cost less than nothing", errInvalidOrderItems, menuItem.Name)
+		}
+
+		priced = append(priced, models.OrderItem{
+			MenuItemID: menuItem.ID,
+			Name:       menuItem.Name,
+			Price:      price,
+			Quantity:   item.Quantity,
+			Modifiers:  modifiers,
+		})
+	}
+
+	if len(soldOut.Items) > 0 {
+		return nil, 0, soldOut
+	}
+
+	return priced, menu.Version, nil
+}
+
+// soldOutError lists the ordered items that are sold out or don't have enough left, for the guest to change the order
+type soldOutError struct {
+	Items []primitive.ObjectID
+	names []string
+}
+
+func (e *soldOutError) add(item models.MenuItemV2) {
+	for _, itemID := range e.Items {
+		if itemID == item.ID {
+			return
+		}
+	}
+	e.Items = append(e.Items, item.ID)
+	if item.Counted() && *item.Stock > 0 {
+		e.names = append(e.names, fmt.Sprintf("%s (%d left)", item.Name, *item.Stock))
+	} else {
+		e.names = append(e.names, item.Name)
+	}
+}
+
+func (e *soldOutError) Error() string {
+	return strings.Join(e.names, ", ") + " sold out"
+}
+
+// orderItemsError responds to what priceOrderItems returned, true when there was an error
+func orderItemsError(c *gin.Context, err error) bool {
+	var soldOut *soldOutError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &soldOut):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "sold_out": soldOut.Items})
+	case errors.Is(err, errInvalidOrderItems):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+// remarshal converts a loosely decoded JSON value into a typed one
+func remarshal(in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
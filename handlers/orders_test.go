@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func orderBody(venue models.Venue, menu models.MenuV2, quantities ...int) map[string]interface{} {
+	items := []map[string]interface{}{}
+	for i, quantity := range quantities {
+		// The price sent along is ignored, it always comes from the menu
+		items = append(items, map[string]interface{}{"menu_item_id": menu.Items[i].ID, "quantity": quantity, "price": 0.01})
+	}
+	return map[string]interface{}{"venue_id": venue.ID, "menu_id": menu.ID, "items": items}
+}
+
+func TestCreateOrderPricesFromMenu(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 2, 1)), http.StatusCreated, &order)
+
+	if order.Total != models.NewMoney(2800, "EUR") {
+		t.Fatalf("expected a total of 28.00, got %s", order.Total)
+	}
+	if order.Status != models.OrderStatusAwaitingPayment || order.Number != 1 || order.BusinessDay == "" {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if len(order.StatusHistory) != 1 || order.StatusHistory[0].Trigger != models.OrderTriggerCreated || order.StatusHistory[0].Actor != "" {
+		t.Fatalf("unexpected status history %+v", order.StatusHistory)
+	}
+
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	if order.Number != 2 {
+		t.Fatalf("expected the second order of the day to be number 2, got %d", order.Number)
+	}
+
+	events, err := s.store.GetOrderEventsAfter(context.Background(), venue.ID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Type != models.OrderEventCreated {
+		t.Fatalf("expected two created events on the feed, got %+v", events)
+	}
+}
+
+func TestCreateOrderRejectsInvalidItems(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu)), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 0)), http.StatusBadRequest, nil)
+
+	unknown := orderBody(venue, menu, 1)
+	unknown["items"] = []map[string]interface{}{{"menu_item_id": primitive.NewObjectID(), "quantity": 1}}
+	s.expect(s.do(http.MethodPost, "/orders/", unknown), http.StatusBadRequest, nil)
+
+	otherVenue := orderBody(venue, menu, 1)
+	otherVenue["venue_id"] = primitive.NewObjectID()
+	s.expect(s.do(http.MethodPost, "/orders/", otherVenue), http.StatusBadRequest, nil)
+
+	paid := orderBody(venue, menu, 1)
+	paid["status"] = models.OrderStatusPaid
+	s.expect(s.do(http.MethodPost, "/orders/", paid), http.StatusBadRequest, nil)
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	path := "/orders/" + order.ID.Hex()
+
+	// Staff can't skip paying, or make up a total
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": models.OrderStatusServed}), http.StatusConflict, nil)
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": "eaten"}), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"total": 0}), http.StatusOK, nil)
+	for _, update := range []map[string]interface{}{
+		{"items.0.price.amount": 1},
+		{"total.amount": 1},
+		{"$set": map[string]interface{}{"total": 0}},
+		{"note": "no onions"},
+	} {
+		s.expect(s.do(http.MethodPut, path, update), http.StatusBadRequest, nil)
+	}
+
+	// Only Stripe can say the order is paid or refunded
+	for _, status := range []models.OrderStatus{models.OrderStatusPaid, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded} {
+		s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": status}), http.StatusConflict, nil)
+	}
+	s.linkStripeAccount(venue)
+	if _, err := s.stripe.Pay(s.checkout(order)); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &order)
+	if order.Status != models.OrderStatusPaid || order.Total != models.NewMoney(1250, "EUR") {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if len(order.StatusHistory) != 2 || order.StatusHistory[1].From != models.OrderStatusAwaitingPayment || order.StatusHistory[1].Trigger != models.OrderTriggerStripe {
+		t.Fatalf("unexpected status history %+v", order.StatusHistory)
+	}
+
+	// Items are fixed once the order is paid, also when it's paid for while they're repriced
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"items": orderBody(venue, menu, 3)["items"]}), http.StatusConflict, nil)
+	err := s.store.UpdateOrderItems(context.Background(), order.ID, nil, models.NewMoney(0, "EUR"), menu.Version)
+	if !errors.Is(err, repositories.ErrOrderPaid) {
+		t.Fatalf("expected the paid order's items to stay, got %v", err)
+	}
+
+	var open []models.Order
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/orders/?status=paid", nil), http.StatusOK, &open)
+	if len(open) != 1 || open[0].ID != order.ID {
+		t.Fatalf("expected the paid order, got %+v", open)
+	}
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/orders/?status=ready", nil), http.StatusOK, &open)
+	if len(open) != 0 {
+		t.Fatalf("expected no ready orders, got %+v", open)
+	}
+}
+
+func TestUpdateOrderItemsRepricesOrder(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+	path := "/orders/" + order.ID.Hex()
+
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"items": orderBody(venue, menu, 1, 2)["items"]}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &order)
+	if order.Total != models.NewMoney(1850, "EUR") || len(order.Items) != 2 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	// Neither is written when both are sent
+	both := map[string]interface{}{"status": models.OrderStatusCancelled, "items": orderBody(venue, menu, 3)["items"]}
+	s.expect(s.do(http.MethodPut, path, both), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &order)
+	if order.Status == models.OrderStatusCancelled || order.Total != models.NewMoney(1850, "EUR") {
+		t.Fatalf("expected the order unchanged, got %+v", order)
+	}
+}
+
+func TestOrderNotFound(t *testing.T) {
+	s := newTestServer(t)
+
+	path := "/orders/" + primitive.NewObjectID().Hex()
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"status": models.OrderStatusPaid}), http.StatusNotFound, nil)
+}
+
+// seedModifiers adds a menu with a pizza that needs a size and can have up to two extras
+func (s *testServer) seedModifiers(venue models.Venue) models.MenuV2 {
+	s.t.Helper()
+
+	pizza := models.MenuItemV2{
+		ID:    primitive.NewObjectID(),
+		Name:  "Pizza",
+		Price: models.NewMoney(1250, "EUR"),
+		ModifierGroups: []models.ModifierGroup{
+			{Name: "Size", MinSelections: 1, MaxSelections: 1, Options: []models.ModifierOption{
+				{Name: "Small", PriceDelta: models.NewMoney(-200, "EUR")},
+				{Name: "Large", PriceDelta: models.NewMoney(300, "EUR")},
+			}},
+			{Name: "Extras", MaxSelections: 2, Options: []models.ModifierOption{
+				{Name: "Cheese", PriceDelta: models.NewMoney(150, "EUR")},
+				{Name: "Olives", PriceDelta: models.NewMoney(100, "EUR")},
+				{Name: "Basil", PriceDelta: models.NewMoney(50, "EUR")},
+			}},
+		},
+	}
+	if err := pizza.PrepareModifierGroups(); err != nil {
+		s.t.Fatal(err)
+	}
+
+	menu := models.MenuV2{ID: primitive.NewObjectID(), Name: "Pizzas", VenueID: venue.ID, Items: []models.MenuItemV2{pizza}}
+	if _, err := s.store.CreateMenu(context.Background(), menu); err != nil {
+		s.t.Fatal(err)
+	}
+	return menu
+}
+
+// modifierOrder orders one pizza with the given options, each one a group and option index
+func modifierOrder(venue models.Venue, menu models.MenuV2, options ...[2]int) map[string]interface{} {
+	pizza := menu.Items[0]
+	modifiers := []map[string]interface{}{}
+	for _, option := range options {
+		group := pizza.ModifierGroups[option[0]]
+		modifiers = append(modifiers, map[string]interface{}{"group_id": group.ID, "option_id": group.Options[option[1]].ID, "price_delta": 0})
+	}
+	items := []map[string]interface{}{{"menu_item_id": pizza.ID, "quantity": 2, "modifiers": modifiers}}
+	return map[string]interface{}{"venue_id": venue.ID, "menu_id": menu.ID, "items": items}
+}
+
+func TestOrderModifiersValidated(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+	menu := s.seedModifiers(venue)
+
+	for _, test := range []struct {
+		name    string
+		options [][2]int
+	}{
+		{"no size", [][2]int{{1, 0}}},
+		{"two sizes", [][2]int{{0, 0}, {0, 1}}},
+		{"three extras", [][2]int{{0, 0}, {1, 0}, {1, 1}, {1, 2}}},
+		{"the same extra twice", [][2]int{{0, 0}, {1, 0}, {1, 0}}},
+	} {
+		rec := s.do(http.MethodPost, "/orders/", modifierOrder(venue, menu, test.options...))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d: %s", test.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Options have to be part of the group they're sent for, and groups part of the item
+	pizza := menu.Items[0]
+	size := pizza.ModifierGroups[0]
+	for _, modifier := range []map[string]interface{}{
+		{"group_id": size.ID, "option_id": primitive.NewObjectID()},
+		{"group_id": size.ID, "option_id": pizza.ModifierGroups[1].Options[0].ID},
+		{"group_id": primitive.NewObjectID(), "option_id": size.Options[0].ID},
+	} {
+		body := modifierOrder(venue, menu, [2]int{0, 0})
+		items := body["items"].([]map[string]interface{})
+		items[0]["modifiers"] = append(items[0]["modifiers"].([]map[string]interface{}), modifier)
+		s.expect(s.do(http.MethodPost, "/orders/", body), http.StatusBadRequest, nil)
+	}
+}
+
+func TestOrderModifiersPriced(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+	menu := s.seedModifiers(venue)
+	s.linkStripeAccount(venue)
+
+	// A large pizza with cheese and olives is 12.50 + 3.00 + 1.50 + 1.00, whatever the client says the deltas are
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", modifierOrder(venue, menu, [2]int{1, 1}, [2]int{0, 1}, [2]int{1, 0})), http.StatusCreated, &order)
+	if order.Total != models.NewMoney(3600, "EUR") || order.Items[0].Price != models.NewMoney(1800, "EUR") {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	modifiers := order.Items[0].Modifiers
+	if len(modifiers) != 3 || modifiers[0].Name != "Large" || modifiers[1].Name != "Cheese" || modifiers[2].Name != "Olives" {
+		t.Fatalf("expected the modifiers in menu order, got %+v", modifiers)
+	}
+
+	// Deltas can take off the price too
+	var small models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", modifierOrder(venue, menu, [2]int{0, 0})), http.StatusCreated, &small)
+	if small.Total != models.NewMoney(2100, "EUR") {
+		t.Fatalf("expected a total of 21.00, got %s", small.Total)
+	}
+
+	session, err := s.stripe.Session(s.checkout(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.AmountTotal != 3600 || len(session.LineItems.Data) != 1 {
+		t.Fatalf("unexpected checkout session %+v", session)
+	}
+	line := session.LineItems.Data[0]
+	if line.Price.UnitAmount != 1800 || line.Quantity != 2 || line.Price.Product.Name != "Pizza" || line.Price.Product.Description != "Large, Cheese, Olives" {
+		t.Fatalf("unexpected line item %+v %+v", line, line.Price.Product)
+	}
+}
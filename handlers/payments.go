@@ -1,18 +1,17 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"net/http"
 	"time"
 
-	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func CreatePayment(c *gin.Context) {
+func (h *Handler) CreatePayment(c *gin.Context) {
 	var payment models.Payment
 	if err := c.ShouldBindJSON(&payment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -22,7 +21,7 @@ func CreatePayment(c *gin.Context) {
 	payment.ID = primitive.NewObjectID()                          // Generate a new ID for the payment
 	payment.Timestamp = primitive.NewDateTimeFromTime(time.Now()) // Set the current timestamp
 
-	_, err := db.DB.Collection("payments").InsertOne(context.Background(), payment)
+	err := h.store.CreatePayment(c.Request.Context(), payment)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -31,7 +30,7 @@ func CreatePayment(c *gin.Context) {
 	c.JSON(http.StatusCreated, payment)
 }
 
-func GetPayment(c *gin.Context) {
+func (h *Handler) GetPayment(c *gin.Context) {
 	paymentID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(paymentID)
 	if err != nil {
@@ -39,9 +38,8 @@ func GetPayment(c *gin.Context) {
 		return
 	}
 
-	var payment models.Payment
-	filter := bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}
-	if err := db.DB.Collection("payments").FindOne(context.Background(), filter).Decode(&payment); err != nil {
+	payment, err := h.store.GetPaymentByID(c.Request.Context(), objID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
 		return
 	}
@@ -49,7 +47,7 @@ func GetPayment(c *gin.Context) {
 	c.JSON(http.StatusOK, payment)
 }
 
-func UpdatePayment(c *gin.Context) {
+func (h *Handler) UpdatePayment(c *gin.Context) {
 	paymentID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(paymentID)
 	if err != nil {
@@ -57,13 +55,17 @@ func UpdatePayment(c *gin.Context) {
 		return
 	}
 
-	var updates bson.M
+	var updates repositories.Fields
 	if err := c.ShouldBindJSON(&updates); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = db.DB.Collection("payments").UpdateOne(context.Background(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}, bson.M{"$set": updates})
+	err = h.store.UpdatePayment(c.Request.Context(), objID, updates)
+	if errors.Is(err, repositories.ErrPaymentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -72,7 +74,7 @@ func UpdatePayment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "payment updated"})
 }
 
-func SoftDeletePayment(c *gin.Context) {
+func (h *Handler) SoftDeletePayment(c *gin.Context) {
 	paymentID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(paymentID)
 	if err != nil {
@@ -80,11 +82,7 @@ func SoftDeletePayment(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())},
-	}
-
-	_, err = db.DB.Collection("payments").UpdateOne(context.Background(), bson.M{"_id": objID}, update)
+	err = h.store.SoftDeletePayment(c.Request.Context(), objID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -93,24 +91,12 @@ func SoftDeletePayment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "payment soft deleted"})
 }
 
-func GetAllPayments(c *gin.Context) {
-	var payments []models.Payment
-	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
-	cursor, err := db.DB.Collection("payments").Find(context.Background(), filter)
+func (h *Handler) GetAllPayments(c *gin.Context) {
+	payments, err := h.store.GetAllPayments(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(context.Background())
-
-	for cursor.Next(context.Background()) {
-		var payment models.Payment
-		if err := cursor.Decode(&payment); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		payments = append(payments, payment)
-	}
 
 	c.JSON(http.StatusOK, payments)
 }
@@ -5,24 +5,25 @@ import (
 	"os"
 	"strings"
 
-	"github.com/SaplingPay/server/payments"
-
 	"github.com/SaplingPay/server/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func SetUpRoutes(r *gin.Engine) {
+func SetUpRoutes(r *gin.Engine, h *Handler) {
 	// Set up the routes that require authentication
 	//SetUpAuthRoutes(r)
 
 	r.POST("/getToken", middleware.GetToken)
 
+	// Stripe authenticates itself with the webhook signature
+	r.POST("/payments/webhook", h.payments.HandleWebhook)
+
 	// Wrap the routes that require authentication in the AuthMiddleware
 	r.Use(middleware.AuthMiddleware())
 
-	payments.AddStripRoutes(r)
+	h.payments.AddStripRoutes(r)
 
-	menuRoutes := r.Group("/menus")
+	menuRoutes := r.Group("/menus", h.legacyMenuRoutes())
 	{
 		menuRoutes.GET("/", GetAllMenus)
 		menuRoutes.POST("/", CreateMenu)
@@ -42,77 +43,116 @@ func SetUpRoutes(r *gin.Engine) {
 		}
 	}
 
-	venueRoutes := r.Group("/venues")
+	r.GET("/search", h.Search)
+
+	venueRoutes := r.Group("/venues", h.searchIndex.trackChanges())
 	{
-		venueRoutes.GET("/", GetAllVenues)
-		venueRoutes.POST("/", CreateVenue)
-		venueRoutes.GET("/:venueId", GetVenue)
-		venueRoutes.PUT("/:venueId", UpdateVenue)
-		venueRoutes.DELETE("/:venueId", SoftDeleteVenue)
+		venueRoutes.GET("/", h.GetAllVenues)
+		venueRoutes.POST("/", h.CreateVenue)
+		venueRoutes.GET("/nearby", h.GetNearbyVenues)
+		venueRoutes.GET("/:venueId", h.GetVenue)
+		venueRoutes.PUT("/:venueId", h.UpdateVenue)
+		venueRoutes.DELETE("/:venueId", h.SoftDeleteVenue)
+		venueRoutes.PUT("/:venueId/hours", h.SetOpeningHours)
+		venueRoutes.DELETE("/:venueId/hours", h.DeleteOpeningHours)
 
 		venueMenuRoutes := venueRoutes.Group("/:venueId/menu")
 		{
-			venueMenuRoutes.POST("/", CreateMenuV2)
-			venueMenuRoutes.POST("/parse/", ParseMenuCard)
-			venueMenuRoutes.GET("/:menuId", GetMenuV2)
-			venueMenuRoutes.PUT("/:menuId", UpdateMenuV2)
-			venueMenuRoutes.DELETE("/:menuId", SoftDeleteMenuV2)
+			venueMenuRoutes.POST("/", h.CreateMenuV2)
+			venueMenuRoutes.POST("/parse/", h.ParseMenuCard)
+			venueMenuRoutes.GET("/parse/:jobId", h.GetParseJob)
+			venueMenuRoutes.DELETE("/parse/:jobId", h.CancelParseJob)
+			venueMenuRoutes.GET("/drafts/", h.GetMenuDrafts)
+			venueMenuRoutes.GET("/drafts/:draftId", h.GetMenuDraft)
+			venueMenuRoutes.PUT("/drafts/:draftId", h.UpdateMenuDraft)
+			venueMenuRoutes.DELETE("/drafts/:draftId", h.DiscardMenuDraft)
+			venueMenuRoutes.POST("/drafts/:draftId/publish", h.PublishMenuDraft)
+			venueMenuRoutes.PUT("/drafts/:draftId/items/:itemId", h.UpdateMenuDraftItem)
+			venueMenuRoutes.DELETE("/drafts/:draftId/items/:itemId", h.DeleteMenuDraftItem)
+			venueMenuRoutes.GET("/:menuId", h.GetMenuV2)
+			venueMenuRoutes.PUT("/:menuId", h.UpdateMenuV2)
+			venueMenuRoutes.DELETE("/:menuId", h.SoftDeleteMenuV2)
+			venueMenuRoutes.GET("/:menuId/versions/", h.GetMenuVersions)
+			venueMenuRoutes.GET("/:menuId/versions/:version", h.GetMenuVersion)
+			venueMenuRoutes.POST("/:menuId/versions/:version/rollback", h.RollbackMenu)
+			venueMenuRoutes.GET("/:menuId/diff", h.DiffMenuVersions)
+			venueMenuRoutes.PUT("/:menuId/schedule", h.SetMenuSchedule)
+			venueMenuRoutes.DELETE("/:menuId/schedule", h.DeleteMenuSchedule)
 		}
 		// get all menus for a venue
 		venueMenusRoutes := venueRoutes.Group("/:venueId/menus")
 		{
-			venueMenusRoutes.GET("/", GetMenusByVenueID)
+			venueMenusRoutes.GET("/", h.GetMenusByVenueID)
+			venueMenusRoutes.GET("/active", h.GetActiveMenus)
+		}
+
+		venueTableRoutes := venueRoutes.Group("/:venueId/tables")
+		{
+			venueTableRoutes.POST("/", h.CreateTable)
+			venueTableRoutes.GET("/", h.GetTables)
+			venueTableRoutes.GET("/:tableId", h.GetTable)
+			venueTableRoutes.PUT("/:tableId", h.UpdateTable)
+			venueTableRoutes.DELETE("/:tableId", h.SoftDeleteTable)
+			venueTableRoutes.GET("/:tableId/qr", h.GetTableQRCode)
+		}
+
+		venueOrderRoutes := venueRoutes.Group("/:venueId/orders")
+		{
+			venueOrderRoutes.GET("/", h.GetOrdersByVenueID)
+			venueOrderRoutes.GET("/stream", h.StreamVenueOrders)
 		}
 
 		venueMenuItemRoutes := venueRoutes.Group("/:venueId/menu/:menuId/items")
 		{
-			venueMenuItemRoutes.POST("/", CreateMenuItemV2)
-			venueMenuItemRoutes.GET("/", GetAllMenuItemsV2)
-			venueMenuItemRoutes.GET("/:itemId", GetMenuItemV2)
-			venueMenuItemRoutes.PUT("/:itemId", UpdateMenuItemV2)
-			venueMenuItemRoutes.DELETE("/:itemId", SoftDeleteMenuItemV2)
+			venueMenuItemRoutes.POST("/", h.CreateMenuItemV2)
+			venueMenuItemRoutes.GET("/", h.GetAllMenuItemsV2)
+			venueMenuItemRoutes.GET("/:itemId", h.GetMenuItemV2)
+			venueMenuItemRoutes.PUT("/:itemId", h.UpdateMenuItemV2)
+			venueMenuItemRoutes.DELETE("/:itemId", h.SoftDeleteMenuItemV2)
+			venueMenuItemRoutes.PUT("/:itemId/availability", h.SetItemAvailability)
+			venueMenuItemRoutes.PUT("/:itemId/stock", h.SetItemStock)
 		}
 	}
 
-	userRoutes := r.Group("/users")
+	userRoutes := r.Group("/users", h.legacyUserRoutes())
 	{
 		userRoutes.POST("/", CreateUser)
 		userRoutes.GET("/", GetAllUsers)
 		userRoutes.GET("/:userId", GetUser)
 		userRoutes.PUT("/:userId", UpdateUser)
 		userRoutes.DELETE("/:userId", DeleteUser)
-		userRoutes.GET("/:userId/saves", GetUserSaves)
+		userRoutes.GET("/:userId/saves", h.GetUserSaves)
 	}
 
 	userV2Routes := r.Group("/usersV2")
 	{
-		userV2Routes.POST("/", CreateUserV2)
-		userV2Routes.GET("/", GetAllUsersV2)
-		userV2Routes.GET("/:userId", GetUserV2)
-		userV2Routes.PUT("/:userId", UpdateUserV2)
-		userV2Routes.DELETE("/:userId", SoftDeleteUserV2)
-		userV2Routes.PUT("/:userId/follow/:followingId", FollowUser)
-		userV2Routes.PUT("/:userId/unfollow/:followingId", UnFollowUser)
+		userV2Routes.POST("/", h.CreateUserV2)
+		userV2Routes.GET("/", h.GetAllUsersV2)
+		userV2Routes.GET("/:userId", h.GetUserV2)
+		userV2Routes.PUT("/:userId", h.UpdateUserV2)
+		userV2Routes.DELETE("/:userId", h.SoftDeleteUserV2)
+		userV2Routes.PUT("/:userId/follow/:followingId", h.FollowUser)
+		userV2Routes.PUT("/:userId/unfollow/:followingId", h.UnFollowUser)
 	}
 
 	r.GET("/GetMenusByUserID/:userId", GetMenuByUserID)
 
 	orders := r.Group("/orders")
 	{
-		orders.POST("/", CreateOrder)
-		orders.GET("/:id", GetOrder)
-		orders.PUT("/:id", UpdateOrder)
-		orders.DELETE("/:id", SoftDeleteOrder)
-		orders.GET("/", GetAllOrders)
+		orders.POST("/", h.CreateOrder)
+		orders.GET("/:id", h.GetOrder)
+		orders.PUT("/:id", h.UpdateOrder)
+		orders.DELETE("/:id", h.SoftDeleteOrder)
+		orders.GET("/", h.GetAllOrders)
 	}
 
 	payments := r.Group("/payments")
 	{
-		payments.POST("/", CreatePayment)
-		payments.GET("/:id", GetPayment)
-		payments.PUT("/:id", UpdatePayment)
-		payments.DELETE("/:id", SoftDeletePayment)
-		payments.GET("/", GetAllPayments)
+		payments.POST("/", h.CreatePayment)
+		payments.GET("/:id", h.GetPayment)
+		payments.PUT("/:id", h.UpdatePayment)
+		payments.DELETE("/:id", h.SoftDeletePayment)
+		payments.GET("/", h.GetAllPayments)
 	}
 }
 
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/search"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultSearchLimit = 20
+const maxSearchLimit = 50
+
+// Search result types, the same as a user's saves
+const (
+	searchResultVenue    = "venue"
+	searchResultMenuItem = "menu_item"
+)
+
+// How much a match in each part of a venue or item counts for
+const (
+	weightName        = 1.0
+	weightCategory    = 0.7
+	weightDietaryTag  = 0.7
+	weightVenueName   = 0.5
+	weightCity        = 0.4
+	weightDescription = 0.4
+	weightMenuName    = 0.3
+	weightAddress     = 0.3
+)
+
+// SearchResult is a venue or a menu item that matched the search, with the venue and menu it's on
+type SearchResult struct {
+	Type          string             `json:"type"` // venue or menu_item
+	Score         float64            `json:"score"`
+	VenueID       primitive.ObjectID `json:"venue_id"`
+	MenuID        primitive.ObjectID `json:"menu_id"`
+	MenuItemID    primitive.ObjectID `json:"menu_item_id"`
+	Name          string             `json:"name"`
+	VenueName     string             `json:"venue_name"`
+	ProfilePicURL string             `json:"profile_pic_url"`
+	Location      models.Location    `json:"location"`
+	MenuName      string             `json:"menu_name,omitempty"`
+	Item          *models.MenuItemV2 `json:"item,omitempty"`
+	Distance      *float64           `json:"distance,omitempty"` // meters, when searching around a point
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+// searchFilters narrow the search down, the zero value lets everything through
+type searchFilters struct {
+	dietaryTags      []string
+	withoutAllergens []models.Allergen
+	point            *models.GeoPoint
+	radius           float64
+}
+
+// Search finds venues and menu items by name, category, dietary tag and the like, best match first. Typos are
+// forgiven. Items can be narrowed down to ones with dietary tags or without allergens, which narrows venues down to
+// the ones serving such items, and results to lat and lng and the radius around them. The search index picks the
+// venues to look at, their menus are loaded as they are now.
+func (h *Handler) Search(c *gin.Context) {
+	log.Println("Search")
+
+	query := search.NewQuery(c.Query("q"))
+	if query.Empty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	resultType := c.Query("type")
+	if resultType != "" && resultType != searchResultVenue && resultType != searchResultMenuItem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be venue or menu_item"})
+		return
+	}
+
+	limit, ok := limitParam(c, defaultSearchLimit, maxSearchLimit)
+	if !ok {
+		return
+	}
+	filters, ok := searchFilterParams(c)
+	if !ok {
+		return
+	}
+
+	venueIDs, err := h.searchIndex.candidateVenues(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	venues, err := h.store.GetVenuesByIDs(c.Request.Context(), venueIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	menus, err := h.store.GetMenusByVenueIDs(c.Request.Context(), venueIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	venuesByID := map[primitive.ObjectID]models.Venue{}
+	distances := map[primitive.ObjectID]*float64{}
+	for _, venue := range venues {
+		if filters.point != nil {
+			if venue.Location.Point == nil {
+				continue
+			}
+			distance := filters.point.DistanceTo(*venue.Location.Point)
+			if distance > filters.radius {
+				continue
+			}
+			distances[venue.ID] = &distance
+		}
+		venuesByID[venue.ID] = venue
+	}
+
+	results := []SearchResult{}
+	serving := map[primitive.ObjectID]bool{} // venues with items that pass the filters
+	now := time.Now()
+	for _, menu := range menus {
+		venue, ok := venuesByID[menu.VenueID]
+		if !ok {
+			continue
+		}
+		for _, item := range menu.Items {
+			if item.DeletedAt != nil || item.AvailabilityAt(now) == models.ItemHidden || !filters.allow(item) {
+				continue
+			}
+			serving[venue.ID] = true
+			if resultType == searchResultVenue {
+				continue
+			}
+
+			score := query.Score(itemSearchFields(item, menu, venue)...)
+			if score == 0 {
+				continue
+			}
+
+			item := item
+			item.Restock(now)
+			result := venueSearchResult(venue, searchResultMenuItem, score, distances[venue.ID])
+			result.MenuID = menu.ID
+			result.MenuItemID = item.ID
+			result.Name = item.Name
+			result.MenuName = menu.Name
+			result.Item = &item
+			results = append(results, result)
+		}
+	}
+
+	if resultType != searchResultMenuItem {
+		for _, venue := range venuesByID {
+			if filters.narrowsItems() && !serving[venue.ID] {
+				continue
+			}
+
+			score := query.Score(venueSearchFields(venue)...)
+			if score > 0 {
+				results = append(results, venueSearchResult(venue, searchResultVenue, score, distances[venue.ID]))
+			}
+		}
+	}
+
+	// Best match first, then nearest, then venues before their items
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Distance != nil && b.Distance != nil && *a.Distance != *b.Distance:
+			return *a.Distance < *b.Distance
+		case a.Type != b.Type:
+			return a.Type == searchResultVenue
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.VenueID != b.VenueID:
+			return a.VenueID.Hex() < b.VenueID.Hex()
+		}
+		return a.MenuItemID.Hex() < b.MenuItemID.Hex()
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	c.JSON(http.StatusOK, SearchResponse{Results: results})
+}
+
+func venueSearchFields(venue models.Venue) []search.Field {
+	return []search.Field{
+		{Text: venue.Name, Weight: weightName},
+		{Text: venue.Location.City, Weight: weightCity},
+		{Text: venue.Location.Address, Weight: weightAddress},
+	}
+}
+
+// itemSearchFields are the item's own fields, and its menu and venue as context
+func itemSearchFields(item models.MenuItemV2, menu models.MenuV2, venue models.Venue) []search.Field {
+	return []search.Field{
+		{Text: item.Name, Weight: weightName},
+		{Text: strings.Join(item.Categories, " "), Weight: weightCategory},
+		{Text: strings.Join(item.DietaryTags, " "), Weight: weightDietaryTag},
+		{Text: item.Description, Weight: weightDescription},
+		{Text: strings.Join(item.Ingredients, " "), Weight: weightDescription},
+		{Text: menu.Name, Weight: weightMenuName, Context: true},
+		{Text: venue.Name, Weight: weightVenueName, Context: true},
+		{Text: venue.Location.City, Weight: weightCity, Context: true},
+	}
+}
+
+func venueSearchResult(venue models.Venue, resultType string, score float64, distance *float64) SearchResult {
+	return SearchResult{
+		Type:          resultType,
+		Score:         score,
+		VenueID:       venue.ID,
+		Name:          venue.Name,
+		VenueName:     venue.Name,
+		ProfilePicURL: venue.ProfilePicURL,
+		Location:      venue.Location,
+		Distance:      distance,
+	}
+}
+
+func searchFilterParams(c *gin.Context) (searchFilters, bool) {
+	var filters searchFilters
+
+	for _, tag := range splitParams(c.QueryArray("dietary")) {
+		filters.dietaryTags = append(filters.dietaryTags, search.Fold(tag))
+	}
+	for _, name := range splitParams(c.QueryArray("without_allergens")) {
+		allergen, ok := models.ParseAllergen(name)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown allergen " + name})
+			return filters, false
+		}
+		filters.withoutAllergens = append(filters.withoutAllergens, allergen)
+	}
+
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		point, radius, ok := pointParams(c)
+		if !ok {
+			return filters, false
+		}
+		filters.point, filters.radius = &point, radius
+	}
+
+	return filters, true
+}
+
+// splitParams takes a query parameter given more than once as well as comma separated
+func splitParams(values []string) []string {
+	var params []string
+	for _, value := range values {
+		for _, param := range strings.Split(value, ",") {
+			if param = strings.TrimSpace(param); param != "" {
+				params = append(params, param)
+			}
+		}
+	}
+	return params
+}
+
+func (f searchFilters) narrowsItems() bool {
+	return len(f.dietaryTags) > 0 || len(f.withoutAllergens) > 0
+}
+
+// allow tells if the item has all the dietary tags and none of the allergens. Allergens are the ones the venue
+// declared, an item without any declared might contain any of them so it's left out when avoiding allergens.
+func (f searchFilters) allow(item models.MenuItemV2) bool {
+	if len(f.withoutAllergens) > 0 && len(item.Allergens) == 0 {
+		return false
+	}
+	for _, want := range f.dietaryTags {
+		found := false
+		for _, tag := range item.DietaryTags {
+			if search.Fold(tag) == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, unwanted := range f.withoutAllergens {
+		for _, allergen := range item.Allergens {
+			if allergen == unwanted {
+				return false
+			}
+		}
+	}
+	return true
+}
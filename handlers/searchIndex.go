@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/SaplingPay/server/search"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Changes to venues and menus made through this server rebuild the search index on the next search, but not more
+// often than searchIndexMinAge. Changes made through other instances show up once it's searchIndexMaxAge old.
+const (
+	searchIndexMinAge = 5 * time.Second
+	searchIndexMaxAge = time.Minute
+)
+
+// searchIndex holds the words of every venue and menu item, to find the venues a search can match without
+// loading all of them. Results come from the venues and menus as they are now, the index only picks which.
+type searchIndex struct {
+	store repositories.Store
+
+	mu      sync.Mutex
+	index   *search.Index
+	venues  []primitive.ObjectID // the venue of each indexed document
+	builtAt time.Time
+	changed bool
+}
+
+func newSearchIndex(store repositories.Store) *searchIndex {
+	return &searchIndex{store: store}
+}
+
+// candidateVenues returns the venues having themselves or a menu item the query may match
+func (s *searchIndex) candidateVenues(ctx context.Context, query search.Query) ([]primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	age := time.Since(s.builtAt)
+	if s.index == nil || age > searchIndexMaxAge || (s.changed && age > searchIndexMinAge) {
+		if err := s.build(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	venueIDs := []primitive.ObjectID{}
+	found := map[primitive.ObjectID]bool{}
+	for _, i := range s.index.Candidates(query) {
+		if venueID := s.venues[i]; !found[venueID] {
+			found[venueID] = true
+			venueIDs = append(venueIDs, venueID)
+		}
+	}
+	return venueIDs, nil
+}
+
+// build expects s.mu to be held
+func (s *searchIndex) build(ctx context.Context) error {
+	venues, err := s.store.GetAllVenues(ctx)
+	if err != nil {
+		return err
+	}
+	menus, err := s.store.GetAllMenus(ctx)
+	if err != nil {
+		return err
+	}
+
+	var documents [][]search.Field
+	var owners []primitive.ObjectID
+	venuesByID := map[primitive.ObjectID]models.Venue{}
+	for _, venue := range venues {
+		documents = append(documents, venueSearchFields(venue))
+		owners = append(owners, venue.ID)
+		venuesByID[venue.ID] = venue
+	}
+	for _, menu := range menus {
+		venue, ok := venuesByID[menu.VenueID]
+		if !ok {
+			continue
+		}
+		for _, item := range menu.Items {
+			if item.DeletedAt == nil {
+				documents = append(documents, itemSearchFields(item, menu, venue))
+				owners = append(owners, venue.ID)
+			}
+		}
+	}
+
+	s.index = search.NewIndex(documents)
+	s.venues = owners
+	s.builtAt = time.Now()
+	s.changed = false
+	return nil
+}
+
+// trackChanges has the index rebuilt after requests that changed a venue or its menus
+func (s *searchIndex) trackChanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Request.Method != http.MethodGet && c.Writer.Status() < http.StatusBadRequest {
+			s.mu.Lock()
+			s.changed = true
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *testServer) search(params url.Values) []SearchResult {
+	s.t.Helper()
+
+	var response SearchResponse
+	s.expect(s.do(http.MethodGet, "/search?"+params.Encode(), nil), http.StatusOK, &response)
+	return response.Results
+}
+
+func resultNames(results []SearchResult) []string {
+	names := []string{}
+	for _, result := range results {
+		names = append(names, result.Type+":"+result.Name)
+	}
+	return names
+}
+
+// seedBurgerBar stores a burger bar in Amsterdam next to the trattoria from seedMenu
+func (s *testServer) seedBurgerBar() (models.Venue, models.MenuV2) {
+	s.t.Helper()
+
+	location := models.Location{Address: "Damrak 1", City: "Amsterdam", Latitude: damLat, Longitude: damLng}
+	if err := location.Prepare(); err != nil {
+		s.t.Fatal(err)
+	}
+	venue, err := s.store.CreateVenue(context.Background(), models.Venue{Name: "Burger Bar", Location: location, MenuIDs: []primitive.ObjectID{}})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	menu := models.MenuV2{
+		ID:      primitive.NewObjectID(),
+		Name:    "All Day",
+		VenueID: venue.ID,
+		Items: []models.MenuItemV2{
+			{ID: primitive.NewObjectID(), Name: "Beyond Burger", Categories: []string{"Burgers"}, DietaryTags: []string{"vegan"}, Allergens: []models.Allergen{models.AllergenGluten, models.AllergenSoybeans}},
+			{ID: primitive.NewObjectID(), Name: "Cheeseburger", Categories: []string{"Burgers"}, Allergens: []models.Allergen{models.AllergenGluten, models.AllergenMilk}},
+			{ID: primitive.NewObjectID(), Name: "Crème Brûlée", Categories: []string{"Desserts"}, DietaryTags: []string{"vegetarian"}, Allergens: []models.Allergen{models.AllergenEggs, models.AllergenMilk}},
+			{ID: primitive.NewObjectID(), Name: "Secret Burger", Categories: []string{"Burgers"}, Availability: models.ItemHidden},
+		},
+	}
+	if _, err := s.store.CreateMenu(context.Background(), menu); err != nil {
+		s.t.Fatal(err)
+	}
+
+	return venue, menu
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t)
+	trattoria, _ := s.seedMenu()
+	venue, menu := s.seedBurgerBar()
+
+	// Items come with their venue and menu, hidden items are left out
+	results := s.search(url.Values{"q": {"burger"}})
+	expectNames(t, resultNames(results), "venue:Burger Bar", "menu_item:Beyond Burger", "menu_item:Cheeseburger")
+	item := results[1]
+	if item.VenueID != venue.ID || item.MenuID != menu.ID || item.MenuItemID != menu.Items[0].ID || item.VenueName != "Burger Bar" ||
+		item.MenuName != "All Day" || item.Location.City != "Amsterdam" || item.Item == nil || item.Item.DietaryTags[0] != "vegan" {
+		t.Fatalf("unexpected item result %+v", item)
+	}
+
+	// Typos and accents are forgiven, and terms can match different parts of an item
+	expectNames(t, resultNames(s.search(url.Values{"q": {"vegan burgr"}})), "menu_item:Beyond Burger")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"creme brulee"}})), "menu_item:Crème Brûlée")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"trattorai"}})), "venue:Trattoria")
+
+	// An item's venue helps it match, but doesn't make every item on the menu match
+	expectNames(t, resultNames(s.search(url.Values{"q": {"pizza trattoria"}})), "menu_item:Pizza")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"sushi"}})))
+
+	// Dietary and allergen filters narrow items down, and venues to the ones serving such items
+	expectNames(t, resultNames(s.search(url.Values{"q": {"burger"}, "dietary": {"VEGAN"}})), "venue:Burger Bar", "menu_item:Beyond Burger")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"burger"}, "without_allergens": {"soya,nuts"}})), "venue:Burger Bar", "menu_item:Cheeseburger")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"burger"}, "without_allergens": {"soya", "dairy"}})))
+	expectNames(t, resultNames(s.search(url.Values{"q": {"bar"}, "dietary": {"halal"}})))
+	// Items that declare no allergens might contain any
+	expectNames(t, resultNames(s.search(url.Values{"q": {"pizza"}, "without_allergens": {"nuts"}})))
+
+	// Only one type of result, only ones near a point
+	expectNames(t, resultNames(s.search(url.Values{"q": {"burger"}, "type": {"venue"}})), "venue:Burger Bar")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"burger"}, "type": {"menu_item"}, "limit": {"1"}})), "menu_item:Beyond Burger")
+	near := s.search(url.Values{"q": {"pizza burger"}, "lat": {"52.3731"}, "lng": {"4.8926"}})
+	expectNames(t, resultNames(near))
+	near = s.search(url.Values{"q": {"burger"}, "lat": {"52.3740"}, "lng": {"4.8897"}, "radius": {"500"}})
+	if len(near) != 3 || near[0].Distance == nil || *near[0].Distance < 150 || *near[0].Distance > 300 {
+		t.Fatalf("expected results about 220m away, got %+v", near)
+	}
+
+	// Deleted venues and items aren't found
+	if err := s.store.SoftDeleteMenuItem(context.Background(), menu.ID, menu.Items[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.SoftDeleteVenue(context.Background(), trattoria.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectNames(t, resultNames(s.search(url.Values{"q": {"burger"}})), "venue:Burger Bar", "menu_item:Beyond Burger")
+	expectNames(t, resultNames(s.search(url.Values{"q": {"pizza"}})))
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	expectNames(t, resultNames(s.search(url.Values{"q": {"tiramisu"}})))
+
+	// Changes through the API are searchable once the index may be rebuilt
+	item := models.MenuItemV2{Name: "Tiramisù", Price: models.NewMoney(650, "EUR")}
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/menu/"+menu.ID.Hex()+"/items/", item), http.StatusOK, nil)
+	expectNames(t, resultNames(s.search(url.Values{"q": {"tiramisu"}})))
+	s.handler.searchIndex.builtAt = time.Now().Add(-searchIndexMinAge)
+	expectNames(t, resultNames(s.search(url.Values{"q": {"tiramisu"}})), "menu_item:Tiramisù")
+
+	// Everything else comes from the store, so it's never behind
+	if _, err := s.store.UpdateVenue(context.Background(), venue.ID, repositories.Fields{"name": "Osteria"}); err != nil {
+		t.Fatal(err)
+	}
+	results := s.search(url.Values{"q": {"tiramisu"}})
+	if len(results) != 1 || results[0].VenueName != "Osteria" {
+		t.Fatalf("expected the venue's new name, got %+v", results)
+	}
+}
+
+func TestSearchRejectsBadParams(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, query := range []string{
+		"",
+		"q=%20-",
+		"q=pizza&type=menu",
+		"q=pizza&limit=51",
+		"q=pizza&without_allergens=glitter",
+		"q=pizza&lat=52.37",
+	} {
+		rec := s.do(http.MethodGet, "/search?"+query, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, rec.Code)
+		}
+	}
+}
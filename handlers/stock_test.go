@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *testServer) stockOf(menu models.MenuV2, itemID primitive.ObjectID) models.MenuItemV2 {
+	s.t.Helper()
+
+	stored, err := s.store.GetMenuByID(context.Background(), menu.ID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	item, _ := stored.Item(itemID)
+	if item.Stock == nil {
+		s.t.Fatalf("expected %s to be counted", item.Name)
+	}
+	return item
+}
+
+func TestPaidOrdersCountStockDown(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	s.linkStripeAccount(venue)
+	pizza := menu.Items[0].ID
+
+	three := 3
+	var item models.MenuItemV2
+	s.expect(s.do(http.MethodPut, "/venues/"+venue.ID.Hex()+"/menu/"+menu.ID.Hex()+"/items/"+pizza.Hex()+"/stock",
+		ItemStockRequest{Stock: &three, LowStockAt: 1}), http.StatusOK, &item)
+	if *item.Stock != 3 || item.LowStockAt != 1 {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	var soldOut struct {
+		Error   string               `json:"error"`
+		SoldOut []primitive.ObjectID `json:"sold_out"`
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 4)), http.StatusConflict, &soldOut)
+	if soldOut.Error != "Pizza (3 left) sold out" || len(soldOut.SoldOut) != 1 {
+		t.Fatalf("unexpected response %+v", soldOut)
+	}
+
+	// Ordering doesn't take stock, paying does
+	var first, second models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 2, 1)), http.StatusCreated, &first)
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &second)
+	if left := s.stockOf(menu, pizza); *left.Stock != 3 {
+		t.Fatalf("expected 3 pizzas before paying, got %d", *left.Stock)
+	}
+
+	if _, err := s.stripe.Pay(s.checkout(first)); err != nil {
+		t.Fatal(err)
+	}
+	if left := s.stockOf(menu, pizza); *left.Stock != 1 || left.AvailabilityAt(time.Now()) != models.ItemAvailable {
+		t.Fatalf("expected 1 pizza left, got %+v", left)
+	}
+	events, err := s.store.GetOrderEventsAfter(context.Background(), venue.ID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alerts []models.StockAlert
+	for _, event := range events {
+		if event.Type == models.OrderEventLowStock {
+			alerts = append(alerts, *event.Stock)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].MenuItemID != pizza || alerts[0].Stock != 1 {
+		t.Fatalf("expected a low stock alert for the pizza, got %+v", alerts)
+	}
+
+	if _, err := s.stripe.Pay(s.checkout(second)); err != nil {
+		t.Fatal(err)
+	}
+	if left := s.stockOf(menu, pizza); *left.Stock != 0 || left.Availability != models.ItemSoldOut {
+		t.Fatalf("expected the pizza to be sold out, got %+v", left)
+	}
+	s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusConflict, nil)
+
+	// Refunding a pizza puts it back on the menu, refunding the rest of the order puts back the other one
+	refund := map[string]interface{}{"items": []map[string]interface{}{{"menu_item_id": pizza, "quantity": 1}}}
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+first.ID.Hex(), refund), http.StatusOK, nil)
+	if left := s.stockOf(menu, pizza); *left.Stock != 1 || left.Availability != models.ItemAvailable {
+		t.Fatalf("expected the refunded pizza back, got %+v", left)
+	}
+	s.expect(s.do(http.MethodPost, "/payments/refund/"+first.ID.Hex(), map[string]interface{}{}), http.StatusOK, nil)
+	if left := s.stockOf(menu, pizza); *left.Stock != 2 {
+		t.Fatalf("expected 2 pizzas after the refunds, got %d", *left.Stock)
+	}
+
+	s.expect(s.do(http.MethodGet, "/orders/"+first.ID.Hex(), nil), http.StatusOK, &first)
+	if first.Status != models.OrderStatusRefunded || len(first.Stock) != 0 {
+		t.Fatalf("expected the refunded order to hold no stock, got %+v", first)
+	}
+}
+
+func TestConcurrentPaymentsShareStock(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	pizza := menu.Items[0].ID
+	ctx := context.Background()
+
+	five := 5
+	if _, err := s.store.SetMenuItemStock(ctx, menu.ID, pizza, &five, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []models.Order
+	for i := 0; i < 8; i++ {
+		var order models.Order
+		s.expect(s.do(http.MethodPost, "/orders/", orderBody(venue, menu, 1)), http.StatusCreated, &order)
+		orders = append(orders, order)
+	}
+
+	var wg sync.WaitGroup
+	for _, order := range orders {
+		wg.Add(1)
+		go func(order models.Order) {
+			defer wg.Done()
+			if _, err := s.store.TransitionOrder(ctx, order.ID, models.OrderStatusPaid, models.OrderTriggerStripe, "evt_test"); err != nil {
+				t.Error(err)
+			}
+		}(order)
+	}
+	wg.Wait()
+
+	taken := 0
+	for _, order := range orders {
+		stored, err := s.store.GetOrderByID(ctx, order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range stored.Stock {
+			taken += line.Quantity
+		}
+	}
+	if left := s.stockOf(menu, pizza); *left.Stock != 0 || taken != 5 {
+		t.Fatalf("expected the 5 pizzas to be taken once each, got %d taken and %d left", taken, *left.Stock)
+	}
+}
+
+func TestReplacingItemsKeepsStock(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+	path := "/venues/" + venue.ID.Hex() + "/menu/" + menu.ID.Hex()
+	pizza, soda := menu.Items[0].ID, menu.Items[1].ID
+
+	// Version 2 has the pizza counted, version 3 the soda sold out too
+	three := 3
+	s.expect(s.do(http.MethodPut, path+"/items/"+pizza.Hex()+"/stock", ItemStockRequest{Stock: &three, LowStockAt: 1}), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPut, path+"/items/"+soda.Hex()+"/availability", ItemAvailabilityRequest{Availability: models.ItemSoldOut}), http.StatusOK, nil)
+
+	// An edit made from the menu as it was before doesn't reset them
+	edited := []models.MenuItemV2{menu.Items[0], menu.Items[1]}
+	edited[0].Name = "Pizza Margherita"
+	s.expect(s.do(http.MethodPut, path, map[string]interface{}{"items": edited}), http.StatusOK, nil)
+	if item := s.stockOf(menu, pizza); *item.Stock != 3 || item.LowStockAt != 1 || item.Name != "Pizza Margherita" {
+		t.Fatalf("expected the edit to keep the stock, got %+v", item)
+	}
+
+	// Neither does going back to a version from before they were set
+	s.expect(s.do(http.MethodPost, path+"/versions/1/rollback", nil), http.StatusOK, &menu)
+	item, _ := menu.Item(pizza)
+	if item.Stock == nil || *item.Stock != 3 || item.Name != "Pizza" {
+		t.Fatalf("expected the rollback to keep the stock, got %+v", item)
+	}
+	if item, _ := menu.Item(soda); item.Availability != models.ItemSoldOut {
+		t.Fatalf("expected the soda to stay sold out, got %+v", item)
+	}
+}
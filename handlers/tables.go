@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/qr"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TableWithCode is a table along with the link its QR code points to
+type TableWithCode struct {
+	models.Table
+	URL string `json:"url"`
+}
+
+func (h *Handler) CreateTable(c *gin.Context) {
+	log.Println("CreateTable")
+
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	var table models.Table
+	if err := c.ShouldBindJSON(&table); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if table.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "table name is required"})
+		return
+	}
+
+	if _, err := h.store.GetVenueByID(c.Request.Context(), venueID); errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	table.ID = primitive.NewObjectID()
+	table.VenueID = venueID
+	table.DeletedAt = nil
+
+	if err := h.store.CreateTable(c.Request.Context(), table); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, table)
+}
+
+// GetTables returns the venue's tables with the links to put in their QR codes
+func (h *Handler) GetTables(c *gin.Context) {
+	log.Println("GetTables")
+
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	tables, err := h.store.GetTablesByVenueID(c.Request.Context(), venueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	withCodes := make([]TableWithCode, 0, len(tables))
+	for _, table := range tables {
+		url, err := qr.TableURL(venueID, table.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		withCodes = append(withCodes, TableWithCode{Table: table, URL: url})
+	}
+
+	c.JSON(http.StatusOK, withCodes)
+}
+
+func (h *Handler) GetTable(c *gin.Context) {
+	log.Println("GetTable")
+
+	venueID, tableID, ok := tableParams(c)
+	if !ok {
+		return
+	}
+
+	table, err := h.store.GetVenueTable(c.Request.Context(), venueID, tableID)
+	if errors.Is(err, repositories.ErrTableNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	url, err := qr.TableURL(venueID, table.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, TableWithCode{Table: table, URL: url})
+}
+
+func (h *Handler) UpdateTable(c *gin.Context) {
+	log.Println("UpdateTable")
+
+	venueID, tableID, ok := tableParams(c)
+	if !ok {
+		return
+	}
+
+	var table models.Table
+	if err := c.ShouldBindJSON(&table); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if table.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "table name is required"})
+		return
+	}
+
+	table.ID = tableID
+	table.VenueID = venueID
+
+	err := h.store.UpdateTable(c.Request.Context(), table)
+	if errors.Is(err, repositories.ErrTableNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+func (h *Handler) SoftDeleteTable(c *gin.Context) {
+	log.Println("SoftDeleteTable")
+
+	venueID, tableID, ok := tableParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.store.SoftDeleteTable(c.Request.Context(), venueID, tableID)
+	if errors.Is(err, repositories.ErrTableNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "table soft deleted"})
+}
+
+// GetTableQRCode renders the table's QR code as a PNG, or as an SVG with ?format=svg, ?size= sets the width in pixels
+func (h *Handler) GetTableQRCode(c *gin.Context) {
+	log.Println("GetTableQRCode")
+
+	venueID, tableID, ok := tableParams(c)
+	if !ok {
+		return
+	}
+
+	size := qr.DefaultSize
+	if s := c.Query("size"); s != "" {
+		var err error
+		size, err = strconv.Atoi(s)
+		if err != nil || size < qr.MinSize || size > qr.MaxSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between " + strconv.Itoa(qr.MinSize) + " and " + strconv.Itoa(qr.MaxSize)})
+			return
+		}
+	}
+
+	if _, err := h.store.GetVenueTable(c.Request.Context(), venueID, tableID); errors.Is(err, repositories.ErrTableNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	url, err := qr.TableURL(venueID, tableID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "png") {
+	case "png":
+		png, err := qr.PNG(url, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", png)
+	case "svg":
+		svg, err := qr.SVG(url, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svg)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png or svg"})
+	}
+}
+
+func tableParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	venueID, err := primitive.ObjectIDFromHex(c.Param("venueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return venueID, primitive.NilObjectID, false
+	}
+	tableID, err := primitive.ObjectIDFromHex(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return venueID, tableID, false
+	}
+	return venueID, tableID, true
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+)
+
+func TestOrderAtTable(t *testing.T) {
+	s := newTestServer(t)
+	venue, menu := s.seedMenu()
+
+	var table TableWithCode
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/tables/", map[string]string{"name": "T4", "zone": "Terrace"}), http.StatusCreated, &table)
+
+	s.expect(s.do(http.MethodGet, "/venues/"+venue.ID.Hex()+"/tables/"+table.ID.Hex(), nil), http.StatusOK, &table)
+	link, err := url.Parse(table.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := link.Query().Get("sig")
+	if link.Query().Get("table_id") != table.ID.Hex() || signature == "" {
+		t.Fatalf("unexpected table URL %s", table.URL)
+	}
+
+	body := orderBody(venue, menu, 1)
+	body["table_id"] = table.ID
+	body["table_signature"] = "forged"
+	s.expect(s.do(http.MethodPost, "/orders/", body), http.StatusBadRequest, nil)
+
+	body["table_signature"] = signature
+	var order models.Order
+	s.expect(s.do(http.MethodPost, "/orders/", body), http.StatusCreated, &order)
+	if order.TableName != "T4" || order.Zone != "Terrace" {
+		t.Fatalf("expected the table to be snapshotted on the order, got %+v", order)
+	}
+
+	// Deleted tables can't be ordered at, even with a valid code
+	s.expect(s.do(http.MethodDelete, "/venues/"+venue.ID.Hex()+"/tables/"+table.ID.Hex(), nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodPost, "/orders/", body), http.StatusBadRequest, nil)
+}
+
+func TestTableQRCode(t *testing.T) {
+	s := newTestServer(t)
+	venue, _ := s.seedMenu()
+
+	var table TableWithCode
+	s.expect(s.do(http.MethodPost, "/venues/"+venue.ID.Hex()+"/tables/", map[string]string{"name": "T1"}), http.StatusCreated, &table)
+
+	path := "/venues/" + venue.ID.Hex() + "/tables/" + table.ID.Hex() + "/qr"
+	rec := s.do(http.MethodGet, path, nil)
+	s.expect(rec, http.StatusOK, nil)
+	if rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a PNG, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	s.expect(s.do(http.MethodGet, path+"?format=gif", nil), http.StatusBadRequest, nil)
+}
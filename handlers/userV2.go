@@ -1,24 +1,19 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"log"
 	"net/http"
-	"reflect"
-	"time"
 
-	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/SaplingPay/server/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-const CollectionNameUserV2 = "usersV2"
-
 // CreateUserV2 creates a new user in the database
-func CreateUserV2(c *gin.Context) {
+func (h *Handler) CreateUserV2(c *gin.Context) {
 	log.Println("CreateUser V2")
 
 	var user models.UserV2
@@ -33,20 +28,17 @@ func CreateUserV2(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	result, err := db.DB.Collection(CollectionNameUserV2).InsertOne(ctx, user)
+	user, err := h.store.CreateUser(c.Request.Context(), user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{"InsertedID": user.ID})
 }
 
 // UpdateUserV2 updates an existing user in the database
-func UpdateUserV2(c *gin.Context) {
+func (h *Handler) UpdateUserV2(c *gin.Context) {
 	log.Println("UpdateUser V2")
 
 	userID := c.Param("userId") // Get the ID from the URL parameter
@@ -57,51 +49,19 @@ func UpdateUserV2(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
 		return
 	}
 
-	// Prepare the update document similarly to before
-	update := bson.M{}
-	userType := reflect.TypeOf(user)
-	userValue := reflect.ValueOf(user)
-	for i := 0; i < userType.NumField(); i++ {
-		field := userType.Field(i)
-		fieldValue := userValue.Field(i).Interface()
-		fieldType := field.Type.Kind()
-
-		if fieldType == reflect.Bool || !reflect.DeepEqual(fieldValue, reflect.Zero(field.Type).Interface()) {
-			bsonTag := field.Tag.Get("bson")
-			// Skip if bson tag is not set or is "-"
-			if bsonTag == "" || bsonTag == "-" {
-				continue
-			}
-
-			update[field.Tag.Get("bson")] = fieldValue
-		}
-	}
-
-	result, err := db.DB.Collection(CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": update})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if result.ModifiedCount == 0 {
+	updatedUser, err := h.store.UpdateUser(c.Request.Context(), objID, utils.UpdateFields(user))
+	if errors.Is(err, repositories.ErrUserNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-
-	// Retrieve the updated user from the database
-	var updatedUser models.UserV2
-	err = db.DB.Collection(CollectionNameUserV2).FindOne(ctx, bson.M{"_id": objID}).Decode(&updatedUser)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve updated user"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -133,20 +93,15 @@ func UpdateUserV2(c *gin.Context) {
 // }
 
 // SoftDeleteUserV2 soft deletes a user from the database
-func SoftDeleteUserV2(c *gin.Context) {
+func (h *Handler) SoftDeleteUserV2(c *gin.Context) {
 	log.Println("SoftDeleteUser V2")
 	userID := c.Param("userId")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
 		return
 	}
-	update := bson.M{
-		"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())},
-	}
-	_, err = db.DB.Collection(CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": objID}, update)
+	err = h.store.SoftDeleteUser(c.Request.Context(), objID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -155,24 +110,21 @@ func SoftDeleteUserV2(c *gin.Context) {
 }
 
 // GetUserV2 retrieves a single user from the database
-func GetUserV2(c *gin.Context) {
+func (h *Handler) GetUserV2(c *gin.Context) {
 	log.Println("GetUser V2")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	userID := c.Param("userId")
 
 	log.Println("userID", userID)
-	var user models.UserV2
-	if err := db.DB.Collection(CollectionNameUserV2).FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Println("user not found")
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-		} else {
-			log.Println("error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+	user, err := h.store.GetUserByUserID(c.Request.Context(), userID)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		log.Println("user not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		log.Println("error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	log.Println("user", user)
@@ -181,133 +133,80 @@ func GetUserV2(c *gin.Context) {
 }
 
 // GetAllUsersV2 retrieves all users from the database
-func GetAllUsersV2(c *gin.Context) {
+func (h *Handler) GetAllUsersV2(c *gin.Context) {
 	log.Println("GetAllUsers V2")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var users []models.UserV2
-	cursor, err := db.DB.Collection(CollectionNameUserV2).Find(ctx, bson.M{})
+	users, err := h.store.GetAllUsers(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var user models.UserV2
-		if err := cursor.Decode(&user); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		users = append(users, user)
-	}
 
 	c.JSON(http.StatusOK, users)
 }
 
-func FollowUser(c *gin.Context) {
+func (h *Handler) FollowUser(c *gin.Context) {
 	log.Println("Follow")
 
-	userID := c.Param("userId")
-	followingID := c.Param("followingId")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	objID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+	objID, followingObjID, ok := followParams(c)
+	if !ok {
 		return
 	}
 
-	followingObjID, err := primitive.ObjectIDFromHex(followingID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
-		return
-	}
-
-	_, err = db.DB.Collection(CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$addToSet": bson.M{"following": followingObjID.Hex()}})
+	updatedUser, err := h.store.FollowUser(c.Request.Context(), objID, followingObjID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	_, err = db.DB.Collection(CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": followingObjID}, bson.M{"$addToSet": bson.M{"followers": objID.Hex()}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	var updatedUser models.UserV2
-	err = db.DB.Collection(CollectionNameUserV2).FindOne(ctx, bson.M{"_id": followingObjID}).Decode(&updatedUser)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve updated user"})
-		return
-	}
 	c.JSON(http.StatusOK, updatedUser)
 }
 
-func UnFollowUser(c *gin.Context) {
+func (h *Handler) UnFollowUser(c *gin.Context) {
 	log.Println("UnFollow")
 
-	userID := c.Param("userId")
-	followingID := c.Param("followingId")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	objID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
-		return
-	}
-
-	followingObjID, err := primitive.ObjectIDFromHex(followingID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+	objID, followingObjID, ok := followParams(c)
+	if !ok {
 		return
 	}
 
-	_, err = db.DB.Collection(CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$pull": bson.M{"following": followingObjID.Hex()}})
+	updatedUser, err := h.store.UnfollowUser(c.Request.Context(), objID, followingObjID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, updatedUser)
+}
 
-	_, err = db.DB.Collection(CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": followingObjID}, bson.M{"$pull": bson.M{"followers": objID.Hex()}})
+// followParams parses the user and followed user IDs, responding with an error if either is invalid
+func followParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return objID, objID, false
 	}
 
-	var updatedUser models.UserV2
-	err = db.DB.Collection(CollectionNameUserV2).FindOne(ctx, bson.M{"_id": followingObjID}).Decode(&updatedUser)
+	followingObjID, err := primitive.ObjectIDFromHex(c.Param("followingId"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve updated user"})
-		return
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return objID, followingObjID, false
 	}
-	c.JSON(http.StatusOK, updatedUser)
+
+	return objID, followingObjID, true
 }
 
 // GetUserSaves retrieves all saves for a user
-func GetUserSaves(c *gin.Context) {
+func (h *Handler) GetUserSaves(c *gin.Context) {
 	log.Println("GetUserSaves")
 
 	userID := c.Param("userId")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
 		return
 	}
 
-	var user models.UserV2
-	err = db.DB.Collection(CollectionNameUserV2).FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	user, err := h.store.GetUserByID(c.Request.Context(), objID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -318,8 +217,7 @@ func GetUserSaves(c *gin.Context) {
 
 		var userSave models.UserSavesResponse
 		if save.Type == "venue" {
-			var venue models.Venue
-			err = db.DB.Collection("venues").FindOne(ctx, bson.M{"_id": save.VenueID}).Decode(&venue)
+			venue, err := h.store.GetVenueByID(c.Request.Context(), save.VenueID)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve venue"})
 				return
@@ -334,15 +232,13 @@ func GetUserSaves(c *gin.Context) {
 			userSave.ProfilePicURL = venue.ProfilePicURL
 			userSave.Location = venue.Location
 		} else if save.Type == "menu_item" {
-			var menu models.MenuV2
-			err = db.DB.Collection("menusV2").FindOne(ctx, bson.M{"_id": save.MenuID}).Decode(&menu)
+			menu, err := h.store.GetMenuByID(c.Request.Context(), save.MenuID)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve menu"})
 				return
 			}
 
-			var venue models.Venue
-			err = db.DB.Collection("venues").FindOne(ctx, bson.M{"_id": menu.VenueID}).Decode(&venue)
+			venue, err := h.store.GetVenueByID(c.Request.Context(), menu.VenueID)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve venue"})
 				return
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFollowUser(t *testing.T) {
+	s := newTestServer(t)
+
+	var alice, bob struct {
+		InsertedID primitive.ObjectID `json:"InsertedID"`
+	}
+	s.expect(s.do(http.MethodPost, "/usersV2/", map[string]string{"user_id": "auth|alice", "username": "alice"}), http.StatusOK, &alice)
+	s.expect(s.do(http.MethodPost, "/usersV2/", map[string]string{"user_id": "auth|bob", "username": "bob"}), http.StatusOK, &bob)
+
+	var followed models.UserV2
+	s.expect(s.do(http.MethodPut, "/usersV2/"+alice.InsertedID.Hex()+"/follow/"+bob.InsertedID.Hex(), nil), http.StatusOK, &followed)
+	if len(followed.Followers) != 1 || followed.Followers[0] != alice.InsertedID {
+		t.Fatalf("expected alice to follow bob, got %+v", followed)
+	}
+
+	// Users are looked up by the ID of their login
+	var user models.UserV2
+	s.expect(s.do(http.MethodGet, "/usersV2/auth|alice", nil), http.StatusOK, &user)
+	if len(user.Following) != 1 || user.Following[0] != bob.InsertedID {
+		t.Fatalf("expected alice to follow bob, got %+v", user)
+	}
+
+	s.expect(s.do(http.MethodPut, "/usersV2/"+alice.InsertedID.Hex()+"/unfollow/"+bob.InsertedID.Hex(), nil), http.StatusOK, &followed)
+	if len(followed.Followers) != 0 {
+		t.Fatalf("expected alice to unfollow bob, got %+v", followed)
+	}
+
+	s.expect(s.do(http.MethodGet, "/usersV2/auth|nobody", nil), http.StatusNotFound, nil)
+}
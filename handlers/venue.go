@@ -1,22 +1,28 @@
 package handlers
 
 import (
-	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"reflect"
 	"time"
 
-	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/SaplingPay/server/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/gin-gonic/gin/binding"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// VenueResponse is the venue along with whether it's open right now
+type VenueResponse struct {
+	models.Venue
+	models.OpeningStatus
+}
+
 // CreateVenue creates a new venue in the database
-func CreateVenue(c *gin.Context) {
+func (h *Handler) CreateVenue(c *gin.Context) {
 	log.Println("CreateVenue")
 
 	var venue models.Venue
@@ -26,36 +32,61 @@ func CreateVenue(c *gin.Context) {
 		return
 	}
 
-	venue.MenuIDs = []primitive.ObjectID{}
+	if err := venue.ValidateBusinessDay(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := venue.ValidateOpeningHours(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := venue.Location.Prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	venue.MenuIDs = []primitive.ObjectID{}
 
-	result, err := db.DB.Collection(db.CollectionNameVenue).InsertOne(ctx, venue)
+	venue, err := h.store.CreateVenue(c.Request.Context(), venue)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	log.Println("Venue created:", result.InsertedID)
+	log.Println("Venue created:", venue.ID)
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{"InsertedID": venue.ID})
 }
 
 // UpdateVenue updates an existing venue in the database
-func UpdateVenue(c *gin.Context) {
+func (h *Handler) UpdateVenue(c *gin.Context) {
 	log.Println("UpdateVenue")
 
 	venueID := c.Param("venueId") // Get the ID from the URL parameter
 
 	var venue models.Venue
-	if err := c.ShouldBindJSON(&venue); err != nil {
+	var sent map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&venue, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindBodyWith(&sent, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if err := venue.ValidateBusinessDay(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := venue.ValidateOpeningHours(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := venue.Location.Prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Convert the string ID to MongoDB's ObjectID
 	objID, err := primitive.ObjectIDFromHex(venueID)
@@ -64,37 +95,23 @@ func UpdateVenue(c *gin.Context) {
 		return
 	}
 
-	// Prepare the update document similarly to before
-	update := bson.M{}
-	venueType := reflect.TypeOf(venue)
-	venueValue := reflect.ValueOf(venue)
-	for i := 0; i < venueType.NumField(); i++ {
-		field := venueType.Field(i)
-		fieldValue := venueValue.Field(i).Interface()
-		fieldType := field.Type.Kind()
+	update := utils.UpdateFields(venue)
 
-		if fieldType == reflect.Bool || !reflect.DeepEqual(fieldValue, reflect.Zero(field.Type).Interface()) {
-			bsonTag := field.Tag.Get("bson")
-			// Skip if bson tag is not set or is "-"
-			if bsonTag == "" || bsonTag == "-" {
-				continue
-			}
+	// The Stripe account is linked through /payments/linkAccount so both sides of the link stay in sync
+	delete(update, "stripe_account_id")
 
-			update[field.Tag.Get("bson")] = fieldValue
-		}
+	// Bools are always in the update, leaving ordering_supported out mustn't stop the venue taking orders
+	if _, ok := sent["ordering_supported"]; !ok {
+		delete(update, "ordering_supported")
 	}
 
-	_, err = db.DB.Collection(db.CollectionNameVenue).UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": update})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	updatedVenue, err := h.store.UpdateVenue(c.Request.Context(), objID, update)
+	if errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
 		return
 	}
-
-	// Retrieve the updated venue from the database
-	var updatedVenue models.Venue
-	err = db.DB.Collection(db.CollectionNameVenue).FindOne(ctx, bson.M{"_id": objID}).Decode(&updatedVenue)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve updated venue"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -129,23 +146,16 @@ func UpdateVenue(c *gin.Context) {
 // }
 
 // SoftDeleteVenue soft deletes a venue from the database
-func SoftDeleteVenue(c *gin.Context) {
+func (h *Handler) SoftDeleteVenue(c *gin.Context) {
 	log.Println("SoftDeleteVenue")
 	// Fetching the venue ID from the URL parameter
 	venueID := c.Param("venueId")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	// Assuming `venueID` needs to be converted to an ObjectID if you're using MongoDB's default ObjectID
-	// If your ID is a string in the database, you can directly use venueID in the filter
 	objID, err := primitive.ObjectIDFromHex(venueID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
 		return
 	}
-	update := bson.M{
-		"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())},
-	}
-	_, err = db.DB.Collection(db.CollectionNameVenue).UpdateOne(ctx, bson.M{"_id": objID}, update)
+	err = h.store.SoftDeleteVenue(c.Request.Context(), objID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -154,12 +164,9 @@ func SoftDeleteVenue(c *gin.Context) {
 }
 
 // GetVenue retrieves a single venue from the database
-func GetVenue(c *gin.Context) {
+func (h *Handler) GetVenue(c *gin.Context) {
 	log.Println("GetVenue")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	// Convert the ID from the URL parameter to an ObjectID
 	venueID := c.Param("venueId")
 	objID, err := primitive.ObjectIDFromHex(venueID)
@@ -168,44 +175,34 @@ func GetVenue(c *gin.Context) {
 		return
 	}
 
-	var venue models.Venue
-	// Use the ObjectID to find the venue
-	if err := db.DB.Collection(db.CollectionNameVenue).FindOne(ctx, bson.M{"_id": objID}).Decode(&venue); err != nil {
-		// Adjust the error handling to distinguish not found errors from other errors
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+	venue, err := h.store.GetVenueByID(c.Request.Context(), objID)
+	if errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, venue)
+	status, err := venue.OpeningStatusAt(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, VenueResponse{Venue: venue, OpeningStatus: status})
 }
 
-// GetAllVenues retrieves all venues from the database
-func GetAllVenues(c *gin.Context) {
+// GetAllVenues retrieves all venues that aren't deleted from the database
+func (h *Handler) GetAllVenues(c *gin.Context) {
 	log.Println("GetAllVenues")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var venues []models.Venue
-	cursor, err := db.DB.Collection(db.CollectionNameVenue).Find(ctx, bson.M{})
+	venues, err := h.store.GetAllVenues(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var venue models.Venue
-		if err := cursor.Decode(&venue); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		venues = append(venues, venue)
-	}
 
 	c.JSON(http.StatusOK, venues)
 }
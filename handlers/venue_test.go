@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestVenueLifecycle(t *testing.T) {
+	s := newTestServer(t)
+
+	var created struct {
+		InsertedID primitive.ObjectID `json:"InsertedID"`
+	}
+	s.expect(s.do(http.MethodPost, "/venues/", map[string]interface{}{"name": "Cafe", "time_zone": "Europe/Amsterdam"}), http.StatusOK, &created)
+
+	path := "/venues/" + created.InsertedID.Hex()
+
+	var venue models.Venue
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &venue)
+	if venue.Name != "Cafe" || venue.TimeZone != "Europe/Amsterdam" {
+		t.Fatalf("unexpected venue %+v", venue)
+	}
+
+	// Fields left out of the update stay as they were, the Stripe account is only linked through its own route
+	update := map[string]interface{}{"profile_pic_url": "https://img.example.com/cafe.png", "stripe_account_id": "acct_sneaky"}
+	s.expect(s.do(http.MethodPut, path, update), http.StatusOK, &venue)
+	if venue.Name != "Cafe" || venue.ProfilePicURL != "https://img.example.com/cafe.png" || venue.StripeAccountID != "" {
+		t.Fatalf("unexpected updated venue %+v", venue)
+	}
+
+	s.expect(s.do(http.MethodDelete, path, nil), http.StatusOK, nil)
+	s.expect(s.do(http.MethodGet, path, nil), http.StatusOK, &venue)
+	if venue.DeletedAt == nil {
+		t.Fatal("expected the venue to be soft deleted")
+	}
+}
+
+func TestCreateVenueRejectsInvalidBusinessDay(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do(http.MethodPost, "/venues/", map[string]interface{}{"name": "Cafe", "time_zone": "Mars/Olympus"}), http.StatusBadRequest, nil)
+	s.expect(s.do(http.MethodPost, "/venues/", map[string]interface{}{"name": "Cafe", "business_day_start": "25:00"}), http.StatusBadRequest, nil)
+}
+
+func TestGetVenueNotFound(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do(http.MethodGet, "/venues/"+primitive.NewObjectID().Hex(), nil), http.StatusNotFound, nil)
+	s.expect(s.do(http.MethodPut, "/venues/"+primitive.NewObjectID().Hex(), map[string]string{"name": "Gone"}), http.StatusNotFound, nil)
+}
@@ -1,20 +1,34 @@
 package main
 
 import (
+	"context"
 	"github.com/stripe/stripe-go/v78"
 	"log"
 	"os"
+	"time"
 
 	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/events"
 	"github.com/SaplingPay/server/handlers"
+	"github.com/SaplingPay/server/menuparser"
+	"github.com/SaplingPay/server/middleware"
+	"github.com/SaplingPay/server/payments"
+	"github.com/SaplingPay/server/payments/fake"
+	"github.com/SaplingPay/server/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+// Menu cards are parsed this many at a time, each one is given up on after parseTimeout
+const parseWorkers = 2
+const parseTimeout = 5 * time.Minute
+
 func main() {
 	log.Println("Starting server")
 
-	r := gin.Default()
+	// Event streams may send their token in the query, the default logger would log it
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
 
 	env := os.Getenv("SERVER_ENV")
 
@@ -33,12 +47,26 @@ func main() {
 		}
 	}
 
-	stripeSecret := os.Getenv("STRIPE_SECRET")
+	var stripeClient payments.Client = payments.StripeClient{}
+	var fakeStripe *fake.Client
 
-	if stripeSecret == "" {
-		log.Fatal("STRIPE_SECRET not found in .env file")
+	if os.Getenv("STRIPE_FAKE") == "true" {
+		// Checkout pages and webhook events are served by this server, nothing reaches Stripe
+		log.Println("Using fake Stripe")
+		origin := os.Getenv("STRIPE_FAKE_ORIGIN")
+		if origin == "" {
+			origin = "http://localhost:8080"
+		}
+		fakeStripe = fake.New(origin, os.Getenv("STRIPE_WEBHOOK_SECRET"))
+		stripeClient = fakeStripe
+	} else {
+		stripeSecret := os.Getenv("STRIPE_SECRET")
+
+		if stripeSecret == "" {
+			log.Fatal("STRIPE_SECRET not found in .env file")
+		}
+		stripe.Key = stripeSecret
 	}
-	stripe.Key = stripeSecret
 
 	mongoURI := os.Getenv("MONGO_URI")
 	if mongoURI == "" {
@@ -46,8 +74,24 @@ func main() {
 	}
 
 	db.ConnectMongo(mongoURI)
+	db.EnsureIndexes()
 
-	handlers.SetUpRoutes(r)
+	go events.WatchOrderEvents(context.Background())
+
+	parser, err := menuparser.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := repositories.NewMongo(db.DB)
+
+	parseJobs := menuparser.NewJobs(store, parser, parseWorkers, parseTimeout)
+	go parseJobs.Run(context.Background())
+	if fakeStripe != nil {
+		// Before the routes that need a token, the guest's browser doesn't have one
+		fakeStripe.AddRoutes(r, "/payments/webhook")
+	}
+	handlers.SetUpRoutes(r, handlers.NewHandler(store, events.Orders, stripeClient, parseJobs))
 
 	// Start the server
 	r.Run(":8080") // listen and serve on 0.0.0.0:8080
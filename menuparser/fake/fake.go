@@ -0,0 +1,62 @@
+// Package fake is a menu parser for tests that answers with fixtures instead of reading the file
+package fake
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaplingPay/server/menuparser"
+	"github.com/SaplingPay/server/models"
+)
+
+var ErrNoFixture = errors.New("no fixture for the uploaded file")
+
+// Parser answers an upload named "pizzeria.pdf" with dir/pizzeria.json, which holds what OpenAI would answer
+type Parser struct {
+	dir string
+
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+var _ menuparser.MenuParser = (*Parser)(nil)
+
+func New(dir string) *Parser {
+	return &Parser{dir: dir}
+}
+
+// SetDelay makes parsing take as long as a slow model would, or until the job is cancelled
+func (p *Parser) SetDelay(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.delay = delay
+}
+
+func (p *Parser) Parse(ctx context.Context, file menuparser.File) ([]models.MenuItemV2, error) {
+	p.mu.Lock()
+	delay := p.delay
+	p.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(delay):
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file.Name), filepath.Ext(file.Name))
+	raw, err := os.ReadFile(filepath.Join(p.dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoFixture
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return menuparser.DecodeItems(string(raw))
+}
@@ -0,0 +1,243 @@
+package menuparser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A job that fails this often, say because it takes a server down with it, isn't tried again
+const maxParseAttempts = 3
+
+// How often idle workers look for jobs queued on another server or abandoned by one that went down
+const parseJobPollInterval = 10 * time.Second
+
+// A job's lease outlasts its deadline by this much, so it isn't claimed again while its outcome is being stored
+const parseJobLeaseGrace = time.Minute
+
+// Jobs parses uploaded menu cards in the background with a fixed number of workers, each job has timeout to finish
+type Jobs struct {
+	store   repositories.Store
+	parser  MenuParser
+	workers int
+	timeout time.Duration
+
+	wake chan struct{}
+
+	mu      sync.Mutex
+	running map[primitive.ObjectID]context.CancelFunc
+}
+
+func NewJobs(store repositories.Store, parser MenuParser, workers int, timeout time.Duration) *Jobs {
+	return &Jobs{
+		store:   store,
+		parser:  parser,
+		workers: workers,
+		timeout: timeout,
+		wake:    make(chan struct{}, workers),
+		running: map[primitive.ObjectID]context.CancelFunc{},
+	}
+}
+
+// Run works through the queue until ctx is done. Jobs still running then are left to be picked up again once
+// their lease runs out.
+func (j *Jobs) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < j.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Submit queues a job for the venue's menu card
+func (j *Jobs) Submit(ctx context.Context, venueID primitive.ObjectID, file File) (models.ParseJob, error) {
+	job := models.ParseJob{
+		ID:          primitive.NewObjectID(),
+		VenueID:     venueID,
+		Status:      models.ParseJobQueued,
+		FileName:    file.Name,
+		ContentType: file.ContentType,
+		File:        file.Data,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if err := j.store.CreateParseJob(ctx, job); err != nil {
+		return models.ParseJob{}, err
+	}
+
+	select {
+	case j.wake <- struct{}{}:
+	default:
+		// Every worker has a wake up pending already
+	}
+
+	job.File = nil
+	return job, nil
+}
+
+// Cancel cancels the job and stops parsing it if a worker of this server is at it
+func (j *Jobs) Cancel(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error) {
+	job, err := j.store.CancelParseJob(ctx, venueID, jobID)
+	if err != nil {
+		return job, err
+	}
+
+	j.mu.Lock()
+	if cancel, ok := j.running[jobID]; ok {
+		cancel()
+	}
+	j.mu.Unlock()
+
+	return job, nil
+}
+
+func (j *Jobs) work(ctx context.Context) {
+	for {
+		job, err := j.store.ClaimParseJob(ctx, time.Now().Add(j.timeout+parseJobLeaseGrace))
+		if err == nil {
+			j.run(ctx, job)
+			continue
+		}
+		if !errors.Is(err, repositories.ErrParseJobNotFound) && ctx.Err() == nil {
+			log.Println(loggerTag, "unable to claim a parse job", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.wake:
+		case <-time.After(parseJobPollInterval):
+		}
+	}
+}
+
+func (j *Jobs) run(ctx context.Context, job models.ParseJob) {
+	log.Println(loggerTag, "Parsing", job.FileName, "for job", job.ID.Hex(), "attempt", job.Attempts)
+
+	if job.Attempts > maxParseAttempts {
+		job.Status = models.ParseJobFailed
+		job.Error = fmt.Sprintf("gave up after %d attempts", maxParseAttempts)
+		j.finish(job)
+		return
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, j.timeout)
+	j.mu.Lock()
+	j.running[job.ID] = cancel
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		delete(j.running, job.ID)
+		j.mu.Unlock()
+		cancel()
+	}()
+
+	items, err := j.parser.Parse(jobCtx, File{Name: job.FileName, ContentType: job.ContentType, Data: job.File})
+	if ctx.Err() != nil {
+		// The server is going down, whoever claims the job next starts over
+		return
+	}
+	if errors.Is(jobCtx.Err(), context.Canceled) {
+		log.Println(loggerTag, "Job", job.ID.Hex(), "cancelled")
+		return
+	}
+	if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("parsing took longer than %s", j.timeout)
+	}
+	if err == nil {
+		// Whatever the backend, the items have to hold to the schema
+		items, err = ValidateItems(items)
+	}
+	if err != nil {
+		job.Status = models.ParseJobFailed
+		job.Error = err.Error()
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			job.Problems = invalid.Problems
+		}
+		j.finish(job)
+		return
+	}
+
+	cleanParsedItems(items)
+
+	draft := models.MenuDraft{
+		ID:         primitive.NewObjectID(),
+		VenueID:    job.VenueID,
+		ParseJobID: job.ID,
+		Name:       "Parsed Menu from " + time.Now().Format("01-02-2006 15:04:05"),
+		Items:      items,
+		Status:     models.MenuDraftOpen,
+		CreatedAt:  primitive.NewDateTimeFromTime(time.Now()),
+	}
+	draft.Review()
+
+	if err := j.store.CreateMenuDraft(ctx, draft); err != nil {
+		job.Status = models.ParseJobFailed
+		job.Error = "unable to save the menu draft: " + err.Error()
+		j.finish(job)
+		return
+	}
+
+	job.Status = models.ParseJobSucceeded
+	job.DraftID = draft.ID
+	if !j.finish(job) {
+		// Cancelled while the draft was being saved
+		if err := j.store.CloseMenuDraft(ctx, draft.VenueID, draft.ID, models.MenuDraftDiscarded, primitive.NilObjectID); err != nil {
+			log.Println(loggerTag, "unable to discard the draft of cancelled job", job.ID.Hex(), err)
+		}
+	}
+}
+
+// finish stores the outcome, false if the job was cancelled or taken over in the meantime
+func (j *Jobs) finish(job models.ParseJob) bool {
+	// The outcome is stored even when the deadline that ended the job has passed
+	ctx := context.Background()
+
+	finished, err := j.store.FinishParseJob(ctx, job)
+	if err != nil {
+		log.Println(loggerTag, "unable to finish job", job.ID.Hex(), err)
+		return false
+	}
+	log.Println(loggerTag, "Job", job.ID.Hex(), job.Status, job.Error)
+
+	return finished
+}
+
+// cleanParsedItems drops what the parser made up or got wrong instead of failing the whole menu on it
+func cleanParsedItems(items []models.MenuItemV2) {
+	for i := range items {
+		item := &items[i]
+
+		allergens := []models.Allergen{}
+		for _, name := range item.Allergens {
+			if allergen, ok := models.ParseAllergen(string(name)); ok {
+				allergens = append(allergens, allergen)
+			} else {
+				log.Println(loggerTag, "Dropping unknown allergen", name, "of", item.Name)
+			}
+		}
+		item.Allergens = allergens
+
+		item.ID = primitive.NewObjectID()
+		if err := item.Prepare(); err != nil {
+			log.Println(loggerTag, "Dropping details of", item.Name, err)
+			item.Description = ""
+			item.Ingredients = nil
+			item.DietaryTags = nil
+			item.ImageURL = ""
+			item.Blurhash = models.BlurhashData{}
+			item.ModifierGroups = nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package menuparser_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/menuparser"
+	"github.com/SaplingPay/server/menuparser/fake"
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories/memory"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// runJobs starts the workers on the store and stops them when the test ends
+func runJobs(t *testing.T, store *memory.Store, parser menuparser.MenuParser, timeout time.Duration) *menuparser.Jobs {
+	jobs := menuparser.NewJobs(store, parser, 1, timeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go jobs.Run(ctx)
+
+	return jobs
+}
+
+func waitForJob(t *testing.T, store *memory.Store, job models.ParseJob) models.ParseJob {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		current, err := store.GetParseJob(context.Background(), job.VenueID, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Finished() {
+			return current
+		}
+	}
+	t.Fatalf("job %s didn't finish", job.ID.Hex())
+	return job
+}
+
+func TestJobDeadline(t *testing.T) {
+	store := memory.New()
+	parser := fake.New("testdata")
+	parser.SetDelay(time.Hour)
+	jobs := runJobs(t, store, parser, 50*time.Millisecond)
+
+	job, err := jobs.Submit(context.Background(), primitive.NewObjectID(), menuparser.File{Name: "pizzeria.pdf", ContentType: menuparser.ContentTypePDF})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job = waitForJob(t, store, job)
+	if job.Status != models.ParseJobFailed || job.Error != "parsing took longer than 50ms" {
+		t.Fatalf("expected the job to time out, got %s %q", job.Status, job.Error)
+	}
+}
+
+func TestAbandonedJobsAreRunAgain(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+	expired := primitive.NewDateTimeFromTime(time.Now().Add(-time.Minute))
+	venueID := primitive.NewObjectID()
+
+	// Left running by servers that went down, the second one for the last time
+	abandoned := models.ParseJob{
+		ID: primitive.NewObjectID(), VenueID: venueID, Status: models.ParseJobRunning, Attempts: 1, LeaseUntil: &expired,
+		FileName: "pizzeria.pdf", ContentType: menuparser.ContentTypePDF, File: []byte("%PDF-1.4"),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	exhausted := abandoned
+	exhausted.ID = primitive.NewObjectID()
+	exhausted.Attempts = 3
+	for _, job := range []models.ParseJob{abandoned, exhausted} {
+		if err := store.CreateParseJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runJobs(t, store, fake.New("testdata"), time.Second)
+
+	if job := waitForJob(t, store, abandoned); job.Status != models.ParseJobSucceeded || job.Attempts != 2 || job.DraftID.IsZero() {
+		t.Fatalf("expected the abandoned job to succeed on its second attempt, got %+v", job)
+	}
+	if job := waitForJob(t, store, exhausted); job.Status != models.ParseJobFailed || job.Error != "gave up after 3 attempts" {
+		t.Fatalf("expected the job to be given up on, got %+v", job)
+	}
+}
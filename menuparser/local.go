@@ -0,0 +1,142 @@
+package menuparser
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/SaplingPay/server/models"
+)
+
+// Local reads the text of PDFs and takes every line ending in a price for an item, without calling out anywhere.
+// Scanned PDFs and photos have no text to read, they need OpenAI.
+type Local struct{}
+
+func (Local) Parse(ctx context.Context, file File) ([]models.MenuItemV2, error) {
+	if file.ContentType != ContentTypePDF {
+		return nil, ErrUnsupportedContentType
+	}
+
+	lines, err := pdfText(file.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return itemsFromLines(lines), nil
+}
+
+// A price is a number with cents or a currency symbol, so years and phone numbers aren't taken for one
+var pricePattern = regexp.MustCompile(`^(?:(€|\$|£)\s?)?(\d{1,4})(?:[.,](\d{1,2}))?(?:\s?(€|\$|£|EUR|USD|GBP))?$`)
+
+// Prices beyond this are more likely a phone number or an address than something on the menu
+const maxLocalPrice = 100000
+
+var currencySymbols = map[string]string{"€": "EUR", "$": "USD", "£": "GBP", "EUR": "EUR", "USD": "USD", "GBP": "GBP"}
+
+// itemsFromLines reads "Margherita ..... 9,50" as an item, a short title-like line as the category of the items
+// below it and the other lines after an item as its description. A name with the price on the next line works too.
+func itemsFromLines(lines []string) []models.MenuItemV2 {
+	items := []models.MenuItemV2{}
+	var category string
+	var current *models.MenuItemV2
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		name, price, ok := splitPrice(line)
+		if !ok && i+1 < len(lines) && isLetters(line) {
+			if nextPrice, priceOnly := parsePrice(lines[i+1]); priceOnly {
+				name, price, ok = line, nextPrice, true
+				i++
+			}
+		}
+
+		if ok {
+			item := models.MenuItemV2{Name: name, Price: price}
+			if category != "" {
+				item.Categories = []string{category}
+			}
+			items = append(items, item)
+			current = &items[len(items)-1]
+			continue
+		}
+
+		if isHeading(line) {
+			category = normalizeCategory(line)
+			current = nil
+			continue
+		}
+
+		// Text before the first item is the venue's name and address
+		if current != nil {
+			current.Description = strings.TrimSpace(current.Description + " " + line)
+		}
+	}
+
+	return items
+}
+
+// splitPrice splits a line into the item name and the price at its end
+func splitPrice(line string) (string, models.Money, bool) {
+	fields := strings.Fields(line)
+	// The price can be split from its symbol, as in "9,50 €"
+	for n := 1; n <= 2 && n < len(fields); n++ {
+		price, ok := parsePrice(strings.Join(fields[len(fields)-n:], " "))
+		if !ok {
+			continue
+		}
+		name := strings.TrimRight(strings.Join(fields[:len(fields)-n], " "), " .·…_-–—:")
+		if !isLetters(name) {
+			return "", models.Money{}, false
+		}
+		return name, price, true
+	}
+	return "", models.Money{}, false
+}
+
+func parsePrice(text string) (models.Money, bool) {
+	match := pricePattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return models.Money{}, false
+	}
+	symbol := match[1] + match[4]
+	if match[3] == "" && symbol == "" {
+		return models.Money{}, false
+	}
+
+	units, _ := strconv.ParseInt(match[2], 10, 64)
+	cents, _ := strconv.ParseInt((match[3] + "00")[:2], 10, 64)
+	amount := units*100 + cents
+	if amount > maxLocalPrice {
+		return models.Money{}, false
+	}
+
+	return models.NewMoney(amount, currencySymbols[symbol]), true
+}
+
+// isHeading tells a category title from a description: it's in capitals, ends in a colon or is a few capitalised words
+func isHeading(line string) bool {
+	if !isLetters(line) {
+		return false
+	}
+	if strings.ToUpper(line) == line || strings.HasSuffix(line, ":") {
+		return true
+	}
+
+	words := strings.Fields(line)
+	if len(words) > 3 || strings.ContainsAny(line, ",.;()") {
+		return false
+	}
+	for _, word := range words {
+		if first := []rune(word)[0]; !unicode.IsUpper(first) && word != "&" && word != "and" {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetters(text string) bool {
+	return strings.IndexFunc(text, unicode.IsLetter) >= 0
+}
@@ -0,0 +1,67 @@
+package menuparser
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+)
+
+func TestLocalParsesTextPDF(t *testing.T) {
+	data, err := os.ReadFile("testdata/menu.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := Local{}.Parse(context.Background(), File{Name: "menu.pdf", ContentType: ContentTypePDF, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []models.MenuItemV2{
+		{Name: "Margherita", Price: models.NewMoney(950, "EUR"), Categories: []string{"Pizza"}, Description: "tomato, mozzarella, basil"},
+		{Name: "Funghi (new)", Price: models.NewMoney(1100, "EUR"), Categories: []string{"Pizza"}, Description: "mushrooms, truffle oil"},
+		{Name: "Cola", Price: models.NewMoney(300, ""), Categories: []string{"Drinks"}, Description: "Opening since 1998"},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, items)
+	}
+}
+
+func TestLocalRejectsImagesAndScans(t *testing.T) {
+	_, err := Local{}.Parse(context.Background(), File{Name: "menu.jpg", ContentType: ContentTypeJPEG, Data: []byte{0xff, 0xd8}})
+	if err != ErrUnsupportedContentType {
+		t.Fatalf("expected ErrUnsupportedContentType, got %v", err)
+	}
+
+	scan := []byte("%PDF-1.4\n1 0 obj\n<< /Type /XObject /Subtype /Image /Length 3 >>\nstream\nabc\nendstream\nendobj\n")
+	_, err = Local{}.Parse(context.Background(), File{Name: "scan.pdf", ContentType: ContentTypePDF, Data: scan})
+	if err != ErrNoText {
+		t.Fatalf("expected ErrNoText, got %v", err)
+	}
+}
+
+func TestItemsFromLines(t *testing.T) {
+	items := itemsFromLines([]string{
+		"Est. 2004",
+		"Call 020 123 4567",
+		"Small Plates",
+		"Bitterballen 8 pieces €7",
+		"Fries 4.5",
+		"with mayonnaise",
+		"WINE",
+		"House red, glass",
+		"£6.00",
+	})
+
+	expected := []models.MenuItemV2{
+		{Name: "Bitterballen 8 pieces", Price: models.NewMoney(700, "EUR"), Categories: []string{"Small Plates"}},
+		{Name: "Fries", Price: models.NewMoney(450, ""), Categories: []string{"Small Plates"}, Description: "with mayonnaise"},
+		{Name: "House red, glass", Price: models.NewMoney(600, "GBP"), Categories: []string{"Wine"}},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, items)
+	}
+}
@@ -0,0 +1,326 @@
+package menuparser
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI has GPT-4 read the menu, PDFs through the Assistants API and photos through GPT-4 Vision
+type OpenAI struct {
+	client *openai.Client
+}
+
+func NewOpenAI(apiKey string) *OpenAI {
+	return &OpenAI{client: openai.NewClient(apiKey)}
+}
+
+func (p *OpenAI) Parse(ctx context.Context, file File) ([]models.MenuItemV2, error) {
+	var result string
+	var err error
+	switch file.ContentType {
+	case ContentTypePDF:
+		result, err = parseFileUsingGPTAssistant(ctx, p.client, bytes.NewReader(file.Data))
+	case ContentTypeJPEG, ContentTypePNG, ContentTypeWebP:
+		result, err = parseImageUsingGPT4Vision(ctx, p.client, bytes.NewReader(file.Data))
+	default:
+		return nil, ErrUnsupportedContentType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := DecodeItems(result)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		return items, err
+	}
+
+	// Told what's wrong, the model mostly gets it right the second time
+	log.Println(loggerTag, "Repairing the parsed menu:", invalid)
+	repaired, err := p.repair(ctx, result, invalid)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeItems(repaired)
+}
+
+// repair has the model correct its output, in JSON mode so the answer is at least valid JSON
+func (p *OpenAI) repair(ctx context.Context, output string, invalid *ValidationError) (string, error) {
+	problems := make([]string, len(invalid.Problems))
+	for i, problem := range invalid.Problems {
+		problems[i] = "- " + problem.String()
+	}
+
+	result, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:          openai.GPT4TurboPreview,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: repairInstructions},
+			{Role: openai.ChatMessageRoleUser, Content: output},
+			{Role: openai.ChatMessageRoleUser, Content: "These are the problems with it, items are counted from 0:\n" + strings.Join(problems, "\n")},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("the model didn't answer the repair")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+const instructions = `
+		You are a parse for restaurant menus. Your job is to return the categories, items, descriptions and prices.
+		For every item also return its ingredients, allergens and dietary tags when the menu mentions them, and leave them out otherwise.
+		Allergens can only be one of: gluten, crustaceans, eggs, fish, peanuts, soybeans, milk, nuts, celery, mustard, sesame, sulphites, lupin, molluscs.
+		Dietary tags are things like vegan, vegetarian, gluten-free or halal.
+		The menu is in a PDF format, and is attached to this request.
+		The returned message should be just a JSON object, in a valid text/json format.
+		There's no need for any text, explanation, markdown, or anything else besides the JSON.
+		Prices are numbers in the currency of the menu, without the currency symbol.
+		The return format should be JSON matching this JSON schema:
+		` + ItemSchema + `
+		For example:
+		{"items": [
+			{
+				  "name": "Veggie Pizza",
+				  "description": "Stone baked with seasonal vegetables",
+				  "price": 15.99,
+				  "categories": ["Vegetarian", "Pizza", "Main Course"],
+				  "ingredients": ["tomato", "mozzarella", "zucchini", "bell pepper"],
+				  "allergens": ["gluten", "milk"],
+				  "dietary_tags": ["vegetarian"]
+			},
+			{
+				  "name": "Pepperoni Pizza",
+				  "price": 18.99,
+				  "categories": ["Pizza", "Main Course"]
+			}
+		]}
+	`
+
+const repairInstructions = `
+		You fix the output of a restaurant menu parser. The user sends the output and the problems found with it.
+		Answer with the corrected output as a JSON object matching this JSON schema, and nothing else:
+		` + ItemSchema + `
+		Keep everything that's right as it is. Leave out items that aren't on a menu, like addresses or opening hours.
+	`
+
+func uploadFile(ctx context.Context, client *openai.Client, r io.Reader) (string, error) {
+	log.Println(loggerTag, "Uploading file")
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	file, err := client.CreateFileBytes(ctx, openai.FileBytesRequest{
+		Name:    "menu.pdf",
+		Bytes:   buf.Bytes(),
+		Purpose: openai.PurposeAssistants,
+	})
+
+	return file.ID, err
+}
+
+func createAssistant(ctx context.Context, client *openai.Client, fileId string) (string, error) {
+	name := "menu-parser"
+	model := openai.GPT4TurboPreview
+	instructions := instructions
+	log.Println(loggerTag, "Creating assistant")
+	assistant, err := client.CreateAssistant(
+		ctx,
+		openai.AssistantRequest{
+			Model: model,
+			Name:  &name,
+			Tools: []openai.AssistantTool{
+				{
+					Type: openai.AssistantToolTypeRetrieval,
+				},
+			},
+			FileIDs:      []string{fileId},
+			Instructions: &instructions,
+		},
+	)
+
+	return assistant.ID, err
+}
+
+func createThread(ctx context.Context, client *openai.Client) (string, error) {
+	log.Println(loggerTag, "Creating thread")
+	thread, err := client.CreateThread(
+		ctx,
+		openai.ThreadRequest{
+			Messages: []openai.ThreadMessage{
+				{
+					Role:    openai.ThreadMessageRoleUser,
+					Content: "I would like to parse this menu, that is attached to this request.",
+				},
+			},
+		},
+	)
+
+	return thread.ID, err
+}
+
+func runThread(ctx context.Context, client *openai.Client, threadId string, assistantId string) (openai.RunStatus, error) {
+	log.Println(loggerTag, "Running thread")
+	run, err := client.CreateRun(ctx, threadId, openai.RunRequest{
+		AssistantID: assistantId,
+	})
+
+	for run.Status == openai.RunStatusQueued || run.Status == openai.RunStatusInProgress || run.Status == openai.RunStatusCancelling {
+		select {
+		case <-ctx.Done():
+			// Stop paying for a run nobody waits for anymore
+			_, _ = client.CancelRun(context.Background(), threadId, run.ID)
+			return run.Status, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+		log.Println(loggerTag, "Waiting for thread to complete. Status:", run.Status)
+		run, err = client.RetrieveRun(ctx, threadId, run.ID)
+	}
+
+	log.Println(loggerTag, "Thread completed with status:", run.Status)
+
+	return run.Status, err
+}
+
+func getResult(ctx context.Context, client *openai.Client, threadId string) (string, error) {
+	log.Println(loggerTag, "Retrieving result")
+	msgs, err := client.ListMessage(ctx, threadId, nil, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	log.Println(loggerTag, "Message retrieved", msgs)
+	if len(msgs.Messages) == 0 || len(msgs.Messages[0].Content) == 0 || msgs.Messages[0].Content[0].Text == nil {
+		return "", errors.New("the assistant didn't answer")
+	}
+
+	return msgs.Messages[0].Content[0].Text.Value, nil
+}
+
+func cleanup(ctx context.Context, client *openai.Client, assistantId string, fileId string, threadId string) {
+	log.Println(loggerTag, "Cleaning up")
+	// Whatever was created has to go, also when the parse was cancelled
+	ctx = context.Background()
+	if threadId != "" {
+		_, _ = client.DeleteThread(ctx, threadId)
+	}
+
+	if assistantId != "" {
+		_, _ = client.DeleteAssistant(ctx, assistantId)
+	}
+
+	if fileId != "" {
+		_ = client.DeleteFile(ctx, fileId)
+	}
+}
+
+func parseFileUsingGPTAssistant(ctx context.Context, client *openai.Client, r io.Reader) (string, error) {
+	fileId, err := uploadFile(ctx, client, r)
+
+	if err != nil {
+		cleanup(ctx, client, "", fileId, "")
+		return "", err
+	}
+
+	assistantId, err := createAssistant(ctx, client, fileId)
+
+	if err != nil {
+		cleanup(ctx, client, assistantId, fileId, "")
+		return "", err
+	}
+
+	threadId, err := createThread(ctx, client)
+
+	if err != nil {
+		cleanup(ctx, client, assistantId, fileId, threadId)
+		return "", err
+	}
+
+	status, err := runThread(ctx, client, threadId, assistantId)
+
+	if err != nil {
+		cleanup(ctx, client, assistantId, fileId, threadId)
+		return "", err
+	}
+
+	if status != openai.RunStatusCompleted {
+		cleanup(ctx, client, assistantId, fileId, threadId)
+		return "", fmt.Errorf("the assistant run ended %s", status)
+	}
+
+	result, err := getResult(ctx, client, threadId)
+
+	cleanup(ctx, client, assistantId, fileId, threadId)
+	return result, err
+}
+
+func parseImageUsingGPT4Vision(ctx context.Context, client *openai.Client, r io.Reader) (string, error) {
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	imgBase64Str := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	result, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: openai.GPT4VisionPreview,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{
+					{
+						Type: openai.ChatMessagePartTypeText,
+						Text: instructions,
+					},
+					{
+						Type: openai.ChatMessagePartTypeImageURL,
+						ImageURL: &openai.ChatMessageImageURL{
+							URL:    "data:image/jpeg;base64," + imgBase64Str,
+							Detail: openai.ImageURLDetailHigh,
+						},
+					},
+				},
+			},
+		},
+		MaxTokens: 3000,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, choice := range result.Choices {
+		log.Println(loggerTag, "Choice:", choice.Message.Content)
+
+		for _, part := range choice.Message.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				log.Println(loggerTag, "Partial text:", part.Text)
+			}
+		}
+	}
+
+	if len(result.Choices) == 0 {
+		return "", errors.New("the model didn't answer")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,79 @@
+package menuparser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// stubOpenAI answers chat completions with the given answers in turn and keeps the requests
+func stubOpenAI(t *testing.T, answers ...string) (*OpenAI, *[]openai.ChatCompletionRequest) {
+	t.Helper()
+
+	var requests []openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		if len(requests) >= len(answers) {
+			t.Errorf("unexpected request %d", len(requests)+1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		answer := answers[len(requests)]
+		requests = append(requests, request)
+
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("sk-test")
+	config.BaseURL = server.URL + "/v1"
+
+	return &OpenAI{client: openai.NewClientWithConfig(config)}, &requests
+}
+
+var photo = File{Name: "menu.jpg", ContentType: ContentTypeJPEG, Data: []byte{0xff, 0xd8}}
+
+func TestOpenAIRepairsInvalidOutput(t *testing.T) {
+	parser, requests := stubOpenAI(t,
+		`[{"name": "Margherita", "price": -9.5}, {"name": "", "price": 3}]`,
+		`{"items": [{"name": "Margherita", "price": 9.5, "categories": ["PIZZA"]}]}`,
+	)
+
+	items, err := parser.Parse(context.Background(), photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Price.Amount != 950 || items[0].Categories[0] != "Pizza" {
+		t.Fatalf("expected the repaired items, got %+v", items)
+	}
+
+	repair := (*requests)[1]
+	if repair.ResponseFormat == nil || repair.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeJSONObject {
+		t.Fatalf("expected the repair in JSON mode, got %+v", repair.ResponseFormat)
+	}
+	problems := repair.Messages[len(repair.Messages)-1].Content
+	if !strings.Contains(problems, "item 0 price") || !strings.Contains(problems, "item 1 name") {
+		t.Fatalf("expected the problems to be fed back, got %q", problems)
+	}
+}
+
+func TestOpenAIRepairsOnlyOnce(t *testing.T) {
+	parser, requests := stubOpenAI(t, `I can't read this`, `Still can't`)
+
+	_, err := parser.Parse(context.Background(), photo)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(*requests) != 2 {
+		t.Fatalf("expected a ValidationError after one repair, got %v after %d requests", err, len(*requests))
+	}
+}
@@ -0,0 +1,63 @@
+// Package menuparser turns an uploaded menu card into menu items. OpenAI reads PDFs and photos, Local reads the
+// text of PDFs without calling out anywhere, and fake serves fixtures to tests.
+package menuparser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/SaplingPay/server/models"
+)
+
+const loggerTag = "[menu-parser]"
+
+// Content types a menu card can be uploaded as
+const (
+	ContentTypePDF  = "application/pdf"
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+	ContentTypeWebP = "image/webp"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported file type")
+
+// File is an uploaded menu card
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+type MenuParser interface {
+	// Parse returns the items on the menu card, with their categories in Categories
+	Parse(ctx context.Context, file File) ([]models.MenuItemV2, error)
+}
+
+// FromEnv picks the backend named by MENU_PARSER, "openai" or "local". Without it OpenAI is used when
+// OPENAI_API_KEY is set, and the local parser otherwise so menu import keeps working without a key.
+func FromEnv() (MenuParser, error) {
+	backend := os.Getenv("MENU_PARSER")
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if backend == "" {
+		backend = "local"
+		if apiKey != "" {
+			backend = "openai"
+		}
+	}
+
+	log.Println(loggerTag, "Using the", backend, "menu parser")
+	switch backend {
+	case "openai":
+		if apiKey == "" {
+			return nil, errors.New("MENU_PARSER=openai needs OPENAI_API_KEY")
+		}
+		return NewOpenAI(apiKey), nil
+	case "local":
+		return Local{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown MENU_PARSER %q, use openai or local", backend)
+}
@@ -0,0 +1,355 @@
+package menuparser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrNoText = errors.New("the PDF has no text to read, it may be scanned")
+
+var streamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// Streams that hold no page text
+var skippedStreams = []string{"/Image", "/FontFile", "/Length1", "/XRef", "/ObjStm", "/Metadata"}
+
+// pdfText returns the lines of text on the pages of a PDF. It reads content streams that are uncompressed or
+// FlateDecode compressed and fonts with single byte encodings, which covers what menu design tools export.
+func pdfText(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, errors.New("not a PDF")
+	}
+
+	var lines []string
+	for _, match := range streamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[match[2]:match[3]])
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+
+		if skipStream(dict) {
+			continue
+		}
+		if strings.Contains(dict, "/FlateDecode") {
+			inflated, err := inflate(stream)
+			if err != nil {
+				continue
+			}
+			stream = inflated
+		} else if strings.Contains(dict, "/Filter") {
+			// Other filters are used for images, not text
+			continue
+		}
+
+		lines = append(lines, contentText(stream)...)
+	}
+
+	if len(lines) == 0 {
+		return nil, ErrNoText
+	}
+	return lines, nil
+}
+
+func skipStream(dict string) bool {
+	for _, skipped := range skippedStreams {
+		if strings.Contains(dict, skipped) {
+			return true
+		}
+	}
+	return false
+}
+
+func inflate(stream []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Streams end with an end of line that isn't part of the data, which can make the reader complain at the end
+	inflated, err := io.ReadAll(r)
+	if len(inflated) > 0 {
+		return inflated, nil
+	}
+	return nil, err
+}
+
+// contentText runs the text operators of a content stream, starting a new line where the text moves down
+func contentText(content []byte) []string {
+	var lines []string
+	var line strings.Builder
+	newLine := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	var operands []interface{}
+	var lastY float64
+	s := &contentScanner{data: content}
+	for {
+		token, ok := s.next()
+		if !ok {
+			break
+		}
+		operator, isOperator := token.(pdfOperator)
+		if !isOperator {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch operator {
+		case "BT":
+			lastY = 0
+		case "ET", "T*":
+			newLine()
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if number(operands[len(operands)-1]) != 0 {
+					newLine()
+				} else if number(operands[len(operands)-2]) > 0 {
+					line.WriteString(" ")
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y := number(operands[len(operands)-1])
+				if y != lastY {
+					newLine()
+				} else {
+					line.WriteString(" ")
+				}
+				lastY = y
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				line.WriteString(text(operands[len(operands)-1]))
+			}
+		case "'", "\"":
+			newLine()
+			if len(operands) >= 1 {
+				line.WriteString(text(operands[len(operands)-1]))
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if array, ok := operands[len(operands)-1].([]interface{}); ok {
+					for _, element := range array {
+						if n, ok := element.(float64); ok {
+							// Big negative kerning is how some tools put a space between words
+							if n < -200 {
+								line.WriteString(" ")
+							}
+							continue
+						}
+						line.WriteString(text(element))
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	newLine()
+
+	return lines
+}
+
+type pdfOperator string
+
+type pdfString []byte
+
+func number(operand interface{}) float64 {
+	n, _ := operand.(float64)
+	return n
+}
+
+// winAnsi maps the bytes of WinAnsiEncoding that differ from Latin-1 and can turn up on a menu
+var winAnsi = map[byte]rune{0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—'}
+
+func text(operand interface{}) string {
+	str, ok := operand.(pdfString)
+	if !ok {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, c := range str {
+		if r, ok := winAnsi[c]; ok {
+			b.WriteRune(r)
+		} else if c >= 0x20 || c == '\t' {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// contentScanner splits a content stream into numbers, strings, names, arrays and operators
+type contentScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *contentScanner) next() (interface{}, bool) {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return nil, false
+	}
+
+	c := s.data[s.pos]
+	switch {
+	case c == '(':
+		return s.literal(), true
+	case c == '<' && s.peek(1) == '<', c == '>' && s.peek(1) == '>':
+		s.pos += 2
+		return pdfOperator(""), true
+	case c == '<':
+		return s.hex(), true
+	case c == '[':
+		s.pos++
+		var array []interface{}
+		for {
+			s.skipSpace()
+			if s.pos >= len(s.data) || s.data[s.pos] == ']' {
+				s.pos++
+				return array, true
+			}
+			element, ok := s.next()
+			if !ok {
+				return array, true
+			}
+			array = append(array, element)
+		}
+	case c == '/':
+		start := s.pos
+		s.pos++
+		s.word()
+		return string(s.data[start:s.pos]), true
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		start := s.pos
+		s.pos++
+		s.word()
+		n, _ := strconv.ParseFloat(string(s.data[start:s.pos]), 64)
+		return n, true
+	}
+
+	start := s.pos
+	s.word()
+	if s.pos == start {
+		// A delimiter we have no use for
+		s.pos++
+	}
+	return pdfOperator(s.data[start:s.pos]), true
+}
+
+func (s *contentScanner) peek(offset int) byte {
+	if s.pos+offset < len(s.data) {
+		return s.data[s.pos+offset]
+	}
+	return 0
+}
+
+func (s *contentScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\r', '\n', '\f', 0:
+			s.pos++
+		case '%':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' && s.data[s.pos] != '\r' {
+				s.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *contentScanner) word() {
+	for s.pos < len(s.data) && !strings.ContainsRune(" \t\r\n\f\x00()<>[]{}/%", rune(s.data[s.pos])) {
+		s.pos++
+	}
+}
+
+func (s *contentScanner) literal() pdfString {
+	s.pos++
+	var str pdfString
+	depth := 1
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		s.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return str
+			}
+		case '\\':
+			if s.pos >= len(s.data) {
+				return str
+			}
+			escaped := s.data[s.pos]
+			s.pos++
+			switch escaped {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string on the next one
+				if escaped == '\r' && s.peek(0) == '\n' {
+					s.pos++
+				}
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					octal := int(escaped - '0')
+					for i := 0; i < 2 && s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '7'; i++ {
+						octal = octal*8 + int(s.data[s.pos]-'0')
+						s.pos++
+					}
+					c = byte(octal)
+				} else {
+					c = escaped
+				}
+			}
+		}
+		str = append(str, c)
+	}
+	return str
+}
+
+func (s *contentScanner) hex() pdfString {
+	s.pos++
+	var digits []byte
+	for s.pos < len(s.data) && s.data[s.pos] != '>' {
+		if c := s.data[s.pos]; strings.ContainsRune("0123456789abcdefABCDEF", rune(c)) {
+			digits = append(digits, c)
+		}
+		s.pos++
+	}
+	s.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	str := make(pdfString, len(digits)/2)
+	for i := range str {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		str[i] = byte(n)
+	}
+	return str
+}
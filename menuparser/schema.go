@@ -0,0 +1,167 @@
+package menuparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/SaplingPay/server/models"
+)
+
+// ItemSchema is the JSON schema the language models are asked to answer in, ValidateItems holds the items to it
+const ItemSchema = `{
+	"type": "object",
+	"required": ["items"],
+	"properties": {
+		"items": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"required": ["name", "price", "categories"],
+				"properties": {
+					"name": {"type": "string", "minLength": 1, "maxLength": 200},
+					"description": {"type": "string", "maxLength": 1000},
+					"price": {"type": "number", "minimum": 0, "maximum": 10000},
+					"categories": {"type": "array", "items": {"type": "string", "minLength": 1}},
+					"ingredients": {"type": "array", "items": {"type": "string"}},
+					"allergens": {"type": "array", "items": {"enum": ["gluten", "crustaceans", "eggs", "fish", "peanuts", "soybeans", "milk", "nuts", "celery", "mustard", "sesame", "sulphites", "lupin", "molluscs"]}},
+					"dietary_tags": {"type": "array", "items": {"type": "string"}}
+				}
+			}
+		}
+	}
+}`
+
+// Limits of ItemSchema, prices in minor units
+const (
+	maxItemNameLength = 200
+	maxParsedPrice    = 1000000
+)
+
+// ValidationError is parser output that doesn't hold to ItemSchema
+type ValidationError struct {
+	Problems []models.ParseProblem
+}
+
+func (err *ValidationError) Error() string {
+	problems := make([]string, len(err.Problems))
+	for i, problem := range err.Problems {
+		problems[i] = problem.String()
+	}
+	return "the parsed menu is invalid: " + strings.Join(problems, "; ")
+}
+
+// DecodeItems reads the items a language model answers with, as a bare array or as the object of ItemSchema. The
+// answer tends to come in a markdown fence. Output that isn't valid is a *ValidationError.
+func DecodeItems(raw string) ([]models.MenuItemV2, error) {
+	raw = strings.ReplaceAll(raw, "```json", "")
+	raw = strings.ReplaceAll(raw, "```", "")
+	data := bytes.TrimSpace([]byte(raw))
+
+	var elements []json.RawMessage
+	if bytes.HasPrefix(data, []byte("{")) {
+		var output struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(data, &output); err != nil {
+			return nil, invalid(-1, "", "not valid JSON: "+err.Error())
+		}
+		elements = output.Items
+	} else if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, invalid(-1, "", "not a JSON array or object of items: "+err.Error())
+	}
+
+	var problems []models.ParseProblem
+	items := make([]models.MenuItemV2, len(elements))
+	for i, element := range elements {
+		if err := json.Unmarshal(element, &items[i]); err != nil {
+			problems = append(problems, models.ParseProblem{Item: i, Field: invalidField(element), Message: err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return ValidateItems(items)
+}
+
+// ValidateItems holds the items to ItemSchema, tidying up their names and categories on the way
+func ValidateItems(items []models.MenuItemV2) ([]models.MenuItemV2, error) {
+	if len(items) == 0 {
+		return nil, invalid(-1, "", "no items were found on the menu card")
+	}
+
+	var problems []models.ParseProblem
+	for i := range items {
+		item := &items[i]
+
+		item.Name = strings.Join(strings.Fields(item.Name), " ")
+		if item.Name == "" {
+			problems = append(problems, models.ParseProblem{Item: i, Field: "name", Message: "must not be empty"})
+		} else if len(item.Name) > maxItemNameLength {
+			problems = append(problems, models.ParseProblem{Item: i, Field: "name", Message: fmt.Sprintf("is longer than %d characters", maxItemNameLength)})
+		}
+
+		if item.Price.Amount < 0 {
+			problems = append(problems, models.ParseProblem{Item: i, Field: "price", Message: "must not be negative"})
+		} else if item.Price.Amount > maxParsedPrice {
+			problems = append(problems, models.ParseProblem{Item: i, Field: "price", Message: fmt.Sprintf("%s is more than anything on a menu costs", item.Price)})
+		}
+
+		categories := []string{}
+		seen := map[string]bool{}
+		for _, category := range item.Categories {
+			category = normalizeCategory(category)
+			if category != "" && !seen[strings.ToLower(category)] {
+				seen[strings.ToLower(category)] = true
+				categories = append(categories, category)
+			}
+		}
+		item.Categories = categories
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return items, nil
+}
+
+// normalizeCategory turns "PIZZA:" and " main  courses" into "Pizza" and "Main Courses", mixed case stays as it is
+func normalizeCategory(name string) string {
+	name = strings.Join(strings.Fields(strings.TrimSpace(name)), " ")
+	name = strings.TrimSpace(strings.TrimSuffix(name, ":"))
+	if name != strings.ToUpper(name) && name != strings.ToLower(name) {
+		return name
+	}
+
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// invalidField finds the field of an item that doesn't decode, by decoding them one at a time
+func invalidField(element json.RawMessage) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(element, &fields); err != nil {
+		return ""
+	}
+	for name, value := range fields {
+		single, _ := json.Marshal(map[string]json.RawMessage{name: value})
+		var item models.MenuItemV2
+		if err := json.Unmarshal(single, &item); err != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func invalid(item int, field string, message string) *ValidationError {
+	return &ValidationError{Problems: []models.ParseProblem{{Item: item, Field: field, Message: message}}}
+}
@@ -0,0 +1,55 @@
+package menuparser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+)
+
+func TestDecodeItems(t *testing.T) {
+	expected := []models.MenuItemV2{
+		{Name: "Margherita", Price: models.NewMoney(950, "EUR"), Categories: []string{"Pizza", "Main Courses"}},
+	}
+
+	for _, raw := range []string{
+		"```json\n[{\"name\": \" Margherita \", \"price\": 9.5, \"categories\": [\"PIZZA:\", \"main  courses\", \"Pizza\", \" \"]}]\n```",
+		`{"items": [{"name": "Margherita", "price": 9.5, "categories": ["pizza", "Main Courses"]}]}`,
+	} {
+		items, err := DecodeItems(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(items, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, items)
+		}
+	}
+}
+
+func TestDecodeItemsRejectsInvalidOutput(t *testing.T) {
+	tests := map[string][]models.ParseProblem{
+		`Sorry, I can't read this menu`: {{Item: -1}},
+		`{"items": []}`:                 {{Item: -1}},
+		`[{"name": "Cola", "price": 3}, {"name": "Fanta", "price": "3,00"}]`: {{Item: 1, Field: "price"}},
+		`[{"name": " ", "price": 3}, {"name": "Cola", "price": -3}, {"name": "Water", "price": 25000}]`: {
+			{Item: 0, Field: "name"}, {Item: 1, Field: "price"}, {Item: 2, Field: "price"},
+		},
+	}
+
+	for raw, expected := range tests {
+		_, err := DecodeItems(raw)
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("expected a ValidationError for %s, got %v", raw, err)
+		}
+		if len(invalid.Problems) != len(expected) {
+			t.Fatalf("expected %d problems with %s, got %v", len(expected), raw, invalid)
+		}
+		for i, problem := range invalid.Problems {
+			if problem.Item != expected[i].Item || problem.Field != expected[i].Field || problem.Message == "" {
+				t.Fatalf("expected a problem with item %d %s, got %+v", expected[i].Item, expected[i].Field, problem)
+			}
+		}
+	}
+}
@@ -38,7 +38,10 @@ func GetToken(c *gin.Context) {
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		bearerToken := c.Request.Header.Get("Authorization")
-		log.Println(bearerToken)
+		// A browser EventSource can't set headers, event streams may pass the token as a query parameter
+		if bearerToken == "" && c.Query("token") != "" && strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			bearerToken = "Bearer " + c.Query("token")
+		}
 		if bearerToken == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"message": "unauthorized",
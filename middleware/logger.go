@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Logger is gin's request logger, except the token event streams may pass in the query is left out
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		statusColor, methodColor, resetColor := "", "", ""
+		if param.IsOutputColor() {
+			statusColor, methodColor, resetColor = param.StatusCodeColor(), param.MethodColor(), param.ResetColor()
+		}
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, param.StatusCode, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			redactToken(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+func redactToken(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		path, _, _ = strings.Cut(path, "?")
+		return path
+	}
+	query := u.Query()
+	if !query.Has("token") {
+		return path
+	}
+	query.Set("token", "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
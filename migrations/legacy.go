@@ -0,0 +1,248 @@
+package migrations
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const legacyTag = "[migrate-legacy]"
+
+// legacyUser is a V1 user, the app's user ID is in "id" while "_id" is Mongo's own
+type legacyUser struct {
+	ObjectID primitive.ObjectID `bson:"_id"`
+	UserID   string             `bson:"id"`
+	Role     string             `bson:"role"`
+	Name     string             `bson:"name"`
+	Email    string             `bson:"email"`
+}
+
+// MigrateLegacy copies V1 menus into a venue with a MenuV2 each, and V1 users into usersV2. V1 documents are left
+// untouched and every copy remembers what it came from, so a run that was interrupted can simply be started again.
+func MigrateLegacy(ctx context.Context, dryRun bool) (Report, error) {
+	report := Report{Name: "legacy", DryRun: dryRun}
+
+	if err := migrateLegacyMenus(ctx, dryRun, &report); err != nil {
+		return report, err
+	}
+	if err := migrateLegacyUsers(ctx, dryRun, &report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// A V1 menu carries its own name, location and banner, so each one becomes a venue of its own
+func migrateLegacyMenus(ctx context.Context, dryRun bool, report *Report) error {
+	cursor, err := db.DB.Collection(db.CollectionNameMenus).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	for cursor.Next(ctx) {
+		var menu models.Menu
+		if err := cursor.Decode(&menu); err != nil {
+			return err
+		}
+
+		migrated, err := db.DB.Collection(db.CollectionNameMenuV2).CountDocuments(ctx, bson.M{"legacy_menu_id": menu.ID})
+		if err != nil {
+			return err
+		}
+		if migrated > 0 {
+			report.Skip(db.CollectionNameMenus, 1)
+			continue
+		}
+
+		menuV2 := convertLegacyMenu(menu, now, report)
+		if dryRun {
+			report.Add(db.CollectionNameVenue, 1)
+			report.Add(db.CollectionNameMenuV2, 1)
+			continue
+		}
+
+		// The venue may be left over from an interrupted run, then the menu gets the ID the venue already points to.
+		// Inserting the menu is what marks the V1 menu as done.
+		venue, err := upsertLegacyVenue(ctx, menu, menuV2)
+		if err != nil {
+			return err
+		}
+		menuV2.ID = venue.MenuID
+		menuV2.VenueID = venue.ID
+
+		if _, err := db.DB.Collection(db.CollectionNameMenuV2).InsertOne(ctx, menuV2); err != nil {
+			return err
+		}
+
+		log.Println(legacyTag, "menu", menu.ID.Hex(), "migrated to venue", venue.ID.Hex(), "menu", menuV2.ID.Hex())
+		report.Add(db.CollectionNameVenue, 1)
+		report.Add(db.CollectionNameMenuV2, 1)
+	}
+
+	return cursor.Err()
+}
+
+func upsertLegacyVenue(ctx context.Context, menu models.Menu, menuV2 models.MenuV2) (models.Venue, error) {
+	venue := bson.M{
+		"_id":                primitive.NewObjectID(),
+		"name":               menu.Name,
+		"location":           models.Location{Address: menu.Location},
+		"profile_pic_url":    menu.BannerURL,
+		"menu_id":            menuV2.ID,
+		"menu_ids":           []primitive.ObjectID{menuV2.ID},
+		"ordering_supported": false,
+		"legacy_menu_id":     menu.ID,
+		"legacy_user_id":     menu.UserID,
+	}
+	if menuV2.DeletedAt != nil {
+		venue["deleted_at"] = menuV2.DeletedAt
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved models.Venue
+	err := db.DB.Collection(db.CollectionNameVenue).FindOneAndUpdate(ctx, bson.M{"legacy_menu_id": menu.ID}, bson.M{"$setOnInsert": venue}, opts).Decode(&saved)
+
+	return saved, err
+}
+
+func convertLegacyMenu(menu models.Menu, now primitive.DateTime, report *Report) models.MenuV2 {
+	menuV2 := models.MenuV2{
+		ID:            primitive.NewObjectID(),
+		Name:          menu.Name,
+		Items:         make([]models.MenuItemV2, 0, len(menu.Items)),
+		CategoryOrder: menu.CategoryOrder,
+		LegacyMenuID:  menu.ID,
+	}
+	if menuV2.CategoryOrder == nil {
+		menuV2.CategoryOrder = []string{}
+	}
+	if menu.Archived {
+		menuV2.DeletedAt = &now
+	}
+
+	for _, item := range menu.Items {
+		menuV2.Items = append(menuV2.Items, convertLegacyItem(menu, item, now, report))
+	}
+
+	return menuV2
+}
+
+func convertLegacyItem(menu models.Menu, item models.MenuItem, now primitive.DateTime, report *Report) models.MenuItemV2 {
+	itemV2 := models.MenuItemV2{
+		ID:          item.ID,
+		Name:        item.Name,
+		Price:       models.MoneyFromFloat(item.Price, models.DefaultCurrency),
+		Description: item.Description,
+		Categories:  item.Categories,
+		Ingredients: item.Ingredients,
+		Allergens:   []models.Allergen{},
+		DietaryTags: item.DietaryRestrictions,
+		ImageURL:    item.ImageURL,
+		Blurhash:    item.Blurhash,
+	}
+	if itemV2.ID.IsZero() {
+		itemV2.ID = primitive.NewObjectID()
+	}
+	if item.Archived {
+		itemV2.DeletedAt = &now
+	}
+
+	for _, name := range item.Allergens {
+		allergen, ok := models.ParseAllergen(name)
+		if !ok {
+			report.Note("menu %s item %q: dropped unknown allergen %q", menu.ID.Hex(), item.Name, name)
+			continue
+		}
+		itemV2.Allergens = append(itemV2.Allergens, allergen)
+	}
+
+	// V1 customizations were free choices without a price, they become one optional group of free options
+	if len(item.Customizations) > 0 {
+		group := models.ModifierGroup{Name: "Customizations"}
+		for _, customization := range item.Customizations {
+			group.Options = append(group.Options, models.ModifierOption{Name: customization})
+		}
+		itemV2.ModifierGroups = []models.ModifierGroup{group}
+	}
+
+	if err := itemV2.Prepare(); err != nil {
+		report.Note("menu %s item %q: %v, details dropped", menu.ID.Hex(), item.Name, err)
+		itemV2.Description = ""
+		itemV2.Ingredients = nil
+		itemV2.DietaryTags = nil
+		itemV2.ImageURL = ""
+		itemV2.Blurhash = models.BlurhashData{}
+		itemV2.ModifierGroups = nil
+	}
+	if item.OnOverview {
+		report.Note("menu %s item %q: on_overview has no V2 equivalent and isn't carried over", menu.ID.Hex(), item.Name)
+	}
+
+	return itemV2
+}
+
+func migrateLegacyUsers(ctx context.Context, dryRun bool, report *Report) error {
+	cursor, err := db.DB.Collection(db.CollectionNameUsers).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user legacyUser
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		// Users that already signed in with V2 keep their V2 profile
+		filter := bson.M{"$or": bson.A{bson.M{"legacy_user_id": user.ObjectID}, bson.M{"user_id": user.UserID}}}
+		if user.UserID == "" {
+			filter = bson.M{"legacy_user_id": user.ObjectID}
+		}
+		existing, err := db.DB.Collection(db.CollectionNameUserV2).CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			report.Skip(db.CollectionNameUsers, 1)
+			continue
+		}
+
+		if dryRun {
+			report.Add(db.CollectionNameUserV2, 1)
+			continue
+		}
+
+		userV2 := models.UserV2{
+			ID:           primitive.NewObjectID(),
+			UserID:       user.UserID,
+			DisplayName:  user.Name,
+			Email:        user.Email,
+			Saves:        []models.Save{},
+			Followers:    []primitive.ObjectID{},
+			Following:    []primitive.ObjectID{},
+			LegacyUserID: user.ObjectID,
+		}
+		if _, err := db.DB.Collection(db.CollectionNameUserV2).InsertOne(ctx, userV2); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				report.Skip(db.CollectionNameUsers, 1)
+				continue
+			}
+			return err
+		}
+		report.Add(db.CollectionNameUserV2, 1)
+	}
+
+	return cursor.Err()
+}
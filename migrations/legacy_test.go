@@ -0,0 +1,176 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestConvertLegacyItem(t *testing.T) {
+	menu := models.Menu{ID: primitive.NewObjectID(), Name: "Trattoria"}
+	item := models.MenuItem{
+		Name:           "Pizza",
+		Price:          19.99,
+		Allergens:      []string{"Gluten", "dairy", "pineapple"},
+		Customizations: []string{"No onions", "Extra cheese"},
+	}
+
+	var report Report
+	converted := convertLegacyItem(menu, item, primitive.NewDateTimeFromTime(time.Now()), &report)
+
+	if converted.ID.IsZero() || converted.Price != models.NewMoney(1999, "EUR") {
+		t.Fatalf("unexpected item %+v", converted)
+	}
+	if len(converted.Allergens) != 2 || converted.Allergens[0] != models.AllergenGluten || converted.Allergens[1] != models.AllergenMilk {
+		t.Fatalf("expected gluten and milk, got %v", converted.Allergens)
+	}
+	if len(report.Notes) != 1 || !strings.Contains(report.Notes[0], `"pineapple"`) {
+		t.Fatalf("expected a note about the unknown allergen, got %v", report.Notes)
+	}
+
+	// Customizations become one optional group of free options
+	if len(converted.ModifierGroups) != 1 {
+		t.Fatalf("expected one modifier group, got %+v", converted.ModifierGroups)
+	}
+	group := converted.ModifierGroups[0]
+	if group.ID.IsZero() || group.Name != "Customizations" || group.MinSelections != 0 || group.MaxSelections != 0 || len(group.Options) != 2 {
+		t.Fatalf("unexpected modifier group %+v", group)
+	}
+	for i, name := range item.Customizations {
+		option := group.Options[i]
+		if option.ID.IsZero() || option.Name != name || option.PriceDelta != models.NewMoney(0, "EUR") {
+			t.Fatalf("unexpected option %+v", option)
+		}
+	}
+
+	// Nothing to declare or choose stays empty
+	converted = convertLegacyItem(menu, models.MenuItem{Name: "Soda", Price: 3}, primitive.NewDateTimeFromTime(time.Now()), &report)
+	if converted.Allergens == nil || len(converted.Allergens) != 0 || converted.ModifierGroups != nil {
+		t.Fatalf("unexpected item %+v", converted)
+	}
+}
+
+// document turns a model into what a mocked server sends back
+func document(t *testing.T, value interface{}) bson.D {
+	data, err := bson.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// commands lists the names of the commands sent to the mocked server
+func commands(mt *mtest.T) []string {
+	var names []string
+	for _, started := range mt.GetAllStartedEvents() {
+		names = append(names, started.CommandName)
+	}
+	return names
+}
+
+// count is the response to a CountDocuments
+func count(mt *mtest.T, n int) bson.D {
+	if n == 0 {
+		return mtest.CreateCursorResponse(0, mt.DB.Name()+".any", mtest.FirstBatch)
+	}
+	return mtest.CreateCursorResponse(0, mt.DB.Name()+".any", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+}
+
+func TestMigrateLegacyRerun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("skips what was migrated", func(mt *mtest.T) {
+		db.DB = mt.DB
+		menu := models.Menu{ID: primitive.NewObjectID(), Name: "Trattoria", Items: []models.MenuItem{{Name: "Pizza", Price: 12.5}}}
+		user := legacyUser{ObjectID: primitive.NewObjectID(), UserID: "user-1", Name: "Anna"}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+db.CollectionNameMenus, mtest.FirstBatch, document(t, menu)),
+			count(mt, 1),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+db.CollectionNameUsers, mtest.FirstBatch, document(t, user)),
+			count(mt, 1),
+		)
+
+		report, err := MigrateLegacy(mt.Context(), false)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if len(report.Collections) != 0 || report.Skipped[db.CollectionNameMenus] != 1 || report.Skipped[db.CollectionNameUsers] != 1 {
+			mt.Fatalf("expected everything skipped, got %+v", report)
+		}
+		if names := commands(mt); strings.Join(names, " ") != "find aggregate find aggregate" {
+			mt.Fatalf("expected only reads, got %v", names)
+		}
+	})
+}
+
+func TestMigrateLegacyInterrupted(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("picks up the venue and users left behind", func(mt *mtest.T) {
+		db.DB = mt.DB
+		menu := models.Menu{ID: primitive.NewObjectID(), Name: "Trattoria", Items: []models.MenuItem{{Name: "Pizza", Price: 12.5}}}
+		// The venue was created before the run stopped, its menu wasn't
+		venue := models.Venue{ID: primitive.NewObjectID(), Name: "Trattoria", MenuID: primitive.NewObjectID()}
+		users := []legacyUser{
+			{ObjectID: primitive.NewObjectID(), UserID: "user-1", Name: "Anna"},
+			{ObjectID: primitive.NewObjectID(), UserID: "user-2", Name: "Ben"},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+db.CollectionNameMenus, mtest.FirstBatch, document(t, menu)),
+			count(mt, 0),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: document(t, venue)}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+db.CollectionNameUsers, mtest.FirstBatch, document(t, users[0]), document(t, users[1])),
+			count(mt, 0),
+			mtest.CreateSuccessResponse(),
+			// The second user was inserted by a run racing this one
+			count(mt, 0),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+		)
+
+		report, err := MigrateLegacy(mt.Context(), false)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if report.Collections[db.CollectionNameVenue] != 1 || report.Collections[db.CollectionNameMenuV2] != 1 || report.Collections[db.CollectionNameUserV2] != 1 || report.Skipped[db.CollectionNameUsers] != 1 {
+			mt.Fatalf("unexpected report %+v", report)
+		}
+
+		var upsert, insert bson.Raw
+		for _, started := range mt.GetAllStartedEvents() {
+			if started.CommandName == "findAndModify" {
+				upsert = started.Command
+			}
+			if started.CommandName == "insert" && insert == nil {
+				insert = started.Command
+			}
+		}
+		if upsert == nil || insert == nil {
+			mt.Fatalf("expected the venue upserted and the menu inserted, got %v", commands(mt))
+		}
+
+		// The venue is looked up by the V1 menu and only written if it isn't there
+		if !upsert.Lookup("upsert").Boolean() || upsert.Lookup("query", "legacy_menu_id").ObjectID() != menu.ID || upsert.Lookup("update", "$setOnInsert").Type != bson.TypeEmbeddedDocument {
+			mt.Fatalf("unexpected venue upsert %s", upsert)
+		}
+
+		// The menu gets the ID the venue already points to
+		var inserted models.MenuV2
+		if err := bson.Unmarshal(insert.Lookup("documents", "0").Document(), &inserted); err != nil {
+			mt.Fatal(err)
+		}
+		if inserted.ID != venue.MenuID || inserted.VenueID != venue.ID || inserted.LegacyMenuID != menu.ID || len(inserted.Items) != 1 {
+			mt.Fatalf("unexpected menu %+v", inserted)
+		}
+	})
+}
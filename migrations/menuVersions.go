@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateMenuVersions records menus from before versioning as their first version, so there's something to diff
+// against and roll back to. Menus that have a version are skipped, which makes it safe to run again.
+func MigrateMenuVersions(ctx context.Context, dryRun bool) (Report, error) {
+	report := Report{Name: "menu-versions", DryRun: dryRun}
+
+	filter := bson.M{"$or": []bson.M{{"version": bson.M{"$exists": false}}, {"version": 0}}}
+	cursor, err := db.DB.Collection(db.CollectionNameMenuV2).Find(ctx, filter)
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var menu models.MenuV2
+		if err := cursor.Decode(&menu); err != nil {
+			return report, err
+		}
+
+		report.Add(db.CollectionNameMenuV2, 1)
+		report.Add(db.CollectionNameMenuVersions, 1)
+		if dryRun {
+			continue
+		}
+
+		// Setting the version is what marks the menu as done, so it goes last. A version left over from an
+		// interrupted run is kept.
+		menu.Version = 1
+		version := bson.M{"$setOnInsert": models.NewMenuVersion(menu, models.MenuChangeCreated)}
+		versionFilter := bson.M{"menu_id": menu.ID, "version": 1}
+		if _, err := db.DB.Collection(db.CollectionNameMenuVersions).UpdateOne(ctx, versionFilter, version, options.Update().SetUpsert(true)); err != nil {
+			return report, err
+		}
+		menuFilter := bson.M{"_id": menu.ID, "$or": filter["$or"]}
+		if _, err := db.DB.Collection(db.CollectionNameMenuV2).UpdateOne(ctx, menuFilter, bson.M{"$set": bson.M{"version": 1}}); err != nil {
+			return report, err
+		}
+		log.Println("[migrate-menu-versions] menu", menu.ID.Hex(), "is version 1")
+	}
+
+	return report, cursor.Err()
+}
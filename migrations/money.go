@@ -0,0 +1,99 @@
+package migrations
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// moneyFields lists the amounts that used to be stored as float64 in major units, per collection.
+// Fields inside an array of subdocuments are given as "array.field".
+var moneyFields = map[string][]string{
+	db.CollectionNameMenuV2:   {"items.price"},
+	db.CollectionNameOrders:   {"total", "items.price"},
+	db.CollectionNamePayments: {"amount", "refunded_amount"},
+	db.CollectionNameRefunds:  {"amount", "items.amount"},
+}
+
+// MigrateMoney rewrites float amounts into models.Money subdocuments in minor units. Only numeric fields are
+// touched so it can safely be run again, and with dryRun it only counts the documents it would change.
+func MigrateMoney(ctx context.Context, dryRun bool) (Report, error) {
+	report := Report{Name: "money", DryRun: dryRun}
+
+	for collection, fields := range moneyFields {
+		filter := numericFieldsFilter(fields)
+
+		if dryRun {
+			count, err := db.DB.Collection(collection).CountDocuments(ctx, filter)
+			if err != nil {
+				return report, err
+			}
+			report.Add(collection, count)
+			continue
+		}
+
+		result, err := db.DB.Collection(collection).UpdateMany(ctx, filter, mongo.Pipeline{moneyStage(fields)})
+		if err != nil {
+			return report, err
+		}
+		log.Println("[migrate-money]", collection, "converted", result.ModifiedCount)
+		report.Add(collection, result.ModifiedCount)
+	}
+
+	return report, nil
+}
+
+func numericFieldsFilter(fields []string) bson.M {
+	var or []bson.M
+	for _, field := range fields {
+		or = append(or, bson.M{field: bson.M{"$type": "number"}})
+	}
+	return bson.M{"$or": or}
+}
+
+// moneyStage builds a $set stage that converts every numeric field to {amount, currency}
+func moneyStage(fields []string) bson.D {
+	set := bson.M{}
+	arrays := map[string][]string{}
+
+	for _, field := range fields {
+		if array, sub, nested := strings.Cut(field, "."); nested {
+			arrays[array] = append(arrays[array], sub)
+			continue
+		}
+		set[field] = toMoney("$" + field)
+	}
+
+	for array, subs := range arrays {
+		converted := bson.M{}
+		for _, sub := range subs {
+			converted[sub] = toMoney("$$this." + sub)
+		}
+		set[array] = bson.M{"$cond": bson.A{
+			bson.M{"$isArray": "$" + array},
+			bson.M{"$map": bson.M{
+				"input": "$" + array,
+				"in":    bson.M{"$mergeObjects": bson.A{"$$this", converted}},
+			}},
+			"$" + array,
+		}}
+	}
+
+	return bson.D{{Key: "$set", Value: set}}
+}
+
+func toMoney(path string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$isNumber": path},
+		bson.M{
+			"amount":   bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{path, 100}}, 0}}},
+			"currency": models.DefaultCurrency,
+		},
+		path,
+	}}
+}
@@ -0,0 +1,206 @@
+package migrations
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// evaluate runs the aggregation expressions moneyStage builds the way MongoDB does, there's no server in tests
+func evaluate(t *testing.T, expr interface{}, doc bson.M, this bson.M) interface{} {
+	switch e := expr.(type) {
+	case string:
+		if e == "$$this" {
+			return this
+		}
+		if strings.HasPrefix(e, "$$this.") {
+			return this[strings.TrimPrefix(e, "$$this.")]
+		}
+		if strings.HasPrefix(e, "$") {
+			return doc[strings.TrimPrefix(e, "$")]
+		}
+		return e
+	case bson.M:
+		for op, arg := range e {
+			if len(e) == 1 && strings.HasPrefix(op, "$") {
+				return evaluateOperator(t, op, arg, doc, this)
+			}
+		}
+		object := bson.M{}
+		for key, value := range e {
+			object[key] = evaluate(t, value, doc, this)
+		}
+		return object
+	}
+	return expr
+}
+
+func evaluateOperator(t *testing.T, op string, arg interface{}, doc bson.M, this bson.M) interface{} {
+	switch op {
+	case "$cond":
+		args := arg.(bson.A)
+		if evaluate(t, args[0], doc, this).(bool) {
+			return evaluate(t, args[1], doc, this)
+		}
+		return evaluate(t, args[2], doc, this)
+	case "$isNumber":
+		switch evaluate(t, arg, doc, this).(type) {
+		case float64, int32, int64:
+			return true
+		}
+		return false
+	case "$isArray":
+		_, ok := evaluate(t, arg, doc, this).(bson.A)
+		return ok
+	case "$map":
+		args := arg.(bson.M)
+		mapped := bson.A{}
+		for _, element := range evaluate(t, args["input"], doc, this).(bson.A) {
+			mapped = append(mapped, evaluate(t, args["in"], doc, element.(bson.M)))
+		}
+		return mapped
+	case "$mergeObjects":
+		merged := bson.M{}
+		for _, object := range arg.(bson.A) {
+			for key, value := range evaluate(t, object, doc, this).(bson.M) {
+				merged[key] = value
+			}
+		}
+		return merged
+	case "$multiply":
+		args := arg.(bson.A)
+		a, b := evaluate(t, args[0], doc, this), evaluate(t, args[1], doc, this)
+		if x, ok := a.(float64); ok {
+			return x * float64(b.(int))
+		}
+		return toInt64(t, a) * int64(b.(int))
+	case "$round":
+		// MongoDB rounds half to even
+		if x, ok := evaluate(t, arg.(bson.A)[0], doc, this).(float64); ok {
+			return math.RoundToEven(x)
+		}
+		return evaluate(t, arg.(bson.A)[0], doc, this)
+	case "$toLong":
+		value := evaluate(t, arg, doc, this)
+		if x, ok := value.(float64); ok {
+			return int64(x)
+		}
+		return toInt64(t, value)
+	}
+	t.Fatalf("unexpected operator %s", op)
+	return nil
+}
+
+func toInt64(t *testing.T, value interface{}) int64 {
+	switch v := value.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	}
+	t.Fatalf("expected an integer, got %T", value)
+	return 0
+}
+
+func TestMoneyStage(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		order bson.M
+		total int64
+		items []int64
+	}{
+		// 19.99 * 100 is 1998.9999999999998 as a double, truncating it would lose a cent
+		{"double", bson.M{"total": 19.99, "items": bson.A{bson.M{"price": 19.99}}}, 1999, []int64{1999}},
+		{"int32", bson.M{"total": int32(20), "items": bson.A{bson.M{"price": int32(20)}}}, 2000, []int64{2000}},
+		{"int64", bson.M{"total": int64(7), "items": bson.A{bson.M{"price": 0.1}, bson.M{"price": int64(7)}}}, 700, []int64{10, 700}},
+		{"migrated", bson.M{"total": bson.M{"amount": int64(1999), "currency": "EUR"}, "items": bson.A{bson.M{"price": bson.M{"amount": int64(1999), "currency": "EUR"}}}}, 1999, []int64{1999}},
+		{"no items", bson.M{"total": 4.5}, 450, nil},
+	} {
+		before := roundTrip(t, test.order)
+		after := bson.M{}
+		for key, value := range before {
+			after[key] = value
+		}
+		set := moneyStage(moneyFields[db.CollectionNameOrders])[0].Value.(bson.M)
+		for field, expr := range set {
+			after[field] = evaluate(t, expr, before, nil)
+		}
+
+		migrated := decodeOrder(t, after)
+		if migrated.Total != models.NewMoney(test.total, "EUR") || len(migrated.Items) != len(test.items) {
+			t.Fatalf("%s: unexpected migrated order %+v", test.name, migrated)
+		}
+		for i, amount := range test.items {
+			if migrated.Items[i].Price != models.NewMoney(amount, "EUR") {
+				t.Fatalf("%s: expected item %d to be %d, got %s", test.name, i, amount, migrated.Items[i].Price)
+			}
+		}
+
+		// Reading the order before it's migrated gives the same amounts
+		if unmigrated := decodeOrder(t, before); unmigrated.Total != migrated.Total {
+			t.Fatalf("%s: read %s before the migration and %s after", test.name, unmigrated.Total, migrated.Total)
+		}
+	}
+}
+
+// roundTrip gives the document the types the driver decodes it with
+func roundTrip(t *testing.T, doc bson.M) bson.M {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded bson.M
+	if err := bson.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func decodeOrder(t *testing.T, doc bson.M) models.Order {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order models.Order
+	if err := bson.Unmarshal(data, &order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestMigrateMoneyDryRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("counts", func(mt *mtest.T) {
+		db.DB = mt.DB
+		for range moneyFields {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".any", mtest.FirstBatch, bson.D{{Key: "n", Value: 2}}))
+		}
+
+		report, err := MigrateMoney(mt.Context(), true)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		for collection := range moneyFields {
+			if report.Collections[collection] != 2 {
+				mt.Fatalf("expected 2 documents in %s, got %+v", collection, report.Collections)
+			}
+		}
+
+		// Only counted, nothing written
+		names := commands(mt)
+		if len(names) != len(moneyFields) {
+			mt.Fatalf("expected a count per collection, got %v", names)
+		}
+		for _, name := range names {
+			if name != "aggregate" {
+				mt.Fatalf("unexpected %s command on a dry run", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Report is what a migration changed, or would change on a dry run, per collection
+type Report struct {
+	Name        string           `json:"name"`
+	DryRun      bool             `json:"dry_run"`
+	Collections map[string]int64 `json:"collections"`
+	Skipped     map[string]int64 `json:"skipped,omitempty"` // documents left alone because they were migrated before
+	Notes       []string         `json:"notes,omitempty"`
+}
+
+func (r *Report) Add(collection string, count int64) {
+	if r.Collections == nil {
+		r.Collections = map[string]int64{}
+	}
+	r.Collections[collection] += count
+}
+
+func (r *Report) Skip(collection string, count int64) {
+	if r.Skipped == nil {
+		r.Skipped = map[string]int64{}
+	}
+	r.Skipped[collection] += count
+}
+
+func (r *Report) Note(format string, args ...interface{}) {
+	r.Notes = append(r.Notes, fmt.Sprintf(format, args...))
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	verb := "changed"
+	if r.DryRun {
+		verb = "would change"
+	}
+	fmt.Fprintf(&b, "%s:\n", r.Name)
+	for collection, count := range r.Collections {
+		fmt.Fprintf(&b, "  %s %s %d documents\n", collection, verb, count)
+	}
+	for collection, count := range r.Skipped {
+		fmt.Fprintf(&b, "  %s skipped %d documents, already migrated\n", collection, count)
+	}
+	for _, note := range r.Notes {
+		fmt.Fprintf(&b, "  %s\n", note)
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateStripeLinks moves Stripe accounts linked before venue_id, under venueId, to venue_id and puts the account
+// on the venue, which is where checkout reads it. Only accounts still having venueId are touched, which makes it
+// safe to run again.
+func MigrateStripeLinks(ctx context.Context, dryRun bool) (Report, error) {
+	report := Report{Name: "stripe-links", DryRun: dryRun}
+
+	cursor, err := db.DB.Collection(db.CollectionNameStripeAccounts).Find(ctx, bson.M{"venueId": bson.M{"$exists": true}})
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	venues := db.DB.Collection(db.CollectionNameVenue)
+	accounts := db.DB.Collection(db.CollectionNameStripeAccounts)
+	for cursor.Next(ctx) {
+		var account models.StripeAccount
+		if err := cursor.Decode(&account); err != nil {
+			return report, err
+		}
+
+		report.Add(db.CollectionNameStripeAccounts, 1)
+
+		// A venue linked again since has venue_id, the old link is stale then
+		if !account.VenueID.IsZero() {
+			report.Note("account %s was linked again since, kept venue %s", account.StripeAccountID, account.VenueID.Hex())
+			if !dryRun {
+				if _, err := accounts.UpdateOne(ctx, bson.M{"_id": account.ID}, bson.M{"$unset": bson.M{"venueId": ""}}); err != nil {
+					return report, err
+				}
+			}
+			continue
+		}
+
+		// The venue may have been linked to another account since, which left this link behind
+		var venue models.Venue
+		err := venues.FindOne(ctx, bson.M{"_id": account.LegacyVenueID}).Decode(&venue)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return report, err
+		}
+		stale := err == mongo.ErrNoDocuments || (venue.StripeAccountID != "" && venue.StripeAccountID != account.StripeAccountID)
+		if stale {
+			report.Note("account %s was linked to venue %s, which is gone or has another account now, unlinked", account.StripeAccountID, account.LegacyVenueID.Hex())
+		} else if venue.StripeAccountID == "" {
+			report.Add(db.CollectionNameVenue, 1)
+		}
+		if dryRun {
+			continue
+		}
+
+		update := bson.M{"$unset": bson.M{"venueId": ""}}
+		if !stale {
+			update["$set"] = bson.M{"venue_id": account.LegacyVenueID}
+			if _, err := venues.UpdateOne(ctx, bson.M{"_id": venue.ID}, bson.M{"$set": bson.M{"stripe_account_id": account.StripeAccountID}}); err != nil {
+				return report, err
+			}
+			log.Println("[migrate-stripe-links] account", account.StripeAccountID, "linked to venue", venue.ID.Hex())
+		}
+		if _, err := accounts.UpdateOne(ctx, bson.M{"_id": account.ID}, update); err != nil {
+			return report, err
+		}
+	}
+
+	return report, cursor.Err()
+}
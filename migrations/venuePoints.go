@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MigrateVenuePoints gives venues from before nearby search a GeoJSON point from their latitude and longitude.
+// Venues that have a point are skipped, which makes it safe to run again.
+func MigrateVenuePoints(ctx context.Context, dryRun bool) (Report, error) {
+	report := Report{Name: "venue-points", DryRun: dryRun}
+
+	filter := bson.M{"location.point": bson.M{"$exists": false}}
+	cursor, err := db.DB.Collection(db.CollectionNameVenue).Find(ctx, filter)
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var venue models.Venue
+		if err := cursor.Decode(&venue); err != nil {
+			return report, err
+		}
+
+		location := venue.Location
+		if err := location.Prepare(); err != nil {
+			report.Note("venue %s has coordinates out of range (%v, %v), left alone", venue.ID.Hex(), location.Latitude, location.Longitude)
+			continue
+		}
+		if location.Point == nil {
+			// Not placed yet, it gets a point when its location is filled in
+			continue
+		}
+
+		report.Add(db.CollectionNameVenue, 1)
+		if dryRun {
+			continue
+		}
+
+		update := bson.M{"$set": bson.M{"location.point": location.Point}}
+		if _, err := db.DB.Collection(db.CollectionNameVenue).UpdateOne(ctx, bson.M{"_id": venue.ID, "location.point": filter["location.point"]}, update); err != nil {
+			return report, err
+		}
+		log.Println("[migrate-venue-points] venue", venue.ID.Hex(), "is at", location.Latitude, location.Longitude)
+	}
+
+	return report, cursor.Err()
+}
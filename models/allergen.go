@@ -0,0 +1,59 @@
+package models
+
+import "strings"
+
+// Allergen is one of the 14 allergens EU food law requires venues to declare
+type Allergen string
+
+const (
+	AllergenGluten      Allergen = "gluten" // cereals containing gluten
+	AllergenCrustaceans Allergen = "crustaceans"
+	AllergenEggs        Allergen = "eggs"
+	AllergenFish        Allergen = "fish"
+	AllergenPeanuts     Allergen = "peanuts"
+	AllergenSoybeans    Allergen = "soybeans"
+	AllergenMilk        Allergen = "milk"
+	AllergenNuts        Allergen = "nuts" // tree nuts
+	AllergenCelery      Allergen = "celery"
+	AllergenMustard     Allergen = "mustard"
+	AllergenSesame      Allergen = "sesame"
+	AllergenSulphites   Allergen = "sulphites" // sulphur dioxide and sulphites
+	AllergenLupin       Allergen = "lupin"
+	AllergenMolluscs    Allergen = "molluscs"
+)
+
+var Allergens = []Allergen{
+	AllergenGluten, AllergenCrustaceans, AllergenEggs, AllergenFish, AllergenPeanuts, AllergenSoybeans, AllergenMilk,
+	AllergenNuts, AllergenCelery, AllergenMustard, AllergenSesame, AllergenSulphites, AllergenLupin, AllergenMolluscs,
+}
+
+// Other names menus and the parser use for the same allergens
+var allergenAliases = map[string]Allergen{
+	"wheat":           AllergenGluten,
+	"cereals":         AllergenGluten,
+	"shellfish":       AllergenCrustaceans,
+	"egg":             AllergenEggs,
+	"peanut":          AllergenPeanuts,
+	"soy":             AllergenSoybeans,
+	"soya":            AllergenSoybeans,
+	"dairy":           AllergenMilk,
+	"lactose":         AllergenMilk,
+	"tree nuts":       AllergenNuts,
+	"tree_nuts":       AllergenNuts,
+	"sulphur dioxide": AllergenSulphites,
+	"sulfites":        AllergenSulphites,
+	"lupine":          AllergenLupin,
+	"mollusks":        AllergenMolluscs,
+}
+
+// ParseAllergen returns the allergen a name refers to, ignoring case and accepting common aliases
+func ParseAllergen(name string) (Allergen, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, allergen := range Allergens {
+		if Allergen(name) == allergen {
+			return allergen, true
+		}
+	}
+	allergen, ok := allergenAliases[name]
+	return allergen, ok
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrInvalidLocation = errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+
+// The radius MongoDB measures spherical distances with, in meters
+const earthRadius = 6378137
+
+// GeoPoint is a GeoJSON point, its coordinates are longitude then latitude
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewGeoPoint(latitude, longitude float64) GeoPoint {
+	return GeoPoint{Type: "Point", Coordinates: []float64{longitude, latitude}}
+}
+
+func ValidCoordinates(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// Prepare checks the coordinates and sets Point from them. A location at 0, 0 is one that hasn't been filled in
+// and gets no point, so it never shows up as nearby.
+func (l *Location) Prepare() error {
+	if !ValidCoordinates(l.Latitude, l.Longitude) {
+		return ErrInvalidLocation
+	}
+	l.Point = nil
+	if l.Latitude != 0 || l.Longitude != 0 {
+		point := NewGeoPoint(l.Latitude, l.Longitude)
+		l.Point = &point
+	}
+	return nil
+}
+
+// DistanceTo is the great-circle distance between the points in meters, the way $geoNear measures it
+func (p GeoPoint) DistanceTo(other GeoPoint) float64 {
+	lng1, lat1 := radians(p.Coordinates[0]), radians(p.Coordinates[1])
+	lng2, lat2 := radians(other.Coordinates[0]), radians(other.Coordinates[1])
+
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lng2-lng1)/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(math.Min(1, h)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Menu item availabilities
+const (
+	ItemAvailable = "available"
+	// ItemSoldOut is "86": on the menu but can't be ordered, until it's restocked
+	ItemSoldOut = "sold_out"
+	// ItemHidden is off the menu for guests without being deleted
+	ItemHidden = "hidden"
+)
+
+func IsItemAvailability(availability string) bool {
+	return availability == ItemAvailable || availability == ItemSoldOut || availability == ItemHidden
+}
+
+// AvailabilityAt is the item's availability at t, with sold out items restocked once their time is up
+func (item MenuItemV2) AvailabilityAt(t time.Time) string {
+	switch {
+	case item.Availability == "":
+		return ItemAvailable
+	case item.Availability == ItemSoldOut && item.SoldOutUntil != nil && !t.Before(item.SoldOutUntil.Time()):
+		return ItemAvailable
+	}
+	return item.Availability
+}
+
+// Restock puts back the item if it's no longer sold out at t
+func (item *MenuItemV2) Restock(t time.Time) {
+	if item.Availability == ItemSoldOut && item.AvailabilityAt(t) == ItemAvailable {
+		item.Availability = ItemAvailable
+		item.SoldOutUntil = nil
+	}
+}
+
+// NextBusinessDayStart is when the business day after the one t falls in starts, which is when sold out items
+// are restocked
+func (v Venue) NextBusinessDayStart(t time.Time) (time.Time, error) {
+	location, start, err := v.businessDayStart()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	day := t.In(location).Add(-start)
+	return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, location).Add(start), nil
+}
+
+// SameItem is whether both items are the same dish, going by their names, such as one served on several menus
+func (item MenuItemV2) SameItem(other MenuItemV2) bool {
+	return normalizedName(item.Name) == normalizedName(other.Name)
+}
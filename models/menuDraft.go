@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Menu draft statuses
+const (
+	MenuDraftOpen      = "open"
+	MenuDraftPublished = "published"
+	MenuDraftDiscarded = "discarded"
+)
+
+// Draft warning codes
+const (
+	DraftWarningMissingName      = "missing_name"
+	DraftWarningMissingPrice     = "missing_price"
+	DraftWarningDuplicateName    = "duplicate_name"
+	DraftWarningSuspiciousPrice  = "suspicious_price"
+	DraftWarningSuspiciousName   = "suspicious_name"
+	DraftWarningMissingCategory  = "missing_category"
+	DraftWarningCurrencyMismatch = "currency_mismatch"
+)
+
+// Prices outside of these are more likely misread than real, in minor units
+const (
+	minPlausiblePrice = 20
+	maxPlausiblePrice = 50000
+)
+
+// Names longer than this are usually a description read as the name
+const maxPlausibleNameLength = 80
+
+// MenuDraft is a parsed menu card the merchant reviews before it goes live, as a new menu or merged into one
+type MenuDraft struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	VenueID    primitive.ObjectID  `bson:"venue_id" json:"venue_id"`
+	ParseJobID primitive.ObjectID  `bson:"parse_job_id,omitempty" json:"parse_job_id,omitempty"`
+	Name       string              `bson:"name" json:"name"`
+	Items      []MenuItemV2        `bson:"items" json:"items"`
+	Warnings   []DraftWarning      `bson:"warnings" json:"warnings"`
+	Status     string              `bson:"status" json:"status"`
+	MenuID     primitive.ObjectID  `bson:"menu_id,omitempty" json:"menu_id,omitempty"` // the menu it was published to
+	CreatedAt  primitive.DateTime  `bson:"created_at" json:"created_at"`
+	UpdatedAt  *primitive.DateTime `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DraftWarning points out an item the merchant should look at. Blocking warnings have to be fixed before publishing.
+type DraftWarning struct {
+	ItemID   primitive.ObjectID `bson:"item_id" json:"item_id"`
+	Code     string             `bson:"code" json:"code"`
+	Message  string             `bson:"message" json:"message"`
+	Blocking bool               `bson:"blocking" json:"blocking"`
+}
+
+// Review sets the draft's warnings from its current items
+func (draft *MenuDraft) Review() {
+	draft.Warnings = []DraftWarning{}
+	warn := func(item MenuItemV2, code string, blocking bool, format string, args ...interface{}) {
+		draft.Warnings = append(draft.Warnings, DraftWarning{ItemID: item.ID, Code: code, Message: fmt.Sprintf(format, args...), Blocking: blocking})
+	}
+
+	names := map[string]int{}
+	for _, item := range draft.Items {
+		names[normalizedName(item.Name)]++
+	}
+
+	currency := ""
+	for _, item := range draft.Items {
+		name := strings.TrimSpace(item.Name)
+		switch {
+		case name == "":
+			warn(item, DraftWarningMissingName, true, "item has no name")
+		case len(name) > maxPlausibleNameLength || strings.IndexFunc(name, unicode.IsLetter) < 0:
+			warn(item, DraftWarningSuspiciousName, false, "%q doesn't look like the name of an item", name)
+		}
+		if name != "" && names[normalizedName(name)] > 1 {
+			warn(item, DraftWarningDuplicateName, false, "%q is on the menu more than once", name)
+		}
+
+		switch {
+		case item.Price.Amount == 0:
+			warn(item, DraftWarningMissingPrice, true, "item has no price")
+		case item.Price.Amount < 0:
+			warn(item, DraftWarningSuspiciousPrice, true, "price %s is negative", item.Price)
+		case item.Price.Amount < minPlausiblePrice || item.Price.Amount > maxPlausiblePrice:
+			warn(item, DraftWarningSuspiciousPrice, false, "price %s looks misread", item.Price)
+		}
+		if currency == "" {
+			currency = item.Price.Currency
+		} else if item.Price.Currency != "" && item.Price.Currency != currency {
+			warn(item, DraftWarningCurrencyMismatch, true, "price is in %s while the menu is in %s", item.Price.Currency, currency)
+		}
+
+		if len(item.Categories) == 0 {
+			warn(item, DraftWarningMissingCategory, false, "item has no category")
+		}
+	}
+}
+
+// Publishable is false while the draft has blocking warnings
+func (draft MenuDraft) Publishable() bool {
+	for _, warning := range draft.Warnings {
+		if warning.Blocking {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeInto returns the menu's items with the draft's merged in. A draft item replaces the details and price of the
+// item with the same name, keeping its ID, image and modifiers, and is added when there's no such item.
+func (draft MenuDraft) MergeInto(menu MenuV2) (items []MenuItemV2, added int, updated int) {
+	items = append([]MenuItemV2{}, menu.Items...)
+	existing := map[string]int{}
+	for i, item := range items {
+		if item.DeletedAt == nil {
+			existing[normalizedName(item.Name)] = i
+		}
+	}
+
+	for _, item := range draft.Items {
+		i, ok := existing[normalizedName(item.Name)]
+		if !ok {
+			item.ID = primitive.NewObjectID()
+			items = append(items, item)
+			existing[normalizedName(item.Name)] = len(items) - 1
+			added++
+			continue
+		}
+
+		current := &items[i]
+		current.Price = item.Price
+		current.Description = item.Description
+		current.Categories = item.Categories
+		current.Ingredients = item.Ingredients
+		current.Allergens = item.Allergens
+		current.DietaryTags = item.DietaryTags
+		updated++
+	}
+
+	return items, added, updated
+}
+
+func normalizedName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Limits on the free text of menu items, long enough for any real menu
+const (
+	MaxDescriptionLength = 1000
+	MaxIngredients       = 50
+	MaxDietaryTags       = 20
+	maxTagLength         = 50
+)
+
+var ErrInvalidMenuItem = errors.New("invalid menu item")
+
+// Prepare validates what is set on the item and normalizes it, so it works for full items as well as partial updates
+func (item *MenuItemV2) Prepare() error {
+	if err := item.prepareDetails(); err != nil {
+		return err
+	}
+	return item.PrepareModifierGroups()
+}
+
+func (item *MenuItemV2) prepareDetails() error {
+	item.Description = strings.TrimSpace(item.Description)
+	if len(item.Description) > MaxDescriptionLength {
+		return fmt.Errorf("%w: description is longer than %d characters", ErrInvalidMenuItem, MaxDescriptionLength)
+	}
+
+	if len(item.Ingredients) > MaxIngredients {
+		return fmt.Errorf("%w: more than %d ingredients", ErrInvalidMenuItem, MaxIngredients)
+	}
+	for i, ingredient := range item.Ingredients {
+		item.Ingredients[i] = strings.TrimSpace(ingredient)
+		if item.Ingredients[i] == "" || len(item.Ingredients[i]) > maxTagLength {
+			return fmt.Errorf("%w: ingredients must be between 1 and %d characters", ErrInvalidMenuItem, maxTagLength)
+		}
+	}
+
+	if item.Allergens != nil {
+		allergens := []Allergen{}
+		seen := map[Allergen]bool{}
+		for _, name := range item.Allergens {
+			allergen, ok := ParseAllergen(string(name))
+			if !ok {
+				return fmt.Errorf("%w: unknown allergen %q", ErrInvalidMenuItem, name)
+			}
+			if !seen[allergen] {
+				seen[allergen] = true
+				allergens = append(allergens, allergen)
+			}
+		}
+		item.Allergens = allergens
+	}
+
+	if len(item.DietaryTags) > MaxDietaryTags {
+		return fmt.Errorf("%w: more than %d dietary tags", ErrInvalidMenuItem, MaxDietaryTags)
+	}
+	for i, tag := range item.DietaryTags {
+		item.DietaryTags[i] = strings.ToLower(strings.TrimSpace(tag))
+		if item.DietaryTags[i] == "" || len(item.DietaryTags[i]) > maxTagLength {
+			return fmt.Errorf("%w: dietary tags must be between 1 and %d characters", ErrInvalidMenuItem, maxTagLength)
+		}
+	}
+
+	if item.ImageURL != "" {
+		u, err := url.Parse(item.ImageURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: image_url must be an http(s) URL", ErrInvalidMenuItem)
+		}
+	}
+
+	if item.Blurhash.Hash != "" && (item.Blurhash.Width <= 0 || item.Blurhash.Height <= 0) {
+		return fmt.Errorf("%w: blurhash needs the width and height of the image", ErrInvalidMenuItem)
+	}
+
+	if item.Availability != "" && !IsItemAvailability(item.Availability) {
+		return fmt.Errorf("%w: availability must be available, sold_out or hidden", ErrInvalidMenuItem)
+	}
+
+	if (item.Stock != nil && *item.Stock < 0) || item.LowStockAt < 0 {
+		return fmt.Errorf("%w: stock can't be negative", ErrInvalidMenuItem)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What made a menu version
+const (
+	MenuChangeCreated     = "created"
+	MenuChangeUpdated     = "updated"
+	MenuChangeItemAdded   = "item_added"
+	MenuChangeItemUpdated = "item_updated"
+	MenuChangeItemDeleted = "item_deleted"
+	MenuChangeRolledBack  = "rolled_back"
+	MenuChangeDeleted     = "deleted"
+)
+
+// MenuVersion is a menu as it was after a change, versions count up from 1 per menu and are never changed
+type MenuVersion struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MenuID        primitive.ObjectID `bson:"menu_id" json:"menu_id"`
+	VenueID       primitive.ObjectID `bson:"venue_id" json:"venue_id"`
+	Version       int                `bson:"version" json:"version"`
+	Change        string             `bson:"change" json:"change"`
+	RolledBackTo  int                `bson:"rolled_back_to,omitempty" json:"rolled_back_to,omitempty"` // the version a rollback restored
+	Name          string             `bson:"name" json:"name"`
+	Items         []MenuItemV2       `bson:"items,omitempty" json:"items,omitempty"`
+	CategoryOrder []string           `bson:"category_order,omitempty" json:"category_order,omitempty"`
+	CreatedAt     primitive.DateTime `bson:"created_at" json:"created_at"`
+}
+
+// NewMenuVersion snapshots the menu, which already has its new version number
+func NewMenuVersion(menu MenuV2, change string) MenuVersion {
+	return MenuVersion{
+		ID:            primitive.NewObjectID(),
+		MenuID:        menu.ID,
+		VenueID:       menu.VenueID,
+		Version:       menu.Version,
+		Change:        change,
+		Name:          menu.Name,
+		Items:         menu.Items,
+		CategoryOrder: menu.CategoryOrder,
+		CreatedAt:     primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+// MenuDiff is what changed for guests between two versions of a menu. Deleted items count as removed.
+type MenuDiff struct {
+	From         int               `json:"from"`
+	To           int               `json:"to"`
+	Added        []MenuItemV2      `json:"added"`
+	Removed      []MenuItemV2      `json:"removed"`
+	PriceChanged []MenuPriceChange `json:"price_changed"`
+	Changed      []MenuItemV2      `json:"changed"` // items whose other details changed, as they are in To
+}
+
+type MenuPriceChange struct {
+	ItemID primitive.ObjectID `json:"item_id"`
+	Name   string             `json:"name"`
+	From   Money              `json:"from"`
+	To     Money              `json:"to"`
+}
+
+// DiffMenuVersions compares the live items of two versions by their IDs
+func DiffMenuVersions(from MenuVersion, to MenuVersion) MenuDiff {
+	diff := MenuDiff{From: from.Version, To: to.Version, Added: []MenuItemV2{}, Removed: []MenuItemV2{}, PriceChanged: []MenuPriceChange{}, Changed: []MenuItemV2{}}
+
+	before := map[primitive.ObjectID]MenuItemV2{}
+	for _, item := range from.Items {
+		if item.DeletedAt == nil {
+			before[item.ID] = item
+		}
+	}
+
+	for _, item := range to.Items {
+		if item.DeletedAt != nil {
+			continue
+		}
+		old, ok := before[item.ID]
+		delete(before, item.ID)
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, item)
+		case old.Price != item.Price:
+			diff.PriceChanged = append(diff.PriceChanged, MenuPriceChange{ItemID: item.ID, Name: item.Name, From: old.Price, To: item.Price})
+		case !sameDetails(old, item):
+			diff.Changed = append(diff.Changed, item)
+		}
+	}
+
+	// What's left wasn't found in To, in the order it was on the menu
+	for _, item := range from.Items {
+		if _, ok := before[item.ID]; ok {
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+
+	return diff
+}
+
+// sameDetails leaves out availability and stock, which change during service without it being a new version
+func sameDetails(a MenuItemV2, b MenuItemV2) bool {
+	a.Price, b.Price = Money{}, Money{}
+	a.Availability, b.Availability = "", ""
+	a.SoldOutUntil, b.SoldOutUntil = nil, nil
+	a.Stock, b.Stock = nil, nil
+	a.LowStockAt, b.LowStockAt = 0, 0
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ModifierGroup is a choice the guest makes for a menu item, like "Size" or "Extras"
+type ModifierGroup struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name          string             `bson:"name" json:"name"`
+	MinSelections int                `bson:"min_selections" json:"min_selections"` // 1 or more makes the group required
+	MaxSelections int                `bson:"max_selections" json:"max_selections"` // 0 for no limit
+	Options       []ModifierOption   `bson:"options" json:"options"`
+}
+
+type ModifierOption struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	PriceDelta Money              `bson:"price_delta" json:"price_delta"` // added to the item's price, may be negative
+}
+
+// OrderItemModifier is a selected option, the client only sends the group and option IDs, the names and
+// price delta are snapshotted from the menu
+type OrderItemModifier struct {
+	GroupID    primitive.ObjectID `bson:"group_id" json:"group_id"`
+	OptionID   primitive.ObjectID `bson:"option_id" json:"option_id"`
+	GroupName  string             `bson:"group_name" json:"group_name"`
+	Name       string             `bson:"name" json:"name"`
+	PriceDelta Money              `bson:"price_delta" json:"price_delta"`
+}
+
+var ErrInvalidModifiers = errors.New("invalid modifiers")
+
+// PrepareModifierGroups checks the item's modifier groups are consistent and gives new groups and options an ID
+func (item *MenuItemV2) PrepareModifierGroups() error {
+	for g := range item.ModifierGroups {
+		group := &item.ModifierGroups[g]
+		if group.Name == "" {
+			return fmt.Errorf("%w: modifier group needs a name", ErrInvalidModifiers)
+		}
+		if len(group.Options) == 0 {
+			return fmt.Errorf("%w: %s has no options", ErrInvalidModifiers, group.Name)
+		}
+		if group.MinSelections < 0 || group.MaxSelections < 0 {
+			return fmt.Errorf("%w: %s can't have a negative number of selections", ErrInvalidModifiers, group.Name)
+		}
+		if group.MaxSelections > 0 && group.MaxSelections < group.MinSelections {
+			return fmt.Errorf("%w: %s allows fewer selections than it requires", ErrInvalidModifiers, group.Name)
+		}
+		if group.MinSelections > len(group.Options) {
+			return fmt.Errorf("%w: %s requires more selections than it has options", ErrInvalidModifiers, group.Name)
+		}
+		if group.ID.IsZero() {
+			group.ID = primitive.NewObjectID()
+		}
+
+		for o := range group.Options {
+			option := &group.Options[o]
+			if option.Name == "" {
+				return fmt.Errorf("%w: option in %s needs a name", ErrInvalidModifiers, group.Name)
+			}
+			if option.PriceDelta.Currency == "" {
+				option.PriceDelta = NewMoney(option.PriceDelta.Amount, item.Price.Currency)
+			}
+			if !option.PriceDelta.SameCurrency(item.Price) {
+				return fmt.Errorf("%w: %s is priced in a different currency than the item", ErrInvalidModifiers, option.Name)
+			}
+			if option.ID.IsZero() {
+				option.ID = primitive.NewObjectID()
+			}
+		}
+	}
+
+	return nil
+}
+
+// SelectModifiers checks the selected options against the item's groups and returns them with their names and
+// price deltas filled in from the menu, in the order of the menu
+func (item MenuItemV2) SelectModifiers(selected []OrderItemModifier) ([]OrderItemModifier, error) {
+	chosen := map[primitive.ObjectID]map[primitive.ObjectID]bool{}
+	for _, modifier := range selected {
+		if chosen[modifier.GroupID] == nil {
+			chosen[modifier.GroupID] = map[primitive.ObjectID]bool{}
+		}
+		if chosen[modifier.GroupID][modifier.OptionID] {
+			return nil, fmt.Errorf("%w: option %s selected twice for %s", ErrInvalidModifiers, modifier.OptionID.Hex(), item.Name)
+		}
+		chosen[modifier.GroupID][modifier.OptionID] = true
+	}
+
+	modifiers := []OrderItemModifier{}
+	for _, group := range item.ModifierGroups {
+		options := chosen[group.ID]
+		delete(chosen, group.ID)
+
+		count := 0
+		for _, option := range group.Options {
+			if !options[option.ID] {
+				continue
+			}
+			delete(options, option.ID)
+			count++
+
+			modifiers = append(modifiers, OrderItemModifier{
+				GroupID:    group.ID,
+				OptionID:   option.ID,
+				GroupName:  group.Name,
+				Name:       option.Name,
+				PriceDelta: option.PriceDelta,
+			})
+		}
+
+		for optionID := range options {
+			return nil, fmt.Errorf("%w: option %s isn't part of %s", ErrInvalidModifiers, optionID.Hex(), group.Name)
+		}
+		if count < group.MinSelections {
+			return nil, fmt.Errorf("%w: %s of %s needs at least %d selections", ErrInvalidModifiers, group.Name, item.Name, group.MinSelections)
+		}
+		if group.MaxSelections > 0 && count > group.MaxSelections {
+			return nil, fmt.Errorf("%w: %s of %s allows at most %d selections", ErrInvalidModifiers, group.Name, item.Name, group.MaxSelections)
+		}
+	}
+
+	for groupID := range chosen {
+		return nil, fmt.Errorf("%w: modifier group %s isn't part of %s", ErrInvalidModifiers, groupID.Hex(), item.Name)
+	}
+
+	return modifiers, nil
+}
+
+// ModifierSummary lists the selected options, e.g. "Large, Extra cheese", empty without modifiers
+func (item OrderItem) ModifierSummary() string {
+	names := make([]string, 0, len(item.Modifiers))
+	for _, modifier := range item.Modifiers {
+		names = append(names, modifier.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// DefaultCurrency is what amounts without a currency are in, all venues are in the eurozone so far
+const DefaultCurrency = "EUR"
+
+// Money is an amount in the currency's minor unit : €1.00 = 100, €0.50 = 50, €245 = 24500
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"` // ISO 4217, upper case
+}
+
+type moneyFields Money
+
+func NewMoney(amount int64, currency string) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// MoneyFromFloat converts a decimal amount in major units, rounding to the nearest minor unit
+func MoneyFromFloat(amount float64, currency string) Money {
+	return NewMoney(int64(math.Round(amount*100)), currency)
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currencyOr(other.Currency)}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currencyOr(other.Currency)}
+}
+
+func (m Money) Times(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// SameCurrency reports whether both amounts can be added up, a zero amount without currency matches anything
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == "" || other.Currency == "" || m.Currency == other.Currency
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// StripeCurrency is the currency in the lower case form Stripe expects
+func (m Money) StripeCurrency() string {
+	return strings.ToLower(m.currencyOr(DefaultCurrency))
+}
+
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, m.currencyOr(DefaultCurrency))
+}
+
+func (m Money) currencyOr(currency string) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return currency
+}
+
+// UnmarshalJSON accepts {"amount": 1999, "currency": "EUR"} as well as a plain decimal like 19.99 in the default
+// currency, which is what clients and the menu parser sent before amounts were in minor units
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var fields moneyFields
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		*m = NewMoney(fields.Amount, fields.Currency)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+
+	amount, err := parseDecimal(number.String())
+	if err != nil {
+		return err
+	}
+	*m = NewMoney(amount, DefaultCurrency)
+	return nil
+}
+
+// UnmarshalBSONValue also reads the float amounts documents held before they were migrated to Money
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Double:
+		value, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return fmt.Errorf("invalid double amount")
+		}
+		*m = MoneyFromFloat(value, DefaultCurrency)
+		return nil
+	case bsontype.Int32:
+		value, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return fmt.Errorf("invalid int32 amount")
+		}
+		*m = NewMoney(int64(value)*100, DefaultCurrency)
+		return nil
+	case bsontype.Int64:
+		value, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return fmt.Errorf("invalid int64 amount")
+		}
+		*m = NewMoney(value*100, DefaultCurrency)
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+		return nil
+	}
+
+	var fields moneyFields
+	if err := bson.UnmarshalValue(t, data, &fields); err != nil {
+		return err
+	}
+	*m = Money(fields)
+	return nil
+}
+
+// parseDecimal turns a decimal string in major units into minor units without going through a float
+func parseDecimal(s string) (int64, error) {
+	if strings.ContainsAny(s, "eE") {
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(math.Round(value * 100)), nil
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if len(fraction) > 2 {
+		// Round half up on the third decimal
+		roundUp := fraction[2] >= '5'
+		fraction = fraction[:2]
+		amount, err := combineDecimal(whole, fraction)
+		if err != nil {
+			return 0, err
+		}
+		if roundUp {
+			amount++
+		}
+		if negative {
+			amount = -amount
+		}
+		return amount, nil
+	}
+
+	amount, err := combineDecimal(whole, fraction)
+	if negative {
+		amount = -amount
+	}
+	return amount, err
+}
+
+func combineDecimal(whole string, fraction string) (int64, error) {
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	return strconv.ParseInt(whole+fraction, 10, 64)
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	for _, test := range []struct {
+		json string
+		want Money
+	}{
+		{`{"amount": 1999, "currency": "eur"}`, NewMoney(1999, "EUR")},
+		{`{"amount": 500}`, NewMoney(500, "EUR")},
+		// Bare numbers are decimals in major units, what was sent before amounts were in minor units
+		{`19.99`, NewMoney(1999, "EUR")},
+		{`20`, NewMoney(2000, "EUR")},
+		{`0.1`, NewMoney(10, "EUR")},
+		{`-3.5`, NewMoney(-350, "EUR")},
+		{`2.345`, NewMoney(235, "EUR")},
+		{`1e2`, NewMoney(10000, "EUR")},
+	} {
+		var got Money
+		if err := json.Unmarshal([]byte(test.json), &got); err != nil {
+			t.Fatalf("%s: %v", test.json, err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: expected %s, got %s", test.json, test.want, got)
+		}
+	}
+
+	for _, invalid := range []string{`"cheap"`, `true`, `[19.99]`} {
+		var money Money
+		if err := json.Unmarshal([]byte(invalid), &money); err == nil {
+			t.Fatalf("%s: expected an error, got %s", invalid, money)
+		}
+	}
+}
+
+func TestMoneyUnmarshalBSON(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		value interface{}
+		want  Money
+	}{
+		{"money", bson.M{"amount": int64(1999), "currency": "EUR"}, NewMoney(1999, "EUR")},
+		// Amounts documents held before they were migrated are in major units, whatever their type
+		{"double", 19.99, NewMoney(1999, "EUR")},
+		{"int32", int32(20), NewMoney(2000, "EUR")},
+		{"int64", int64(7), NewMoney(700, "EUR")},
+		{"null", nil, Money{}},
+	} {
+		data, err := bson.Marshal(bson.M{"price": test.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Price Money `bson:"price"`
+		}
+		if err := bson.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got.Price != test.want {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.want, got.Price)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrOrderingNotSupported = errors.New("the venue doesn't take orders")
+var ErrVenueClosed = errors.New("the venue is closed")
+
+// The longest a kitchen can close before the venue does, in minutes
+const maxKitchenClosesBefore = 6 * 60
+
+// OpeningStatus is whether the venue is open at a time, and when that changes next
+type OpeningStatus struct {
+	IsOpenNow    bool       `json:"is_open_now"`
+	TakingOrders bool       `json:"taking_orders"`
+	ClosesAt     *time.Time `json:"closes_at,omitempty"` // unless the venue is always open
+	NextOpen     *time.Time `json:"next_open,omitempty"` // while it's closed
+}
+
+// ValidateOpeningHours checks the venue's opening hours and kitchen closing rule
+func (v Venue) ValidateOpeningHours() error {
+	if v.OpeningHours != nil {
+		if err := v.OpeningHours.Validate(); err != nil {
+			return err
+		}
+	}
+	if v.KitchenClosesBefore < 0 || v.KitchenClosesBefore > maxKitchenClosesBefore {
+		return fmt.Errorf("kitchen_closes_before must be between 0 and %d minutes", maxKitchenClosesBefore)
+	}
+	return nil
+}
+
+// OpeningStatusAt tells if the venue is open at t and takes orders then, which it stops doing when the kitchen
+// closes before the venue does
+func (v Venue) OpeningStatusAt(t time.Time) (OpeningStatus, error) {
+	location, err := v.TimeLocation()
+	if err != nil {
+		return OpeningStatus{}, err
+	}
+
+	status := OpeningStatus{IsOpenNow: true}
+	if v.OpeningHours != nil {
+		local := t.In(location)
+		status.IsOpenNow = v.OpeningHours.ActiveAt(local)
+		next, ok := v.OpeningHours.NextChange(local, !status.IsOpenNow)
+		switch {
+		case ok && status.IsOpenNow:
+			status.ClosesAt = &next
+		case ok:
+			status.NextOpen = &next
+		}
+	}
+
+	kitchenClosed := status.ClosesAt != nil && status.ClosesAt.Sub(t) <= time.Duration(v.KitchenClosesBefore)*time.Minute
+	status.TakingOrders = v.OrderingSupported && status.IsOpenNow && !kitchenClosed
+
+	return status, nil
+}
+
+// CheckOrdering returns why the venue doesn't take orders in the given status, nil if it does
+func (v Venue) CheckOrdering(status OpeningStatus) error {
+	switch {
+	case status.TakingOrders:
+		return nil
+	case !v.OrderingSupported:
+		return ErrOrderingNotSupported
+	case status.IsOpenNow:
+		return fmt.Errorf("%w: the kitchen closes %d minutes before the venue", ErrVenueClosed, v.KitchenClosesBefore)
+	}
+	return ErrVenueClosed
+}
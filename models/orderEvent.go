@@ -0,0 +1,41 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Order event types pushed to the kitchen feed
+const (
+	OrderEventCreated       = "order.created"
+	OrderEventPaid          = "order.paid"
+	OrderEventStatusChanged = "order.status_changed"
+	// OrderEventLowStock is about a counted item running low or out, because of the order on the event
+	OrderEventLowStock = "stock.low"
+)
+
+// OrderEvent is an entry of the per venue order feed. Sequence numbers the venue's events in the order they were
+// committed and doubles as the SSE event ID clients resume from.
+type OrderEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	VenueID   primitive.ObjectID `bson:"venue_id" json:"venue_id"`
+	Sequence  int64              `bson:"sequence" json:"sequence"`
+	OrderID   primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Type      string             `bson:"type" json:"type"`
+	Order     Order              `bson:"order" json:"order"`
+	Stock     *StockAlert        `bson:"stock,omitempty" json:"stock,omitempty"`
+	Timestamp primitive.DateTime `bson:"timestamp" json:"timestamp"`
+}
+
+// OrderEventCounter hands out the sequence numbers of one venue's feed
+type OrderEventCounter struct {
+	VenueID primitive.ObjectID `bson:"_id" json:"venue_id"`
+	Seq     int64              `bson:"seq" json:"seq"`
+}
+
+// TransitionEventType is the feed event announcing an order moving to the given status
+func TransitionEventType(to OrderStatus) string {
+	if to == OrderStatusPaid {
+		return OrderEventPaid
+	}
+	return OrderEventStatusChanged
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultBusinessDayStart is when order numbers start again from 1 if the venue doesn't set it, late enough
+// that a night's service keeps counting up past midnight
+const DefaultBusinessDayStart = "04:00"
+
+// OrderCounter hands out the order numbers of one venue for one business day
+type OrderCounter struct {
+	ID          string             `bson:"_id" json:"id"` // venue ID and business day, e.g. 65f0...:2024-03-15
+	VenueID     primitive.ObjectID `bson:"venue_id" json:"venue_id"`
+	BusinessDay string             `bson:"business_day" json:"business_day"`
+	Seq         int                `bson:"seq" json:"seq"`
+	CreatedAt   primitive.DateTime `bson:"created_at" json:"created_at"`
+}
+
+func OrderCounterID(venueID primitive.ObjectID, businessDay string) string {
+	return venueID.Hex() + ":" + businessDay
+}
+
+// BusinessDay returns the date, in the venue's time zone, of the business day t falls in. Before the venue's
+// business day start t still counts as the previous day.
+func (v Venue) BusinessDay(t time.Time) (string, error) {
+	location, start, err := v.businessDayStart()
+	if err != nil {
+		return "", err
+	}
+
+	return t.In(location).Add(-start).Format(time.DateOnly), nil
+}
+
+// ValidateBusinessDay checks the venue's time zone and business day start can be used to number orders
+func (v Venue) ValidateBusinessDay() error {
+	_, _, err := v.businessDayStart()
+	return err
+}
+
+// TimeLocation returns the venue's time zone, UTC if it has none
+func (v Venue) TimeLocation() (*time.Location, error) {
+	if v.TimeZone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(v.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", v.TimeZone)
+	}
+	return location, nil
+}
+
+func (v Venue) businessDayStart() (*time.Location, time.Duration, error) {
+	location, err := v.TimeLocation()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := v.BusinessDayStart
+	if start == "" {
+		start = DefaultBusinessDayStart
+	}
+	clock, err := time.Parse("15:04", start)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid business day start %q, expected HH:MM", start)
+	}
+
+	return location, time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
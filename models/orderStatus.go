@@ -0,0 +1,138 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderStatus string
+
+// Order status enum
+const (
+	OrderStatusDraft             OrderStatus = "draft"
+	OrderStatusAwaitingPayment   OrderStatus = "awaiting_payment"
+	OrderStatusPaid              OrderStatus = "paid"
+	OrderStatusAccepted          OrderStatus = "accepted"
+	OrderStatusPreparing         OrderStatus = "preparing"
+	OrderStatusReady             OrderStatus = "ready"
+	OrderStatusServed            OrderStatus = "served"
+	OrderStatusCompleted         OrderStatus = "completed"
+	OrderStatusCancelled         OrderStatus = "cancelled"
+	OrderStatusPartiallyRefunded OrderStatus = "partially_refunded"
+	OrderStatusRefunded          OrderStatus = "refunded"
+
+	// OrderStatusSent is what orders were created with before there was a lifecycle, it behaves like awaiting_payment
+	OrderStatusSent OrderStatus = "sent"
+)
+
+// Who or what moved an order to a new status
+const (
+	OrderTriggerAPI     = "api"
+	OrderTriggerStripe  = "stripe"
+	OrderTriggerRefund  = "refund"
+	OrderTriggerCreated = "created"
+)
+
+// orderTransitions lists the statuses an order can move to from each status, anything not listed is illegal. After
+// a partial refund the order can move on from the stage it had reached, see Order.CanTransitionTo.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusDraft:             {OrderStatusAwaitingPayment, OrderStatusCancelled},
+	OrderStatusAwaitingPayment:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusSent:              {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:              {OrderStatusAccepted, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusAccepted:          {OrderStatusPreparing, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusPreparing:         {OrderStatusReady, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusReady:             {OrderStatusServed, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusServed:            {OrderStatusCompleted, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusCompleted:         {OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusPartiallyRefunded: {OrderStatusRefunded, OrderStatusAccepted, OrderStatusPreparing, OrderStatusReady, OrderStatusServed, OrderStatusCompleted},
+	OrderStatusCancelled:         {},
+	OrderStatusRefunded:          {},
+}
+
+// serviceStages are the statuses a paid order goes through, in order
+var serviceStages = []OrderStatus{OrderStatusPaid, OrderStatusAccepted, OrderStatusPreparing, OrderStatusReady, OrderStatusServed, OrderStatusCompleted}
+
+// UnpaidOrderStatuses are the statuses an order's items can still be changed in
+var UnpaidOrderStatuses = []OrderStatus{OrderStatusDraft, OrderStatusAwaitingPayment, OrderStatusSent}
+
+// Statuses that say money moved, only Stripe and refunds can move an order to them
+var moneyTriggers = map[OrderStatus][]string{
+	OrderStatusPaid:              {OrderTriggerStripe, OrderTriggerRefund},
+	OrderStatusPartiallyRefunded: {OrderTriggerStripe, OrderTriggerRefund},
+	OrderStatusRefunded:          {OrderTriggerStripe, OrderTriggerRefund},
+}
+
+// OrderStatusChange is one entry of an order's status history
+type OrderStatusChange struct {
+	From OrderStatus        `bson:"from,omitempty" json:"from,omitempty"`
+	To   OrderStatus        `bson:"to" json:"to"`
+	At   primitive.DateTime `bson:"at" json:"at"`
+	// Trigger is one of the OrderTrigger values, Actor the Stripe event or refund behind it. API changes have no
+	// actor, every caller shares the same token.
+	Trigger string `bson:"trigger" json:"trigger"`
+	Actor   string `bson:"actor,omitempty" json:"actor,omitempty"`
+}
+
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an order in this status may move to the given status by the trigger
+func (s OrderStatus) CanTransitionTo(to OrderStatus, trigger string) bool {
+	if triggers, ok := moneyTriggers[to]; ok && !contains(triggers, trigger) {
+		return false
+	}
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransitionTo is OrderStatus.CanTransitionTo, except a partially refunded order only moves to a stage past the
+// one it was refunded in
+func (o Order) CanTransitionTo(to OrderStatus, trigger string) bool {
+	if !o.Status.CanTransitionTo(to, trigger) {
+		return false
+	}
+	if o.Status != OrderStatusPartiallyRefunded {
+		return true
+	}
+	refundedIn := OrderStatusPaid
+	for i := len(o.StatusHistory) - 1; i >= 0; i-- {
+		if change := o.StatusHistory[i]; change.To == OrderStatusPartiallyRefunded {
+			refundedIn = change.From
+			break
+		}
+	}
+	return to == OrderStatusRefunded || stageIndex(to) > stageIndex(refundedIn)
+}
+
+func stageIndex(s OrderStatus) int {
+	for i, stage := range serviceStages {
+		if stage == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s OrderStatus) IsUnpaid() bool {
+	for _, unpaid := range UnpaidOrderStatuses {
+		if s == unpaid {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
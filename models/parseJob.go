@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Parse job statuses
+const (
+	ParseJobQueued    = "queued"
+	ParseJobRunning   = "running"
+	ParseJobSucceeded = "succeeded"
+	ParseJobFailed    = "failed"
+	ParseJobCancelled = "cancelled"
+)
+
+// ParseJob is an uploaded menu card being turned into a menu in the background. It holds on to the file until it's
+// done, so a job that was running on a server that went down is picked up again once its lease runs out.
+type ParseJob struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	VenueID     primitive.ObjectID  `bson:"venue_id" json:"venue_id"`
+	Status      string              `bson:"status" json:"status"`
+	FileName    string              `bson:"file_name" json:"file_name"`
+	ContentType string              `bson:"content_type" json:"content_type"`
+	File        []byte              `bson:"file,omitempty" json:"-"`
+	Attempts    int                 `bson:"attempts" json:"attempts"`
+	DraftID     primitive.ObjectID  `bson:"draft_id,omitempty" json:"draft_id,omitempty"` // the draft to review, once succeeded
+	Error       string              `bson:"error,omitempty" json:"error,omitempty"`
+	Problems    []ParseProblem      `bson:"problems,omitempty" json:"problems,omitempty"` // why the parser's output was rejected
+	CreatedAt   primitive.DateTime  `bson:"created_at" json:"created_at"`
+	StartedAt   *primitive.DateTime `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt  *primitive.DateTime `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	LeaseUntil  *primitive.DateTime `bson:"lease_until,omitempty" json:"-"` // when a running job counts as abandoned
+}
+
+// ParseProblem is something wrong with the items a parser returned
+type ParseProblem struct {
+	Item    int    `bson:"item" json:"item"` // index of the item, -1 for the output as a whole
+	Field   string `bson:"field,omitempty" json:"field,omitempty"`
+	Message string `bson:"message" json:"message"`
+}
+
+func (problem ParseProblem) String() string {
+	switch {
+	case problem.Item < 0:
+		return problem.Message
+	case problem.Field == "":
+		return fmt.Sprintf("item %d: %s", problem.Item, problem.Message)
+	}
+	return fmt.Sprintf("item %d %s: %s", problem.Item, problem.Field, problem.Message)
+}
+
+// Finished is true once the job won't change anymore
+func (job ParseJob) Finished() bool {
+	return job.Status == ParseJobSucceeded || job.Status == ParseJobFailed || job.Status == ParseJobCancelled
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// How far NextChange looks ahead, in days
+const scheduleLookahead = 8 * 7
+
+// Days of the week as schedules name them
+var scheduleDays = map[string]time.Weekday{
+	"mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday,
+	"fri": time.Friday, "sat": time.Saturday, "sun": time.Sunday,
+}
+
+// Schedule is weekly hours with exceptions in the venue's time zone, like when a menu is served or when the venue
+// is open
+type Schedule struct {
+	Weekly []WeeklyHours `bson:"weekly" json:"weekly"`
+	// Overrides replace the weekly hours on a date, for holidays and events
+	Overrides []ScheduleOverride `bson:"overrides,omitempty" json:"overrides,omitempty"`
+}
+
+// WeeklyHours is a time range on some days of the week, like breakfast from 07:00 to 11:00 on "mon".."fri"
+type WeeklyHours struct {
+	Days      []string `bson:"days" json:"days"`
+	TimeRange `bson:",inline"`
+}
+
+type ScheduleOverride struct {
+	Date   string      `bson:"date" json:"date"` // YYYY-MM-DD
+	Closed bool        `bson:"closed" json:"closed"`
+	Hours  []TimeRange `bson:"hours,omitempty" json:"hours,omitempty"` // instead of the weekly hours, unless closed
+}
+
+// TimeRange is from From up to To, both HH:MM. A range that ends before it starts runs past midnight, like a
+// happy hour from 22:00 to 02:00, and To can be 24:00 for the end of the day.
+type TimeRange struct {
+	From string `bson:"from" json:"from"`
+	To   string `bson:"to" json:"to"`
+}
+
+func (schedule Schedule) Validate() error {
+	if len(schedule.Weekly) == 0 && len(schedule.Overrides) == 0 {
+		return fmt.Errorf("%w: it has no hours", ErrInvalidSchedule)
+	}
+	for _, hours := range schedule.Weekly {
+		if len(hours.Days) == 0 {
+			return fmt.Errorf("%w: hours %s-%s have no days", ErrInvalidSchedule, hours.From, hours.To)
+		}
+		for _, day := range hours.Days {
+			if _, ok := scheduleDays[day]; !ok {
+				return fmt.Errorf("%w: unknown day %q, use mon to sun", ErrInvalidSchedule, day)
+			}
+		}
+		if err := hours.validate(); err != nil {
+			return err
+		}
+	}
+
+	dates := map[string]bool{}
+	for _, override := range schedule.Overrides {
+		if _, err := time.Parse(time.DateOnly, override.Date); err != nil {
+			return fmt.Errorf("%w: invalid date %q, expected YYYY-MM-DD", ErrInvalidSchedule, override.Date)
+		}
+		if dates[override.Date] {
+			return fmt.Errorf("%w: %s is overridden more than once", ErrInvalidSchedule, override.Date)
+		}
+		dates[override.Date] = true
+		if override.Closed != (len(override.Hours) == 0) {
+			return fmt.Errorf("%w: the override of %s needs either hours or closed", ErrInvalidSchedule, override.Date)
+		}
+		for _, hours := range override.Hours {
+			if err := hours.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ActiveAt tells if t is within the schedule's hours, t has to be in the venue's time zone
+func (schedule Schedule) ActiveAt(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+
+	for _, hours := range schedule.hoursOn(t) {
+		from, to := hours.minutes()
+		if minute >= from && (to <= from || minute < to) {
+			return true
+		}
+	}
+
+	// Ranges that started the day before and run past midnight
+	for _, hours := range schedule.hoursOn(t.AddDate(0, 0, -1)) {
+		if from, to := hours.minutes(); to < from && minute < to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextChange finds when the schedule next becomes active, or inactive, after t. It looks ahead
+// scheduleLookahead days and returns false when there's no change in that time.
+func (schedule Schedule) NextChange(t time.Time, active bool) (time.Time, bool) {
+	var boundaries []time.Time
+	for offset := -1; offset <= scheduleLookahead; offset++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, t.Location())
+		for _, hours := range schedule.hoursOn(day) {
+			from, to := hours.minutes()
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, from, 0, 0, day.Location())
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, to, 0, 0, day.Location())
+			if to <= from {
+				end = time.Date(day.Year(), day.Month(), day.Day()+1, 0, to, 0, 0, day.Location())
+			}
+			boundaries = append(boundaries, start, end)
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	// Ranges that touch or overlap don't change anything where one ends
+	for _, boundary := range boundaries {
+		if boundary.After(t) && schedule.ActiveAt(boundary) == active {
+			return boundary, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hoursOn returns the ranges that start on t's date
+func (schedule Schedule) hoursOn(t time.Time) []TimeRange {
+	date := t.Format(time.DateOnly)
+	for _, override := range schedule.Overrides {
+		if override.Date == date {
+			return override.Hours
+		}
+	}
+
+	var ranges []TimeRange
+	for _, hours := range schedule.Weekly {
+		for _, day := range hours.Days {
+			if scheduleDays[day] == t.Weekday() {
+				ranges = append(ranges, hours.TimeRange)
+				break
+			}
+		}
+	}
+	return ranges
+}
+
+func (hours TimeRange) validate() error {
+	from, fromErr := clockMinutes(hours.From)
+	to, toErr := clockMinutes(hours.To)
+	if fromErr != nil || toErr != nil || from == 24*60 {
+		return fmt.Errorf("%w: invalid hours %s-%s, expected HH:MM", ErrInvalidSchedule, hours.From, hours.To)
+	}
+	if from == to {
+		return fmt.Errorf("%w: hours %s-%s are empty", ErrInvalidSchedule, hours.From, hours.To)
+	}
+	return nil
+}
+
+func (hours TimeRange) minutes() (int, int) {
+	from, _ := clockMinutes(hours.From)
+	to, _ := clockMinutes(hours.To)
+	return from, to
+}
+
+// clockMinutes reads HH:MM as minutes since midnight, 24:00 included
+func clockMinutes(clock string) (int, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ServedAt tells if the menu is served at t, which has to be in the venue's time zone
+func (menu MenuV2) ServedAt(t time.Time) bool {
+	return menu.Schedule == nil || menu.Schedule.ActiveAt(t)
+}
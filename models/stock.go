@@ -0,0 +1,129 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockLine is a quantity of a counted menu item
+type StockLine struct {
+	MenuItemID primitive.ObjectID `bson:"menu_item_id" json:"menu_item_id"`
+	Quantity   int                `bson:"quantity" json:"quantity"`
+}
+
+// StockAlert is what a low stock event on the venue's feed is about, Stock is what's left after the order that
+// brought it down
+type StockAlert struct {
+	MenuID     primitive.ObjectID `bson:"menu_id" json:"menu_id"`
+	MenuItemID primitive.ObjectID `bson:"menu_item_id" json:"menu_item_id"`
+	Name       string             `bson:"name" json:"name"`
+	Stock      int                `bson:"stock" json:"stock"`
+	LowStockAt int                `bson:"low_stock_at" json:"low_stock_at"`
+}
+
+// StockLines adds up the order's quantities per menu item, items ordered with different modifiers are on several lines
+func (order Order) StockLines() []StockLine {
+	var lines []StockLine
+	for _, item := range order.Items {
+		lines = addStockLine(lines, item.MenuItemID, item.Quantity)
+	}
+	return lines
+}
+
+// RefundStockLines is the stock a refund of some of the order's items gives back
+func RefundStockLines(items []RefundItem) []StockLine {
+	var lines []StockLine
+	for _, item := range items {
+		lines = addStockLine(lines, item.MenuItemID, item.Quantity)
+	}
+	return lines
+}
+
+// ReturnStock splits what the order took into what goes back for the given lines and what the order keeps. It never
+// gives back more of an item than the order took.
+func ReturnStock(taken []StockLine, lines []StockLine) (returned []StockLine, kept []StockLine) {
+	returning := map[primitive.ObjectID]int{}
+	for _, line := range lines {
+		returning[line.MenuItemID] += line.Quantity
+	}
+
+	for _, line := range taken {
+		quantity := returning[line.MenuItemID]
+		if quantity > line.Quantity {
+			quantity = line.Quantity
+		}
+		returning[line.MenuItemID] -= quantity
+		if quantity > 0 {
+			returned = append(returned, StockLine{MenuItemID: line.MenuItemID, Quantity: quantity})
+		}
+		if quantity < line.Quantity {
+			kept = append(kept, StockLine{MenuItemID: line.MenuItemID, Quantity: line.Quantity - quantity})
+		}
+	}
+	return returned, kept
+}
+
+// Item finds the item on the menu, deleted or not
+func (menu MenuV2) Item(itemID primitive.ObjectID) (MenuItemV2, bool) {
+	for _, item := range menu.Items {
+		if item.ID == itemID {
+			return item, true
+		}
+	}
+	return MenuItemV2{}, false
+}
+
+// Counted is whether the item's stock is kept track of
+func (item MenuItemV2) Counted() bool {
+	return item.Stock != nil
+}
+
+// LowOnStock is whether taking stock from before brought the item down to its alert level, so each drop alerts once
+func (item MenuItemV2) LowOnStock(before int) bool {
+	if item.Stock == nil {
+		return false
+	}
+	return *item.Stock <= item.LowStockAt && before > item.LowStockAt
+}
+
+// StockAlert is the alert for the item on the menu after its stock went down
+func (item MenuItemV2) StockAlert(menuID primitive.ObjectID) StockAlert {
+	alert := StockAlert{MenuID: menuID, MenuItemID: item.ID, Name: item.Name, LowStockAt: item.LowStockAt}
+	if item.Stock != nil {
+		alert.Stock = *item.Stock
+	}
+	return alert
+}
+
+// KeepLiveState gives the items that are on the menu already the stock and availability they have there. Orders
+// and the stock and availability routes change those while a new set of items is being put together, replacing the
+// items mustn't undo that.
+func KeepLiveState(items []MenuItemV2, current []MenuItemV2) []MenuItemV2 {
+	kept := make([]MenuItemV2, len(items))
+	for i, item := range items {
+		if live, ok := (MenuV2{Items: current}).Item(item.ID); ok {
+			item.Availability = live.Availability
+			item.SoldOutUntil = live.SoldOutUntil
+			item.Stock = nil
+			if live.Stock != nil {
+				stock := *live.Stock
+				item.Stock = &stock
+			}
+			item.LowStockAt = live.LowStockAt
+		}
+		kept[i] = item
+	}
+	return kept
+}
+
+func addStockLine(lines []StockLine, itemID primitive.ObjectID, quantity int) []StockLine {
+	if quantity <= 0 {
+		return lines
+	}
+	for i := range lines {
+		if lines[i].MenuItemID == itemID {
+			lines[i].Quantity += quantity
+			return lines
+		}
+	}
+	return append(lines, StockLine{MenuItemID: itemID, Quantity: quantity})
+}
@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Table is a place in the venue orders get delivered to, its QR code opens the menu with the table preselected
+type Table struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	VenueID   primitive.ObjectID  `bson:"venue_id" json:"venue_id"`
+	Name      string              `bson:"name" json:"name"`                                 // what's on the table, e.g. "12" or "Bar 3"
+	Zone      string              `bson:"zone" json:"zone"`                                 // e.g. "Terrace", empty if the venue has no zones
+	DeletedAt *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+}
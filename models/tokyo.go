@@ -10,6 +10,8 @@ type Location struct {
 	Latitude  float64 `bson:"latitude" json:"latitude"`
 	City      string  `bson:"city" json:"city"`
 	Country   string  `bson:"country" json:"country"`
+	// Point is Latitude and Longitude as GeoJSON for the 2dsphere index, nil while the venue hasn't been placed
+	Point *GeoPoint `bson:"point,omitempty" json:"point,omitempty"`
 }
 
 type Venue struct {
@@ -21,15 +23,30 @@ type Venue struct {
 	ProfilePicURL     string               `bson:"profile_pic_url" json:"profile_pic_url"`
 	StripeAccountID   string               `bson:"stripe_account_id" json:"stripe_account_id"`
 	OrderingSupported bool                 `bson:"ordering_supported" json:"ordering_supported"`
+	TimeZone          string               `bson:"time_zone" json:"time_zone"`                       // IANA name like Europe/Amsterdam, UTC if empty
+	BusinessDayStart  string               `bson:"business_day_start" json:"business_day_start"`     // HH:MM order numbers reset at, DefaultBusinessDayStart if empty
 	DeletedAt         *primitive.DateTime  `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+	// Set on venues migrated from a V1 menu, the V1 menu's ID and the user that owned it
+	LegacyMenuID primitive.ObjectID `bson:"legacy_menu_id,omitempty" json:"-"`
+	LegacyUserID string             `bson:"legacy_user_id,omitempty" json:"-"`
+	// OpeningHours is when the venue is open, always if nil. Orders stop KitchenClosesBefore minutes before closing.
+	OpeningHours        *Schedule `bson:"opening_hours,omitempty" json:"opening_hours,omitempty"`
+	KitchenClosesBefore int       `bson:"kitchen_closes_before,omitempty" json:"kitchen_closes_before,omitempty"`
 }
 
 type MenuV2 struct {
-	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	Name      string              `bson:"name" json:"name"`
-	VenueID   primitive.ObjectID  `bson:"venue_id" json:"venue_id"`
-	Items     []MenuItemV2        `bson:"items" json:"items"`
-	DeletedAt *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name    string             `bson:"name" json:"name"`
+	VenueID primitive.ObjectID `bson:"venue_id" json:"venue_id"`
+	Items   []MenuItemV2       `bson:"items" json:"items"`
+	// Version counts the changes to the menu, MenuVersions keep what it was at each of them
+	Version int `bson:"version" json:"version"`
+	// CategoryOrder is the order categories are shown in, categories not in it come after in any order
+	CategoryOrder []string `bson:"category_order" json:"category_order"`
+	// Schedule is when the menu is served, always if nil
+	Schedule     *Schedule           `bson:"schedule,omitempty" json:"schedule,omitempty"`
+	DeletedAt    *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+	LegacyMenuID primitive.ObjectID  `bson:"legacy_menu_id,omitempty" json:"-"`                // set when migrated from a V1 menu
 	// ProfileIconURL string			`bson:"profile_icon_url" json:"profile_icon_url"`
 	// BannerURL string             `bson:"banner_url" json:"banner_url"`
 }
@@ -65,53 +82,127 @@ type UserV2 struct {
 	Followers     []primitive.ObjectID `bson:"followers" json:"followers"`
 	Following     []primitive.ObjectID `bson:"following" json:"following"`
 	DeletedAt     *primitive.DateTime  `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+	LegacyUserID  primitive.ObjectID   `bson:"legacy_user_id,omitempty" json:"-"`                // set when migrated from a V1 user
 }
 
 type MenuItemV2 struct {
-	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
-	Name       string              `bson:"name" json:"name"`
-	Price      float64             `bson:"price" json:"price"`
-	Categories []string            `bson:"categories" json:"categories"`
-	DeletedAt  *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
-	// ADD BACK - Description, Dietary Restrictions, Ingredients, Allergens, Customizations
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Name           string              `bson:"name" json:"name"`
+	Price          Money               `bson:"price" json:"price"`
+	Description    string              `bson:"description" json:"description"`
+	Categories     []string            `bson:"categories" json:"categories"`
+	Ingredients    []string            `bson:"ingredients" json:"ingredients"`
+	Allergens      []Allergen          `bson:"allergens" json:"allergens"`
+	DietaryTags    []string            `bson:"dietary_tags" json:"dietary_tags"` // e.g. vegan, vegetarian, halal
+	ImageURL       string              `bson:"image_url" json:"image_url"`
+	Blurhash       BlurhashData        `bson:"blurhash" json:"blurhash"`
+	ModifierGroups []ModifierGroup     `bson:"modifier_groups" json:"modifier_groups"`
+	Availability   string              `bson:"availability,omitempty" json:"availability,omitempty"`     // empty is available
+	SoldOutUntil   *primitive.DateTime `bson:"sold_out_until,omitempty" json:"sold_out_until,omitempty"` // when a sold out item is back
+	Stock          *int                `bson:"stock,omitempty" json:"stock,omitempty"`                   // portions left, nil if not counted
+	LowStockAt     int                 `bson:"low_stock_at,omitempty" json:"low_stock_at,omitempty"`     // alert once stock gets this low
+	DeletedAt      *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`         // nil if not deleted
 }
 
-// Amounts are in cents : $1.00 = 100, $0.50 = 50, $245 = 24500
-//
-//	type Amount struct {
-//		Cents int64 `bson:"cents" json:"cents"`
-//	}
+// OrderItem Name and Price are snapshotted from the menu when the order is placed, the client only sends the ID, quantity
+// and selected modifiers. Price is the price of one unit including its modifiers.
 type OrderItem struct {
-	MenuItemID primitive.ObjectID `bson:"menu_item_id" json:"menu_item_id"`
-	Name       string             `bson:"name" json:"name"`
-	Price      float64            `bson:"price" json:"price"`
-	Quantity   int                `bson:"quantity" json:"quantity"`
+	MenuItemID primitive.ObjectID  `bson:"menu_item_id" json:"menu_item_id"`
+	Name       string              `bson:"name" json:"name"`
+	Price      Money               `bson:"price" json:"price"`
+	Quantity   int                 `bson:"quantity" json:"quantity"`
+	Modifiers  []OrderItemModifier `bson:"modifiers,omitempty" json:"modifiers,omitempty"`
 }
 
 type Order struct {
 	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	VenueID primitive.ObjectID `bson:"venue_id" json:"venue_id"`
-	// Number    int                 `bson:"number" json:"number"`
-	Items     []OrderItem         `bson:"items" json:"items"`
-	Total     float64             `bson:"total" json:"total"`
-	Timestamp primitive.DateTime  `bson:"timestamp" json:"timestamp"`
-	Status    string              `bson:"status" json:"status"`
+	MenuID  primitive.ObjectID `bson:"menu_id" json:"menu_id"`
+	// MenuVersion is the version of the menu the items were priced from
+	MenuVersion int `bson:"menu_version,omitempty" json:"menu_version,omitempty"`
+	// Number is what staff call the order by, it counts up from 1 per venue per business day
+	Number      int    `bson:"number,omitempty" json:"number,omitempty"`
+	BusinessDay string `bson:"business_day,omitempty" json:"business_day,omitempty"`
+	// Where the order gets delivered, TableName and Zone are snapshotted so renaming a table doesn't change past orders
+	TableID   primitive.ObjectID `bson:"table_id,omitempty" json:"table_id,omitempty"`
+	TableName string             `bson:"table_name,omitempty" json:"table_name,omitempty"`
+	Zone      string             `bson:"zone,omitempty" json:"zone,omitempty"`
+	// TableSignature comes from the table's QR code and proves the guest is at that table, it isn't stored
+	TableSignature string              `bson:"-" json:"table_signature,omitempty"`
+	Items          []OrderItem         `bson:"items" json:"items"`
+	Total          Money               `bson:"total" json:"total"`
+	Timestamp      primitive.DateTime  `bson:"timestamp" json:"timestamp"`
+	Status         OrderStatus         `bson:"status" json:"status"`
+	StatusHistory  []OrderStatusChange `bson:"status_history,omitempty" json:"status_history"`
+	// Stock is what the order took off the menu's counted items when it was paid, and hasn't given back yet
+	Stock     []StockLine         `bson:"stock,omitempty" json:"stock,omitempty"`
 	DeletedAt *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
 }
 
+// Payment status enum, open/complete/expired mirror the Stripe checkout session status
+const (
+	PaymentStatusOpen              = "open"
+	PaymentStatusComplete          = "complete"
+	PaymentStatusExpired           = "expired"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
 type Payment struct {
-	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
-	OrderID   primitive.ObjectID  `bson:"order_id" json:"order_id"`
-	StripeID  string              `bson:"stripe_id" json:"stripe_id"`
-	Amount    float64             `bson:"amount" json:"amount"`
-	Status    string              `bson:"status" json:"status"`
-	Timestamp primitive.DateTime  `bson:"timestamp" json:"timestamp"`
-	DeletedAt *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID         primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	StripeID        string              `bson:"stripe_id" json:"stripe_id"`
+	PaymentIntentID string              `bson:"payment_intent_id,omitempty" json:"payment_intent_id,omitempty"`
+	StripeAccountID string              `bson:"stripe_account_id,omitempty" json:"stripe_account_id,omitempty"`
+	Amount          Money               `bson:"amount" json:"amount"`
+	RefundedAmount  Money               `bson:"refunded_amount" json:"refunded_amount"`
+	Status          string              `bson:"status" json:"status"`
+	Timestamp       primitive.DateTime  `bson:"timestamp" json:"timestamp"`
+	UpdatedAt       *primitive.DateTime `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+	DeletedAt       *primitive.DateTime `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // nil if not deleted
+}
+
+// Refund status enum
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+type RefundItem struct {
+	MenuItemID primitive.ObjectID `bson:"menu_item_id" json:"menu_item_id"`
+	Quantity   int                `bson:"quantity" json:"quantity"`
+	Amount     Money              `bson:"amount" json:"amount"`
+}
+
+// Refund is a ledger entry for money returned on a payment, Items is empty for a refund of the whole remaining amount
+type Refund struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID        primitive.ObjectID `bson:"order_id" json:"order_id"`
+	PaymentID      primitive.ObjectID `bson:"payment_id" json:"payment_id"`
+	StripeRefundID string             `bson:"stripe_refund_id,omitempty" json:"stripe_refund_id,omitempty"`
+	Amount         Money              `bson:"amount" json:"amount"`
+	Items          []RefundItem       `bson:"items" json:"items"`
+	Reason         string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Status         string             `bson:"status" json:"status"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	Timestamp      primitive.DateTime `bson:"timestamp" json:"timestamp"`
+}
+
+// StripeEvent is the record of a processed webhook event, keyed by the Stripe event ID so redeliveries are detected
+type StripeEvent struct {
+	ID         string             `bson:"_id" json:"id"`
+	Type       string             `bson:"type" json:"type"`
+	Account    string             `bson:"account,omitempty" json:"account,omitempty"`
+	Created    primitive.DateTime `bson:"created" json:"created"`
+	ReceivedAt primitive.DateTime `bson:"received_at" json:"received_at"`
 }
 
-// StripeAccount temp hack figure out merchant accounts and their relation with venues
+// StripeAccount is a connected account, VenueID is the venue its checkouts pay out to and is mirrored on Venue.StripeAccountID
 type StripeAccount struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	StripeAccountID string             `bson:"stripe_account_id" json:"stripe_account_id"`
-	VenueID         primitive.ObjectID `bson:"venue_id" json:"venue_id"`
+	VenueID         primitive.ObjectID `bson:"venue_id,omitempty" json:"venue_id"`
+	LegacyVenueID   primitive.ObjectID `bson:"venueId,omitempty" json:"-"` // how links were stored before venue_id
 }
@@ -0,0 +1,69 @@
+package payments_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/payments"
+	"github.com/SaplingPay/server/payments/fake"
+	"github.com/SaplingPay/server/repositories/memory"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v78"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// paymentlessStore can't save payments
+type paymentlessStore struct {
+	*memory.Store
+}
+
+func (s paymentlessStore) CreatePayment(ctx context.Context, payment models.Payment) error {
+	return errors.New("write failed")
+}
+
+func TestCheckoutFailsWithoutPaymentRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("STRIPE_SUCCESS_URL_ORIGIN", "https://menu.example.com")
+
+	ctx := context.Background()
+	store := memory.New()
+	client := fake.New("https://api.example.com", "whsec_test")
+
+	venue, err := store.CreateVenue(ctx, models.Venue{Name: "Trattoria", OrderingSupported: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := client.NewAccount(&stripe.AccountParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddStripeAccount(ctx, account.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.LinkVenue(ctx, venue.ID, account.ID); err != nil {
+		t.Fatal(err)
+	}
+	order := models.Order{
+		ID:      primitive.NewObjectID(),
+		VenueID: venue.ID,
+		Status:  models.OrderStatusAwaitingPayment,
+		Items:   []models.OrderItem{{Name: "Pizza", Quantity: 1, Price: models.NewMoney(1250, "EUR")}},
+		Total:   models.NewMoney(1250, "EUR"),
+	}
+	if err := store.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/checkout/:orderId", payments.NewHandler(paymentlessStore{store}, client).CreateCheckoutSession)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/checkout/"+order.ID.Hex(), nil))
+
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != `{"error":"error creating payment"}` {
+		t.Fatalf("expected only the error, got %d %s", rec.Code, rec.Body.String())
+	}
+}
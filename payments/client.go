@@ -0,0 +1,43 @@
+package payments
+
+import (
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/account"
+	"github.com/stripe/stripe-go/v78/accountsession"
+	"github.com/stripe/stripe-go/v78/checkout/session"
+	"github.com/stripe/stripe-go/v78/refund"
+)
+
+// Client is the part of the Stripe API the payments handlers call, so they can run against a fake
+type Client interface {
+	NewAccount(params *stripe.AccountParams) (*stripe.Account, error)
+	GetAccount(id string, params *stripe.AccountParams) (*stripe.Account, error)
+	NewAccountSession(params *stripe.AccountSessionParams) (*stripe.AccountSession, error)
+	NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error)
+	NewRefund(params *stripe.RefundParams) (*stripe.Refund, error)
+}
+
+// StripeClient calls the real Stripe API with the key set on stripe.Key
+type StripeClient struct{}
+
+var _ Client = StripeClient{}
+
+func (StripeClient) NewAccount(params *stripe.AccountParams) (*stripe.Account, error) {
+	return account.New(params)
+}
+
+func (StripeClient) GetAccount(id string, params *stripe.AccountParams) (*stripe.Account, error) {
+	return account.GetByID(id, params)
+}
+
+func (StripeClient) NewAccountSession(params *stripe.AccountSessionParams) (*stripe.AccountSession, error) {
+	return accountsession.New(params)
+}
+
+func (StripeClient) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return session.New(params)
+}
+
+func (StripeClient) NewRefund(params *stripe.RefundParams) (*stripe.Refund, error) {
+	return refund.New(params)
+}
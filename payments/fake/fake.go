@@ -0,0 +1,462 @@
+// Package fake is a stand-in for Stripe so the pay-for-an-order flow runs on a laptop and in tests. Accounts,
+// checkout sessions and refunds live in memory with predictable IDs, and the webhook events Stripe would send
+// are signed with the webhook secret and delivered to the server's webhook route.
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/SaplingPay/server/payments"
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/webhook"
+)
+
+// Client implements payments.Client without calling Stripe
+type Client struct {
+	mu sync.Mutex
+
+	origin string
+	secret string
+
+	ids      map[string]int
+	accounts map[string]*stripe.Account
+	sessions map[string]*checkout
+	refunds  map[string]*stripe.Refund
+	events   []stripe.Event
+
+	deliver func(payload []byte)
+}
+
+// checkout is a session with the payment intent Stripe creates once the guest tries to pay
+type checkout struct {
+	session  *stripe.CheckoutSession
+	account  string
+	metadata map[string]string
+	refunded int64
+}
+
+var _ payments.Client = (*Client)(nil)
+
+// New returns a fake whose checkout URLs point at the server on origin and whose events are signed with secret
+func New(origin string, secret string) *Client {
+	return &Client{
+		origin:   origin,
+		secret:   secret,
+		ids:      map[string]int{},
+		accounts: map[string]*stripe.Account{},
+		sessions: map[string]*checkout{},
+		refunds:  map[string]*stripe.Refund{},
+	}
+}
+
+func (f *Client) NewAccount(params *stripe.AccountParams) (*stripe.Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	account := &stripe.Account{
+		ID:     f.id("acct"),
+		Object: "account",
+		// Onboarding is skipped, the account can take payments straight away
+		ChargesEnabled:   true,
+		PayoutsEnabled:   true,
+		DetailsSubmitted: true,
+	}
+	if params.Country != nil {
+		account.Country = *params.Country
+	}
+	f.accounts[account.ID] = account
+
+	copied := *account
+	return &copied, nil
+}
+
+func (f *Client) GetAccount(id string, params *stripe.AccountParams) (*stripe.Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	account, ok := f.accounts[id]
+	if !ok {
+		return nil, missing("account", id)
+	}
+
+	copied := *account
+	return &copied, nil
+}
+
+// SetChargesEnabled restricts or reinstates an account, like Stripe does when onboarding is incomplete
+func (f *Client) SetChargesEnabled(id string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	account, ok := f.accounts[id]
+	if !ok {
+		return missing("account", id)
+	}
+	account.ChargesEnabled = enabled
+
+	return nil
+}
+
+func (f *Client) NewAccountSession(params *stripe.AccountSessionParams) (*stripe.AccountSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := stripe.StringValue(params.Account)
+	if _, ok := f.accounts[id]; !ok {
+		return nil, missing("account", id)
+	}
+
+	return &stripe.AccountSession{
+		Object:       "account_session",
+		Account:      id,
+		ClientSecret: f.id("accs") + "_secret",
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	}, nil
+}
+
+func (f *Client) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	account := stripe.StringValue(params.StripeAccount)
+	if _, ok := f.accounts[account]; !ok {
+		return nil, missing("account", account)
+	}
+	if len(params.LineItems) == 0 {
+		return nil, invalid("line_items", "A checkout session needs at least one line item.")
+	}
+
+	session := &stripe.CheckoutSession{
+		Object:            "checkout.session",
+		ClientReferenceID: stripe.StringValue(params.ClientReferenceID),
+		Mode:              stripe.CheckoutSessionMode(stripe.StringValue(params.Mode)),
+		PaymentStatus:     stripe.CheckoutSessionPaymentStatusUnpaid,
+		Status:            stripe.CheckoutSessionStatusOpen,
+		SuccessURL:        stripe.StringValue(params.SuccessURL),
+		// Stripe only returns line items when they're expanded, the fake always has them for tests to look at
+		LineItems: &stripe.LineItemList{},
+	}
+	for _, item := range params.LineItems {
+		if item.PriceData == nil {
+			return nil, invalid("line_items", "The fake only supports line items with price_data.")
+		}
+		currency := stripe.Currency(stripe.StringValue(item.PriceData.Currency))
+		if session.Currency != "" && session.Currency != currency {
+			return nil, invalid("line_items", "All line items must use the same currency.")
+		}
+		session.Currency = currency
+		session.AmountTotal += stripe.Int64Value(item.PriceData.UnitAmount) * stripe.Int64Value(item.Quantity)
+		session.LineItems.Data = append(session.LineItems.Data, lineItem(item))
+	}
+	session.ID = f.id("cs_test")
+	session.URL = fmt.Sprintf("%s/fake-stripe/checkout/%s", f.origin, session.ID)
+
+	var metadata map[string]string
+	if params.PaymentIntentData != nil {
+		metadata = params.PaymentIntentData.Metadata
+	}
+	f.sessions[session.ID] = &checkout{session: session, account: account, metadata: metadata}
+
+	created := *session
+	return &created, nil
+}
+
+// NewRefund refunds a completed checkout. The charge.refunded event is delivered before it returns,
+// earlier than Stripe would, which the webhook has to cope with anyway since Stripe doesn't order events.
+func (f *Client) NewRefund(params *stripe.RefundParams) (*stripe.Refund, error) {
+	f.mu.Lock()
+
+	key := stripe.StringValue(params.IdempotencyKey)
+	if refund, ok := f.refunds[key]; ok && key != "" {
+		f.mu.Unlock()
+		issued := *refund
+		return &issued, nil
+	}
+
+	intent := stripe.StringValue(params.PaymentIntent)
+	c := f.byPaymentIntent(intent)
+	if c == nil || c.account != stripe.StringValue(params.StripeAccount) {
+		f.mu.Unlock()
+		return nil, missing("payment_intent", intent)
+	}
+
+	left := c.session.AmountTotal - c.refunded
+	amount := left
+	if params.Amount != nil {
+		amount = *params.Amount
+	}
+	if left == 0 {
+		f.mu.Unlock()
+		return nil, &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest, Code: stripe.ErrorCodeChargeAlreadyRefunded, Msg: "Charge has already been refunded."}
+	}
+	if amount <= 0 || amount > left {
+		f.mu.Unlock()
+		return nil, &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest, Code: stripe.ErrorCodeAmountTooLarge, Param: "amount", Msg: "Refund amount is greater than what's left on the charge."}
+	}
+	c.refunded += amount
+
+	refund := &stripe.Refund{
+		ID:            f.id("re"),
+		Object:        "refund",
+		Amount:        amount,
+		Currency:      c.session.Currency,
+		PaymentIntent: &stripe.PaymentIntent{ID: intent},
+		Reason:        stripe.RefundReason(stripe.StringValue(params.Reason)),
+		Metadata:      params.Metadata,
+		Status:        stripe.RefundStatusSucceeded,
+	}
+	if key != "" {
+		f.refunds[key] = refund
+	}
+
+	payload := f.emit("charge.refunded", c.account, map[string]interface{}{
+		"id":              "ch_" + intent[len("pi_"):],
+		"object":          "charge",
+		"amount":          c.session.AmountTotal,
+		"amount_captured": c.session.AmountTotal,
+		"amount_refunded": c.refunded,
+		"currency":        c.session.Currency,
+		"payment_intent":  intent,
+		"refunded":        c.refunded == c.session.AmountTotal,
+		"status":          "succeeded",
+	})
+	f.mu.Unlock()
+
+	f.send(payload)
+
+	issued := *refund
+	return &issued, nil
+}
+
+func lineItem(item *stripe.CheckoutSessionLineItemParams) *stripe.LineItem {
+	product := &stripe.Product{}
+	if item.PriceData.ProductData != nil {
+		product.Name = stripe.StringValue(item.PriceData.ProductData.Name)
+		product.Description = stripe.StringValue(item.PriceData.ProductData.Description)
+	}
+	unitAmount := stripe.Int64Value(item.PriceData.UnitAmount)
+	currency := stripe.Currency(stripe.StringValue(item.PriceData.Currency))
+	return &stripe.LineItem{
+		Object:         "item",
+		AmountSubtotal: unitAmount * stripe.Int64Value(item.Quantity),
+		AmountTotal:    unitAmount * stripe.Int64Value(item.Quantity),
+		Currency:       currency,
+		Description:    product.Name,
+		Price:          &stripe.Price{Currency: currency, UnitAmount: unitAmount, Product: product},
+		Quantity:       stripe.Int64Value(item.Quantity),
+	}
+}
+
+// Pay completes the checkout session as if the guest paid, and delivers checkout.session.completed
+func (f *Client) Pay(sessionID string) (*stripe.CheckoutSession, error) {
+	f.mu.Lock()
+
+	c, err := f.openSession(sessionID)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	f.paymentIntent(c)
+	c.session.Status = stripe.CheckoutSessionStatusComplete
+	c.session.PaymentStatus = stripe.CheckoutSessionPaymentStatusPaid
+	payload := f.emit("checkout.session.completed", c.account, sessionObject(c))
+	session := *c.session
+	f.mu.Unlock()
+
+	f.send(payload)
+	return &session, nil
+}
+
+// Decline fails the guest's payment attempt and delivers payment_intent.payment_failed, the session stays open
+func (f *Client) Decline(sessionID string) (*stripe.CheckoutSession, error) {
+	f.mu.Lock()
+
+	c, err := f.openSession(sessionID)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	intent := f.paymentIntent(c)
+	payload := f.emit("payment_intent.payment_failed", c.account, map[string]interface{}{
+		"id":       intent,
+		"object":   "payment_intent",
+		"amount":   c.session.AmountTotal,
+		"currency": c.session.Currency,
+		"metadata": c.metadata,
+		"status":   "requires_payment_method",
+	})
+	session := *c.session
+	f.mu.Unlock()
+
+	f.send(payload)
+	return &session, nil
+}
+
+// Expire expires the checkout session and delivers checkout.session.expired
+func (f *Client) Expire(sessionID string) (*stripe.CheckoutSession, error) {
+	f.mu.Lock()
+
+	c, err := f.openSession(sessionID)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	c.session.Status = stripe.CheckoutSessionStatusExpired
+	payload := f.emit("checkout.session.expired", c.account, sessionObject(c))
+	session := *c.session
+	f.mu.Unlock()
+
+	f.send(payload)
+	return &session, nil
+}
+
+// Events returns every event the fake has sent, oldest first
+func (f *Client) Events() []stripe.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]stripe.Event(nil), f.events...)
+}
+
+// Deliver sends the events to the webhook served by handler on path, from now on every event is delivered there
+func (f *Client) Deliver(handler http.Handler, path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deliver = func(payload []byte) {
+		signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: f.secret})
+
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Stripe-Signature", signed.Header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			log.Println("[fakeStripe]", "webhook returned", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func (f *Client) send(payload []byte) {
+	f.mu.Lock()
+	deliver := f.deliver
+	f.mu.Unlock()
+
+	if deliver != nil {
+		deliver(payload)
+	}
+}
+
+// emit records an event shaped like Stripe's and returns its payload, f.mu must be held
+func (f *Client) emit(eventType string, account string, object map[string]interface{}) []byte {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":               f.id("evt"),
+		"object":           "event",
+		"account":          account,
+		"api_version":      stripe.APIVersion,
+		"created":          time.Now().Unix(),
+		"livemode":         false,
+		"pending_webhooks": 1,
+		"type":             eventType,
+		"data":             map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		// Everything in the payload is built above, marshalling it can't fail
+		panic(err)
+	}
+
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		panic(err)
+	}
+	f.events = append(f.events, event)
+
+	return payload
+}
+
+func (f *Client) openSession(id string) (*checkout, error) {
+	c, ok := f.sessions[id]
+	if !ok {
+		return nil, missing("checkout.session", id)
+	}
+	if c.session.Status != stripe.CheckoutSessionStatusOpen {
+		return nil, invalid("status", fmt.Sprintf("The checkout session is %s.", c.session.Status))
+	}
+	return c, nil
+}
+
+// paymentIntent returns the session's intent, creating it on the guest's first attempt to pay
+func (f *Client) paymentIntent(c *checkout) string {
+	if c.session.PaymentIntent == nil {
+		c.session.PaymentIntent = &stripe.PaymentIntent{ID: f.id("pi")}
+	}
+	return c.session.PaymentIntent.ID
+}
+
+func (f *Client) byPaymentIntent(id string) *checkout {
+	for _, c := range f.sessions {
+		if c.session.PaymentIntent != nil && c.session.PaymentIntent.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// id hands out IDs numbered per prefix, so a test run always sees the same ones
+func (f *Client) id(prefix string) string {
+	f.ids[prefix]++
+	return fmt.Sprintf("%s_fake%04d", prefix, f.ids[prefix])
+}
+
+func sessionObject(c *checkout) map[string]interface{} {
+	object := map[string]interface{}{
+		"id":                  c.session.ID,
+		"object":              "checkout.session",
+		"amount_total":        c.session.AmountTotal,
+		"client_reference_id": c.session.ClientReferenceID,
+		"currency":            c.session.Currency,
+		"mode":                c.session.Mode,
+		"payment_intent":      nil,
+		"payment_status":      c.session.PaymentStatus,
+		"status":              c.session.Status,
+	}
+	if c.session.PaymentIntent != nil {
+		object["payment_intent"] = c.session.PaymentIntent.ID
+	}
+	return object
+}
+
+func missing(resource string, id string) error {
+	return &stripe.Error{
+		HTTPStatusCode: http.StatusNotFound,
+		Type:           stripe.ErrorTypeInvalidRequest,
+		Code:           stripe.ErrorCodeResourceMissing,
+		Msg:            fmt.Sprintf("No such %s: '%s'", resource, id),
+	}
+}
+
+func invalid(param string, msg string) error {
+	return &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest, Param: param, Msg: msg}
+}
+
+// Session returns the checkout session as it stands
+func (f *Client) Session(id string) (*stripe.CheckoutSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.sessions[id]
+	if !ok {
+		return nil, missing("checkout.session", id)
+	}
+
+	session := *c.session
+	return &session, nil
+}
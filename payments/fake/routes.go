@@ -0,0 +1,89 @@
+package fake
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v78"
+)
+
+var checkoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake Stripe Checkout</title></head>
+<body>
+<h1>Fake Stripe Checkout</h1>
+<p>Session {{.ID}} for order {{.ClientReferenceID}}</p>
+<p>{{.Amount}} {{.Currency}}, {{.Status}}</p>
+{{if eq .Status "open"}}
+<form method="post" action="{{.ID}}/pay"><button>Pay</button></form>
+<form method="post" action="{{.ID}}/decline"><button>Decline card</button></form>
+<form method="post" action="{{.ID}}/expire"><button>Expire session</button></form>
+{{end}}
+</body>
+</html>
+`))
+
+// AddRoutes serves the checkout page the fake's session URLs point at, and delivers the events
+// of what the guest does there to the webhook on webhookPath
+func (f *Client) AddRoutes(r *gin.Engine, webhookPath string) {
+	f.Deliver(r, webhookPath)
+
+	checkoutRoutes := r.Group("/fake-stripe/checkout")
+	{
+		checkoutRoutes.GET("/:sessionId", f.checkoutPage)
+		checkoutRoutes.POST("/:sessionId/:outcome", f.checkoutOutcome)
+	}
+}
+
+func (f *Client) checkoutPage(c *gin.Context) {
+	session, err := f.Session(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	err = checkoutPage.Execute(c.Writer, map[string]interface{}{
+		"ID":                session.ID,
+		"ClientReferenceID": session.ClientReferenceID,
+		"Amount":            float64(session.AmountTotal) / 100,
+		"Currency":          strings.ToUpper(string(session.Currency)),
+		"Status":            session.Status,
+	})
+	if err != nil {
+		log.Println("[fakeStripe]", "checkoutPage", err)
+	}
+}
+
+func (f *Client) checkoutOutcome(c *gin.Context) {
+	outcomes := map[string]func(string) (*stripe.CheckoutSession, error){
+		"pay":     f.Pay,
+		"decline": f.Decline,
+		"expire":  f.Expire,
+	}
+	outcome, ok := outcomes[c.Param("outcome")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown outcome, use pay, decline or expire"})
+		return
+	}
+
+	session, err := outcome(c.Param("sessionId"))
+	if stripeErr, ok := err.(*stripe.Error); ok {
+		c.JSON(stripeErr.HTTPStatusCode, gin.H{"error": stripeErr.Msg})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Like Stripe, only a paid checkout sends the guest on to the success URL
+	if session.Status == stripe.CheckoutSessionStatusComplete {
+		c.Redirect(http.StatusSeeOther, session.SuccessURL)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/fake-stripe/checkout/"+session.ID)
+}
@@ -0,0 +1,243 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v78"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RefundRequest struct {
+	// Items to refund, leave empty to refund everything that hasn't been refunded yet
+	Items  []models.RefundItem `json:"items"`
+	Reason string              `json:"reason"`
+}
+
+var refundReasons = map[string]bool{
+	string(stripe.RefundReasonDuplicate):           true,
+	string(stripe.RefundReasonFraudulent):          true,
+	string(stripe.RefundReasonRequestedByCustomer): true,
+}
+
+// RefundOrder refunds a whole order or some of its items on the connected account the order was paid to
+func (h *Handler) RefundOrder(c *gin.Context) {
+	log.Println("[stripeHandler]", "RefundOrder")
+
+	orderId, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	var request RefundRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Reason != "" && !refundReasons[request.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid refund reason"})
+		return
+	}
+
+	order, err := h.store.GetOrderByID(c.Request.Context(), orderId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	payment, err := h.store.GetCapturedPaymentForOrder(c.Request.Context(), orderId)
+	if errors.Is(err, repositories.ErrPaymentNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "order has no captured payment to refund"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous, err := h.store.GetRefundsByOrderID(c.Request.Context(), orderId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, amount, err := refundAmount(order, payment, previous, request.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ledgerEntry := models.Refund{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		PaymentID: payment.ID,
+		Amount:    amount,
+		Items:     items,
+		Reason:    request.Reason,
+		Status:    models.RefundStatusPending,
+		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	reserved, err := h.store.ReserveRefund(c.Request.Context(), ledgerEntry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !reserved {
+		c.JSON(http.StatusConflict, gin.H{"error": "refund exceeds the amount left on the payment"})
+		return
+	}
+
+	stripeAccountID := payment.StripeAccountID
+	if stripeAccountID == "" {
+		// Payments made before the account was recorded on them went to the venue's account
+		linked, err := h.store.GetStripeAccountByVenueID(c.Request.Context(), order.VenueID)
+		if err != nil {
+			h.failRefund(c, ledgerEntry, errNoStripeAccount)
+			return
+		}
+		stripeAccountID = linked.StripeAccountID
+	}
+
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(payment.PaymentIntentID),
+		Amount:        stripe.Int64(amount.Amount),
+		Metadata: map[string]string{
+			"order_id":  order.ID.Hex(),
+			"refund_id": ledgerEntry.ID.Hex(),
+		},
+	}
+	if request.Reason != "" {
+		params.Reason = stripe.String(request.Reason)
+	}
+	params.SetStripeAccount(stripeAccountID)
+	params.SetIdempotencyKey(ledgerEntry.ID.Hex())
+
+	result, err := h.client.NewRefund(params)
+	if err != nil {
+		h.failRefund(c, ledgerEntry, err)
+		return
+	}
+
+	ledgerEntry.StripeRefundID = result.ID
+	ledgerEntry.Status = models.RefundStatusSucceeded
+	payment, err = h.store.CompleteRefund(c.Request.Context(), ledgerEntry)
+	if err != nil {
+		// Stripe has the money moving already, the charge.refunded webhook will bring the payment status in line
+		log.Println("[stripeHandler]", "RefundOrder", "unable to record refund", ledgerEntry.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "refund issued but not recorded"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund": ledgerEntry, "payment": payment})
+}
+
+// GetOrderRefunds returns the refund ledger of an order
+func (h *Handler) GetOrderRefunds(c *gin.Context) {
+	orderId, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	refunds, err := h.store.GetRefundsByOrderID(c.Request.Context(), orderId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+func (h *Handler) failRefund(c *gin.Context, ledgerEntry models.Refund, err error) {
+	log.Println("[stripeHandler]", "RefundOrder", ledgerEntry.ID.Hex(), err)
+	if failErr := h.store.FailRefund(c.Request.Context(), ledgerEntry, err.Error()); failErr != nil {
+		log.Println("[stripeHandler]", "RefundOrder", "unable to release refund", ledgerEntry.ID.Hex(), failErr)
+	}
+	handleError(c, err)
+}
+
+// refundAmount prices the requested items from the order and checks none is refunded more often than it was ordered.
+// Without items it returns whatever is left on the payment.
+func refundAmount(order models.Order, payment models.Payment, previous []models.Refund, requested []models.RefundItem) ([]models.RefundItem, models.Money, error) {
+	if len(requested) == 0 {
+		amount := payment.Amount.Sub(payment.RefundedAmount)
+		if amount.Amount <= 0 {
+			return nil, models.Money{}, fmt.Errorf("payment has already been fully refunded")
+		}
+		return []models.RefundItem{}, amount, nil
+	}
+
+	// Lines of the same menu item can differ in price through their modifiers, refunding an item takes the
+	// cheapest units first so it never pays out more than was paid for what is left
+	ordered := map[primitive.ObjectID]int{}
+	lines := map[primitive.ObjectID][]models.OrderItem{}
+	for _, item := range order.Items {
+		ordered[item.MenuItemID] += item.Quantity
+		lines[item.MenuItemID] = append(lines[item.MenuItemID], item)
+	}
+	for _, items := range lines {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Price.Amount < items[j].Price.Amount })
+	}
+
+	refunded := map[primitive.ObjectID]int{}
+	for _, entry := range previous {
+		if entry.Status == models.RefundStatusFailed {
+			continue
+		}
+		for _, item := range entry.Items {
+			refunded[item.MenuItemID] += item.Quantity
+		}
+	}
+
+	amount := models.NewMoney(0, payment.Amount.Currency)
+	items := make([]models.RefundItem, 0, len(requested))
+	for _, item := range requested {
+		if item.Quantity <= 0 {
+			return nil, models.Money{}, fmt.Errorf("quantity for item %s must be positive", item.MenuItemID.Hex())
+		}
+		from := refunded[item.MenuItemID]
+		refunded[item.MenuItemID] += item.Quantity
+		if refunded[item.MenuItemID] > ordered[item.MenuItemID] {
+			return nil, models.Money{}, fmt.Errorf("item %s can't be refunded more often than it was ordered", item.MenuItemID.Hex())
+		}
+
+		item.Amount = unitsAmount(lines[item.MenuItemID], from, item.Quantity, payment.Amount.Currency)
+		amount = amount.Add(item.Amount)
+		items = append(items, item)
+	}
+
+	return items, amount, nil
+}
+
+// unitsAmount adds up the price of quantity units of the lines, skipping the first skip units
+func unitsAmount(lines []models.OrderItem, skip int, quantity int, currency string) models.Money {
+	amount := models.NewMoney(0, currency)
+	for _, line := range lines {
+		if quantity == 0 {
+			break
+		}
+		if skip >= line.Quantity {
+			skip -= line.Quantity
+			continue
+		}
+
+		take := line.Quantity - skip
+		if take > quantity {
+			take = quantity
+		}
+		amount = amount.Add(line.Price.Times(take))
+		quantity -= take
+		skip = 0
+	}
+	return amount
+}
@@ -1,36 +1,48 @@
 package payments
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/SaplingPay/server/models"
 	"github.com/SaplingPay/server/repositories"
 	"github.com/SaplingPay/server/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v78"
-	"github.com/stripe/stripe-go/v78/account"
-	"github.com/stripe/stripe-go/v78/accountsession"
-	"github.com/stripe/stripe-go/v78/checkout/session"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func AddStripRoutes(r *gin.Engine) {
+// Handler serves the Stripe routes and webhook from the given store, calling Stripe through client
+type Handler struct {
+	store  repositories.Store
+	client Client
+}
+
+func NewHandler(store repositories.Store, client Client) *Handler {
+	return &Handler{store: store, client: client}
+}
+
+func (h *Handler) AddStripRoutes(r *gin.Engine) {
 	stripeRoutes := r.Group("/payments")
 	{
-		stripeRoutes.GET("/accounts", GetAccounts)
-
-		stripeRoutes.POST("/linkAccount", LinkAccount)
-		stripeRoutes.POST("/account", CreateAccount)
-		stripeRoutes.POST("/accountSession", CreateAccountSession)
-		stripeRoutes.POST("/checkout/:orderId", CreateCheckoutSession)
+		stripeRoutes.GET("/accounts", h.GetAccounts)
+
+		stripeRoutes.POST("/linkAccount", h.LinkAccount)
+		stripeRoutes.POST("/account", h.CreateAccount)
+		stripeRoutes.POST("/accountSession", h.CreateAccountSession)
+		stripeRoutes.POST("/checkout/:orderId", h.CreateCheckoutSession)
+		stripeRoutes.POST("/refund/:orderId", h.RefundOrder)
+		stripeRoutes.GET("/refunds/:orderId", h.GetOrderRefunds)
 	}
 }
-func GetAccounts(c *gin.Context) {
-	accounts, err := repositories.GetStripeAccounts()
+func (h *Handler) GetAccounts(c *gin.Context) {
+	accounts, err := h.store.GetStripeAccounts(c.Request.Context())
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, &gin.H{"error": "unable to fetch stripe accounts"})
@@ -39,7 +51,7 @@ func GetAccounts(c *gin.Context) {
 	c.JSON(http.StatusOK, &gin.H{"accounts": accounts})
 }
 
-func CreateAccountSession(c *gin.Context) {
+func (h *Handler) CreateAccountSession(c *gin.Context) {
 	log.Println("[stripeHandler]", "CreateAccountSession")
 
 	type RequestBody struct {
@@ -72,7 +84,7 @@ func CreateAccountSession(c *gin.Context) {
 		},
 	}
 
-	accountSession, err := accountsession.New(params)
+	accountSession, err := h.client.NewAccountSession(params)
 
 	if err != nil {
 		log.Printf("An error occurred when calling the Stripe API to create an account session: %v", err)
@@ -82,8 +94,8 @@ func CreateAccountSession(c *gin.Context) {
 	c.JSON(http.StatusOK, &gin.H{"client_secret": accountSession.ClientSecret})
 }
 
-func CreateAccount(c *gin.Context) {
-	account, err := account.New(&stripe.AccountParams{
+func (h *Handler) CreateAccount(c *gin.Context) {
+	account, err := h.client.NewAccount(&stripe.AccountParams{
 		Controller: &stripe.AccountControllerParams{
 			StripeDashboard: &stripe.AccountControllerStripeDashboardParams{
 				Type: stripe.String("none"),
@@ -109,7 +121,7 @@ func CreateAccount(c *gin.Context) {
 		return
 	}
 
-	_, err = repositories.AddStripeAccount(account.ID)
+	_, err = h.store.AddStripeAccount(c.Request.Context(), account.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, &gin.H{"error": "unable to save account"})
 		return
@@ -118,7 +130,7 @@ func CreateAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, &gin.H{"account": account.ID})
 }
 
-func LinkAccount(c *gin.Context) {
+func (h *Handler) LinkAccount(c *gin.Context) {
 	var requestBody models.StripeAccount
 	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
 	if err != nil {
@@ -126,8 +138,13 @@ func LinkAccount(c *gin.Context) {
 		return
 	}
 
-	err = repositories.LinkVenue(requestBody.VenueID, requestBody.StripeAccountID)
+	err = h.store.LinkVenue(c.Request.Context(), requestBody.VenueID, requestBody.StripeAccountID)
+	if err == repositories.ErrStripeAccountNotFound || err == repositories.ErrVenueNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		log.Println("[stripeHandler]", "LinkAccount", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "error linking account"})
 		return
 	}
@@ -135,7 +152,12 @@ func LinkAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, requestBody)
 }
 
-func CreateCheckoutSession(c *gin.Context) {
+// awaitingPayment tells if a checkout can be started for an order in the status
+func awaitingPayment(status models.OrderStatus) bool {
+	return status == models.OrderStatusAwaitingPayment || status == models.OrderStatusSent
+}
+
+func (h *Handler) CreateCheckoutSession(c *gin.Context) {
 	orderIdParam := c.Param("orderId")
 
 	orderId, err := primitive.ObjectIDFromHex(orderIdParam)
@@ -144,30 +166,67 @@ func CreateCheckoutSession(c *gin.Context) {
 		return
 	}
 
-	order, err := repositories.GetOrderByID(orderId)
-	log.Println(order)
+	order, err := h.store.GetOrderByID(c.Request.Context(), orderId)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Order ID"})
 		return
 	}
 
-	// _, err = repositories.GetStripeAccountByVenueId(order.VenueID)
+	if !awaitingPayment(order.Status) && order.Status != models.OrderStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment"})
+		return
+	}
+
+	// Everything that can turn the guest away is checked before a draft moves on, so it stays a draft if it is
+	venue, err := h.store.GetVenueByID(c.Request.Context(), order.VenueID)
+	if errors.Is(err, repositories.ErrVenueNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "venue not found"})
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	status, err := venue.OpeningStatusAt(time.Now())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	if err := venue.CheckOrdering(status); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "next_open": status.NextOpen})
+		return
+	}
+
+	stripeAccountID, err := h.venueStripeAccount(c.Request.Context(), venue)
+	if err == errNoStripeAccount || err == errChargesDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
 
-	// if err != nil {
-	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "No Stripe Account Linked"})
-	// 	return
-	// }
+	if order.Status == models.OrderStatusDraft {
+		order, err = h.store.TransitionOrder(c.Request.Context(), orderId, models.OrderStatusAwaitingPayment, models.OrderTriggerAPI, "")
+		if err != nil && !errors.Is(err, repositories.ErrIllegalTransition) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !awaitingPayment(order.Status) {
+			c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment"})
+			return
+		}
+	}
 
 	var lineItems []*stripe.CheckoutSessionLineItemParams
 
 	for _, item := range order.Items {
 		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
 			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String(string(stripe.CurrencyEUR)),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name: stripe.String(item.Name),
-				},
-				UnitAmount: stripe.Int64(int64(item.Price * 100)),
+				Currency:    stripe.String(item.Price.StripeCurrency()),
+				ProductData: productData(item),
+				UnitAmount:  stripe.Int64(item.Price.Amount),
 			},
 			// TODO Handle quantity better
 			Quantity: stripe.Int64(int64(item.Quantity)),
@@ -188,22 +247,37 @@ func CreateCheckoutSession(c *gin.Context) {
 		// }),
 		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
 			ApplicationFeeAmount: stripe.Int64(0),
+			// Lets the webhook find the payment for intent events that arrive before the session completes
+			Metadata: map[string]string{"order_id": orderId.Hex()},
 		},
-		Mode:          stripe.String(string(stripe.CheckoutSessionModePayment)),
-		SuccessURL:    stripe.String(fmt.Sprintf("%s/order-received?order_id=%s", successURL, orderId.Hex())),
-		CustomerEmail: stripe.String("hello@saplingpay.com"),
+		ClientReferenceID: stripe.String(orderId.Hex()),
+		Mode:              stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL:        stripe.String(orderReceivedURL(successURL, order)),
+		CustomerEmail:     stripe.String("hello@saplingpay.com"),
 	}
-	params.SetStripeAccount(os.Getenv("STRIPE_HARD_CODED_ACCOUNT_ID"))
-	result, err := session.New(params)
+	params.SetStripeAccount(stripeAccountID)
+	result, err := h.client.NewCheckoutSession(params)
 	if err != nil {
 		handleError(c, err)
 		return
 	}
 
-	_, err = repositories.CreatePayment(&order, result)
+	payment := models.Payment{
+		ID:              primitive.NewObjectID(),
+		Amount:          models.NewMoney(result.AmountTotal, string(result.Currency)),
+		RefundedAmount:  models.NewMoney(0, string(result.Currency)),
+		Status:          string(result.Status),
+		OrderID:         order.ID,
+		StripeID:        result.ID,
+		StripeAccountID: stripeAccountID,
+		Timestamp:       primitive.NewDateTimeFromTime(time.Now()),
+	}
+	err = h.store.CreatePayment(c.Request.Context(), payment)
 
+	// The webhook finds the order through the payment, a checkout without one could never complete
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.ErrorJson("error creating payment"))
+		return
 	}
 
 	// if redirect doesn't work with frontend switch to json
@@ -211,6 +285,36 @@ func CreateCheckoutSession(c *gin.Context) {
 	// c.Redirect(http.StatusFound, result.URL)
 }
 
+var errNoStripeAccount = errors.New("venue has no Stripe account linked")
+var errChargesDisabled = errors.New("venue's Stripe account can't accept payments yet")
+
+// venueStripeAccount returns the connected account checkout funds for the venue are routed to. That's the venue's
+// StripeAccountID, venues linked before it was kept on the venue are looked up from the account's side.
+func (h *Handler) venueStripeAccount(ctx context.Context, venue models.Venue) (string, error) {
+	accountID := venue.StripeAccountID
+	if accountID == "" {
+		linked, err := h.store.GetStripeAccountByVenueID(ctx, venue.ID)
+		if errors.Is(err, repositories.ErrStripeAccountNotFound) {
+			return "", errNoStripeAccount
+		}
+		if err != nil {
+			return "", err
+		}
+		accountID = linked.StripeAccountID
+	}
+
+	// Onboarding can be unfinished or the account restricted later on, so ask Stripe rather than trusting our copy
+	stripeAccount, err := h.client.GetAccount(accountID, nil)
+	if err != nil {
+		return "", err
+	}
+	if !stripeAccount.ChargesEnabled {
+		return "", errChargesDisabled
+	}
+
+	return stripeAccount.ID, nil
+}
+
 func handleError(c *gin.Context, err error) {
 	if stripeErr, ok := err.(*stripe.Error); ok {
 		c.JSON(http.StatusInternalServerError, &gin.H{
@@ -222,3 +326,23 @@ func handleError(c *gin.Context, err error) {
 		})
 	}
 }
+
+// orderReceivedURL is where the guest lands after paying, with the number they'll be called by
+func orderReceivedURL(origin string, order models.Order) string {
+	url := fmt.Sprintf("%s/order-received?order_id=%s", origin, order.ID.Hex())
+	if order.Number > 0 {
+		url += fmt.Sprintf("&order_number=%d", order.Number)
+	}
+	return url
+}
+
+// productData names the line item, with the selected modifiers as its description since Stripe rejects an empty one
+func productData(item models.OrderItem) *stripe.CheckoutSessionLineItemPriceDataProductDataParams {
+	product := &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+		Name: stripe.String(item.Name),
+	}
+	if summary := item.ModifierSummary(); summary != "" {
+		product.Description = stripe.String(summary)
+	}
+	return product
+}
@@ -0,0 +1,191 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const webhookTag = "[stripeWebhook]"
+
+// Stripe doesn't send payloads bigger than this, anything larger isn't from Stripe
+const maxWebhookBodyBytes = int64(65536)
+
+// paymentStatusRank orders payment statuses so events arriving out of order can't move a payment backwards
+var paymentStatusRank = map[string]int{
+	models.PaymentStatusOpen:              0,
+	models.PaymentStatusFailed:            1,
+	models.PaymentStatusExpired:           2,
+	models.PaymentStatusComplete:          2,
+	models.PaymentStatusPartiallyRefunded: 3,
+	models.PaymentStatusRefunded:          4,
+}
+
+// HandleWebhook verifies the Stripe signature and applies the event to the matching payment and order
+func (h *Handler) HandleWebhook(c *gin.Context) {
+	secret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println(webhookTag, "STRIPE_WEBHOOK_SECRET not set")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webhook not configured"})
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodyBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read body"})
+		return
+	}
+
+	// Connected accounts may be pinned to another API version, we only read the fields we need
+	event, err := webhook.ConstructEventWithOptions(payload, c.GetHeader("Stripe-Signature"), secret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		log.Println(webhookTag, "signature verification failed:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid signature"})
+		return
+	}
+
+	applied, err := h.ProcessEvent(c.Request.Context(), event)
+	if errors.Is(err, repositories.ErrPaymentNotFound) {
+		// Let Stripe retry, the event may have overtaken the checkout that creates the payment
+		log.Println(webhookTag, event.ID, event.Type, "no matching payment")
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println(webhookTag, event.ID, event.Type, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println(webhookTag, event.ID, event.Type, "applied:", applied)
+	c.JSON(http.StatusOK, gin.H{"received": true, "applied": applied})
+}
+
+// ProcessEvent applies an already verified Stripe event. It returns false for event types we don't handle,
+// duplicate deliveries and events that arrive after the payment has already moved past them.
+func (h *Handler) ProcessEvent(ctx context.Context, event stripe.Event) (bool, error) {
+	update, err := paymentUpdateForEvent(event)
+	if err != nil || update == nil {
+		return false, err
+	}
+
+	record := models.StripeEvent{
+		ID:         event.ID,
+		Type:       string(event.Type),
+		Account:    event.Account,
+		Created:    primitive.NewDateTimeFromTime(time.Unix(event.Created, 0)),
+		ReceivedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	return h.store.ApplyPaymentEvent(ctx, record, *update)
+}
+
+// paymentUpdateForEvent maps a Stripe event onto the payment transition it causes, nil if the event is ignored
+func paymentUpdateForEvent(event stripe.Event) (*repositories.PaymentEventUpdate, error) {
+	if event.Data == nil {
+		return nil, errors.New("event has no data")
+	}
+
+	switch event.Type {
+	case "checkout.session.completed":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, err
+		}
+		// Delayed payment methods complete the session before the money arrives
+		if session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+			return nil, nil
+		}
+		update := transition(models.PaymentStatusComplete, models.OrderStatusPaid)
+		update.Match = repositories.PaymentMatch{StripeID: session.ID}
+		if session.PaymentIntent != nil {
+			update.PaymentIntentID = session.PaymentIntent.ID
+		}
+		return update, nil
+
+	case "checkout.session.expired":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, err
+		}
+		// The order stays unpaid so the guest can start a new checkout
+		update := transition(models.PaymentStatusExpired, "")
+		update.Match = repositories.PaymentMatch{StripeID: session.ID}
+		return update, nil
+
+	case "payment_intent.payment_failed":
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return nil, err
+		}
+		// The session stays open after a declined card, so the order keeps waiting for payment
+		update := transition(models.PaymentStatusFailed, "")
+		update.Match = matchPaymentIntent(intent.ID, intent.Metadata)
+		update.PaymentIntentID = intent.ID
+		return update, nil
+
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, err
+		}
+		if charge.PaymentIntent == nil {
+			return nil, errors.New("refunded charge has no payment intent")
+		}
+		update := transition(models.PaymentStatusRefunded, models.OrderStatusRefunded)
+		if charge.AmountRefunded < charge.Amount {
+			update = transition(models.PaymentStatusPartiallyRefunded, models.OrderStatusPartiallyRefunded)
+			// Every further partial refund raises the refunded amount
+			update.FromStatuses = append(update.FromStatuses, models.PaymentStatusPartiallyRefunded)
+		}
+		update.Match = repositories.PaymentMatch{PaymentIntentID: charge.PaymentIntent.ID}
+		// Refunds issued from the Stripe dashboard count against what's left to refund too
+		update.RefundedAmount = charge.AmountRefunded
+		return update, nil
+	}
+
+	return nil, nil
+}
+
+func transition(paymentStatus string, orderStatus models.OrderStatus) *repositories.PaymentEventUpdate {
+	return &repositories.PaymentEventUpdate{
+		FromStatuses: fromStatuses(paymentStatus),
+		Status:       paymentStatus,
+		OrderStatus:  orderStatus,
+	}
+}
+
+// fromStatuses returns the payment statuses that rank below the target status
+func fromStatuses(to string) []string {
+	var from []string
+	for status, rank := range paymentStatusRank {
+		if rank < paymentStatusRank[to] {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+// matchPaymentIntent matches the payment by intent, falling back to the order ID we put on the intent metadata
+// because the intent isn't linked to the payment until the checkout session completes
+func matchPaymentIntent(paymentIntentID string, metadata map[string]string) repositories.PaymentMatch {
+	match := repositories.PaymentMatch{PaymentIntentID: paymentIntentID}
+	if orderID, err := primitive.ObjectIDFromHex(metadata["order_id"]); err == nil {
+		match.OrderID = orderID
+	}
+	return match
+}
@@ -0,0 +1,178 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories/memory"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v78/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// The order and checkout session the fixtures in testdata refer to
+var fixtureOrderID, _ = primitive.ObjectIDFromHex("65f0c0ffee0000000000a001")
+
+const fixtureSessionID = "cs_test_a1Session0001"
+
+type webhookServer struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *memory.Store
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("STRIPE_WEBHOOK_SECRET", testWebhookSecret)
+
+	store := memory.New()
+	ctx := context.Background()
+	if err := store.CreateOrder(ctx, models.Order{
+		ID:     fixtureOrderID,
+		Status: models.OrderStatusAwaitingPayment,
+		Total:  models.NewMoney(2598, "EUR"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreatePayment(ctx, models.Payment{
+		ID:        primitive.NewObjectID(),
+		OrderID:   fixtureOrderID,
+		StripeID:  fixtureSessionID,
+		Amount:    models.NewMoney(2598, "EUR"),
+		Status:    models.PaymentStatusOpen,
+		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/webhook", NewHandler(store, nil).HandleWebhook)
+
+	return &webhookServer{t: t, router: router, store: store}
+}
+
+// deliver sends a fixture from testdata the way Stripe would, signed with the webhook secret
+func (s *webhookServer) deliver(fixture string, secret string) (int, bool) {
+	s.t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join("testdata", fixture+".json"))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: secret})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", signed.Header)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var body struct {
+		Applied bool `json:"applied"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body.Applied
+}
+
+func (s *webhookServer) state() (models.Payment, models.Order) {
+	s.t.Helper()
+
+	ctx := context.Background()
+	payments, err := s.store.GetAllPayments(ctx)
+	if err != nil || len(payments) != 1 {
+		s.t.Fatalf("expected one payment, got %d (%v)", len(payments), err)
+	}
+	order, err := s.store.GetOrderByID(ctx, fixtureOrderID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return payments[0], order
+}
+
+func TestWebhookCompletesAndRefundsPayment(t *testing.T) {
+	s := newWebhookServer(t)
+
+	if code, applied := s.deliver("checkout.session.completed", testWebhookSecret); code != http.StatusOK || !applied {
+		t.Fatalf("expected the completed session to be applied, got %d %v", code, applied)
+	}
+	payment, order := s.state()
+	if payment.Status != models.PaymentStatusComplete || payment.PaymentIntentID != "pi_3OtIntent0001" {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+	if order.Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to be paid, got %s", order.Status)
+	}
+
+	// Stripe delivers at least once
+	if code, applied := s.deliver("checkout.session.completed", testWebhookSecret); code != http.StatusOK || applied {
+		t.Fatalf("expected the redelivery to be ignored, got %d %v", code, applied)
+	}
+
+	// The session expiring afterwards can't undo the payment
+	if code, applied := s.deliver("checkout.session.expired", testWebhookSecret); code != http.StatusOK || applied {
+		t.Fatalf("expected the late expiry to be ignored, got %d %v", code, applied)
+	}
+
+	if code, applied := s.deliver("charge.refunded", testWebhookSecret); code != http.StatusOK || !applied {
+		t.Fatalf("expected the refund to be applied, got %d %v", code, applied)
+	}
+	payment, order = s.state()
+	if payment.Status != models.PaymentStatusRefunded || payment.RefundedAmount.Amount != 2598 {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+	if order.Status != models.OrderStatusRefunded {
+		t.Fatalf("expected the order to be refunded, got %s", order.Status)
+	}
+}
+
+func TestWebhookFailedPaymentKeepsOrderOpen(t *testing.T) {
+	s := newWebhookServer(t)
+
+	// The intent isn't on the payment yet, it's matched through the order ID in its metadata
+	if code, applied := s.deliver("payment_intent.payment_failed", testWebhookSecret); code != http.StatusOK || !applied {
+		t.Fatalf("expected the failure to be applied, got %d %v", code, applied)
+	}
+	payment, order := s.state()
+	if payment.Status != models.PaymentStatusFailed || order.Status != models.OrderStatusAwaitingPayment {
+		t.Fatalf("unexpected payment %s and order %s", payment.Status, order.Status)
+	}
+
+	// Paying with another card still completes the checkout
+	if code, applied := s.deliver("checkout.session.completed", testWebhookSecret); code != http.StatusOK || !applied {
+		t.Fatalf("expected the completed session to be applied, got %d %v", code, applied)
+	}
+	if _, order = s.state(); order.Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to be paid, got %s", order.Status)
+	}
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	s := newWebhookServer(t)
+
+	if code, _ := s.deliver("checkout.session.completed", "whsec_forged"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+	if payment, _ := s.state(); payment.Status != models.PaymentStatusOpen {
+		t.Fatalf("expected the payment to stay open, got %s", payment.Status)
+	}
+}
+
+func TestWebhookUnknownPayment(t *testing.T) {
+	s := newWebhookServer(t)
+	s.router = gin.New()
+	s.router.POST("/webhook", NewHandler(memory.New(), nil).HandleWebhook)
+
+	// Stripe retries on a 404, the checkout creating the payment may not have finished yet
+	if code, _ := s.deliver("checkout.session.completed", testWebhookSecret); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+}
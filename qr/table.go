@@ -0,0 +1,57 @@
+package qr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrMissingSecret = errors.New("missing QR_SIGNING_SECRET")
+var ErrMissingOrigin = errors.New("missing MENU_URL_ORIGIN")
+
+// SignTable returns the signature that proves a table ID came from the venue's printed QR code
+func SignTable(venueID primitive.ObjectID, tableID primitive.ObjectID) (string, error) {
+	secret := os.Getenv("QR_SIGNING_SECRET")
+	if secret == "" {
+		return "", ErrMissingSecret
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(venueID.Hex() + ":" + tableID.Hex()))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyTable reports whether the signature was made for this table at this venue
+func VerifyTable(venueID primitive.ObjectID, tableID primitive.ObjectID, signature string) bool {
+	expected, err := SignTable(venueID, tableID)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// TableURL is the link in the table's QR code, it opens the venue's menu with the table preselected
+func TableURL(venueID primitive.ObjectID, tableID primitive.ObjectID) (string, error) {
+	origin := os.Getenv("MENU_URL_ORIGIN")
+	if origin == "" {
+		return "", ErrMissingOrigin
+	}
+
+	signature, err := SignTable(venueID, tableID)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("table_id", tableID.Hex())
+	query.Set("sig", signature)
+
+	return origin + "/venue/" + venueID.Hex() + "?" + query.Encode(), nil
+}
@@ -0,0 +1,137 @@
+// Package memory is a Store that keeps everything in maps, for tests that shouldn't need a MongoDB
+package memory
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaplingPay/server/events"
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store behaves like repositories.Mongo, one mutex stands in for its transactions
+type Store struct {
+	mu sync.Mutex
+
+	venues         map[primitive.ObjectID]models.Venue
+	menus          map[primitive.ObjectID]models.MenuV2
+	orders         map[primitive.ObjectID]models.Order
+	orderEvents    []models.OrderEvent
+	eventSequences map[primitive.ObjectID]int64
+	orderCounters  map[string]int
+	payments       map[primitive.ObjectID]models.Payment
+	refunds        map[primitive.ObjectID]models.Refund
+	stripeEvents   map[string]models.StripeEvent
+	users          map[primitive.ObjectID]models.UserV2
+	stripeAccounts map[primitive.ObjectID]models.StripeAccount
+	tables         map[primitive.ObjectID]models.Table
+	parseJobs      map[primitive.ObjectID]models.ParseJob
+	menuDrafts     map[primitive.ObjectID]models.MenuDraft
+	menuVersions   []models.MenuVersion
+
+	broker *events.Broker
+}
+
+var _ repositories.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		venues:         map[primitive.ObjectID]models.Venue{},
+		menus:          map[primitive.ObjectID]models.MenuV2{},
+		orders:         map[primitive.ObjectID]models.Order{},
+		eventSequences: map[primitive.ObjectID]int64{},
+		orderCounters:  map[string]int{},
+		payments:       map[primitive.ObjectID]models.Payment{},
+		refunds:        map[primitive.ObjectID]models.Refund{},
+		stripeEvents:   map[string]models.StripeEvent{},
+		users:          map[primitive.ObjectID]models.UserV2{},
+		stripeAccounts: map[primitive.ObjectID]models.StripeAccount{},
+		tables:         map[primitive.ObjectID]models.Table{},
+		parseJobs:      map[primitive.ObjectID]models.ParseJob{},
+		menuDrafts:     map[primitive.ObjectID]models.MenuDraft{},
+	}
+}
+
+// PublishTo announces order events on the broker as they're recorded, which is the change stream's job with Mongo
+func (s *Store) PublishTo(broker *events.Broker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broker = broker
+}
+
+// clone copies a document the way a round trip through MongoDB would, so callers never share slices with the store
+func clone[T any](v T) T {
+	var out T
+	data, err := bson.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	if err := bson.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// update applies a partial update the way $set does, dotted field names reach into embedded documents
+func update[T any](v T, fields repositories.Fields) (T, error) {
+	var doc bson.M
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return v, err
+	}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return v, err
+	}
+
+	for field, value := range fields {
+		path := strings.Split(field, ".")
+		parent := doc
+		for _, key := range path[:len(path)-1] {
+			child, ok := parent[key].(bson.M)
+			if !ok {
+				child = bson.M{}
+				parent[key] = child
+			}
+			parent = child
+		}
+		parent[path[len(path)-1]] = value
+	}
+
+	var out T
+	data, err = bson.Marshal(doc)
+	if err != nil {
+		return v, err
+	}
+	err = bson.Unmarshal(data, &out)
+
+	return out, err
+}
+
+// sorted returns the map's documents oldest first, which is the order ObjectIDs sort in
+func sorted[T any](docs map[primitive.ObjectID]T, keep func(T) bool) []T {
+	ids := make([]primitive.ObjectID, 0, len(docs))
+	for id, doc := range docs {
+		if keep == nil || keep(doc) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+
+	out := make([]T, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, clone(docs[id]))
+	}
+	return out
+}
+
+func now() *primitive.DateTime {
+	t := primitive.NewDateTimeFromTime(time.Now())
+	return &t
+}
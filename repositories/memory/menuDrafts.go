@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) CreateMenuDraft(ctx context.Context, draft models.MenuDraft) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.menuDrafts[draft.ID] = clone(draft)
+
+	return nil
+}
+
+func (s *Store) GetMenuDraft(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID) (models.MenuDraft, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	draft, ok := s.menuDrafts[draftID]
+	if !ok || draft.VenueID != venueID {
+		return models.MenuDraft{}, repositories.ErrMenuDraftNotFound
+	}
+
+	return clone(draft), nil
+}
+
+func (s *Store) GetOpenMenuDrafts(ctx context.Context, venueID primitive.ObjectID) ([]models.MenuDraft, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drafts := sorted(s.menuDrafts, func(draft models.MenuDraft) bool {
+		return draft.VenueID == venueID && draft.Status == models.MenuDraftOpen
+	})
+	// Newest first
+	for i, j := 0, len(drafts)-1; i < j; i, j = i+1, j-1 {
+		drafts[i], drafts[j] = drafts[j], drafts[i]
+	}
+
+	return drafts, nil
+}
+
+func (s *Store) UpdateMenuDraft(ctx context.Context, draft models.MenuDraft) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.openDraft(draft.VenueID, draft.ID)
+	if err != nil {
+		return err
+	}
+
+	stored.Name = draft.Name
+	stored.Items = draft.Items
+	stored.Warnings = draft.Warnings
+	stored.UpdatedAt = now()
+	s.menuDrafts[stored.ID] = clone(stored)
+
+	return nil
+}
+
+func (s *Store) CloseMenuDraft(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID, status string, menuID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	draft, err := s.openDraft(venueID, draftID)
+	if err != nil {
+		return err
+	}
+
+	draft.Status = status
+	if !menuID.IsZero() {
+		draft.MenuID = menuID
+	}
+	draft.UpdatedAt = now()
+	s.menuDrafts[draft.ID] = draft
+
+	return nil
+}
+
+func (s *Store) openDraft(venueID primitive.ObjectID, draftID primitive.ObjectID) (models.MenuDraft, error) {
+	draft, ok := s.menuDrafts[draftID]
+	if !ok || draft.VenueID != venueID {
+		return models.MenuDraft{}, repositories.ErrMenuDraftNotFound
+	}
+	if draft.Status != models.MenuDraftOpen {
+		return models.MenuDraft{}, repositories.ErrMenuDraftClosed
+	}
+	return draft, nil
+}
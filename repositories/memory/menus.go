@@ -0,0 +1,279 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetMenuByID(ctx context.Context, menuID primitive.ObjectID) (models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu, ok := s.menus[menuID]
+	if !ok {
+		return models.MenuV2{}, repositories.ErrMenuNotFound
+	}
+	return clone(menu), nil
+}
+
+func (s *Store) GetMenuByLegacyID(ctx context.Context, legacyMenuID primitive.ObjectID) (models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, menu := range s.menus {
+		if menu.LegacyMenuID == legacyMenuID {
+			return clone(menu), nil
+		}
+	}
+	return models.MenuV2{}, repositories.ErrMenuNotFound
+}
+
+func (s *Store) GetAllMenus(ctx context.Context) ([]models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.menus, func(menu models.MenuV2) bool { return menu.DeletedAt == nil }), nil
+}
+
+func (s *Store) GetMenusByVenueID(ctx context.Context, venueID primitive.ObjectID) ([]models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.menus, func(menu models.MenuV2) bool { return menu.VenueID == venueID && menu.DeletedAt == nil }), nil
+}
+
+func (s *Store) GetMenusByVenueIDs(ctx context.Context, venueIDs []primitive.ObjectID) ([]models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.menus, func(menu models.MenuV2) bool { return containsID(venueIDs, menu.VenueID) && menu.DeletedAt == nil }), nil
+}
+
+func (s *Store) CreateMenu(ctx context.Context, menu models.MenuV2) (models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu.Version = 1
+	s.menus[menu.ID] = clone(menu)
+	s.recordVersion(menu, models.MenuChangeCreated, 0)
+
+	if venue, ok := s.venues[menu.VenueID]; ok {
+		venue.MenuIDs = append(venue.MenuIDs, menu.ID)
+		s.venues[venue.ID] = venue
+	}
+
+	return menu, nil
+}
+
+func (s *Store) UpdateMenu(ctx context.Context, menuID primitive.ObjectID, fields repositories.Fields) (models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu, ok := s.menus[menuID]
+	if !ok {
+		return models.MenuV2{}, repositories.ErrMenuNotFound
+	}
+
+	set := repositories.Fields{}
+	for field, value := range fields {
+		// The version only ever counts up
+		if field != "version" {
+			set[field] = value
+		}
+	}
+	if len(set) == 0 {
+		return clone(menu), nil
+	}
+	if items, ok := set["items"].([]models.MenuItemV2); ok {
+		set["items"] = models.KeepLiveState(items, menu.Items)
+	}
+
+	menu, err := update(menu, set)
+	if err != nil {
+		return models.MenuV2{}, err
+	}
+	menu.Version++
+	s.menus[menuID] = menu
+	s.recordVersion(menu, models.MenuChangeUpdated, 0)
+
+	return clone(menu), nil
+}
+
+func (s *Store) SoftDeleteMenu(ctx context.Context, menuID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu, ok := s.menus[menuID]
+	if !ok || menu.DeletedAt != nil {
+		return nil
+	}
+
+	deletedAt := now()
+	menu.DeletedAt = deletedAt
+	for i := range menu.Items {
+		menu.Items[i].DeletedAt = deletedAt
+	}
+	menu.Version++
+	s.menus[menuID] = menu
+	s.recordVersion(menu, models.MenuChangeDeleted, 0)
+
+	return nil
+}
+
+func (s *Store) AddMenuItem(ctx context.Context, menuID primitive.ObjectID, item models.MenuItemV2) (models.MenuItemV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+
+	menu, ok := s.menus[menuID]
+	if !ok {
+		return item, repositories.ErrMenuNotFound
+	}
+	menu.Items = append(menu.Items, clone(item))
+	menu.Version++
+	s.menus[menuID] = menu
+	s.recordVersion(menu, models.MenuChangeItemAdded, 0)
+
+	return item, nil
+}
+
+func (s *Store) UpdateMenuItem(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID, fields repositories.Fields) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu, i, ok := s.menuItem(menuID, itemID)
+	if !ok {
+		return repositories.ErrMenuItemNotFound
+	}
+
+	item, err := update(menu.Items[i], fields)
+	if err != nil {
+		return err
+	}
+	menu.Items[i] = item
+	menu.Version++
+	s.menus[menuID] = menu
+	s.recordVersion(menu, models.MenuChangeItemUpdated, 0)
+
+	return nil
+}
+
+func (s *Store) SoftDeleteMenuItem(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if menu, i, ok := s.menuItem(menuID, itemID); ok {
+		menu.Items[i].DeletedAt = now()
+		menu.Version++
+		s.menus[menuID] = menu
+		s.recordVersion(menu, models.MenuChangeItemDeleted, 0)
+	}
+	return nil
+}
+
+func (s *Store) SetMenuItemAvailability(ctx context.Context, menuID primitive.ObjectID, itemIDs []primitive.ObjectID, availability string, until *primitive.DateTime) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu, ok := s.menus[menuID]
+	if !ok {
+		return repositories.ErrMenuNotFound
+	}
+	for i, item := range menu.Items {
+		for _, itemID := range itemIDs {
+			if item.ID != itemID {
+				continue
+			}
+			menu.Items[i].Availability = availability
+			menu.Items[i].SoldOutUntil = nil
+			if until != nil {
+				soldOutUntil := *until
+				menu.Items[i].SoldOutUntil = &soldOutUntil
+			}
+		}
+	}
+	s.menus[menuID] = menu
+
+	return nil
+}
+
+// menuItem finds the item's index on the stored menu, whose items can be changed in place
+func (s *Store) menuItem(menuID primitive.ObjectID, itemID primitive.ObjectID) (models.MenuV2, int, bool) {
+	menu, ok := s.menus[menuID]
+	if !ok {
+		return menu, 0, false
+	}
+	for i, item := range menu.Items {
+		if item.ID == itemID {
+			return menu, i, true
+		}
+	}
+	return menu, 0, false
+}
+
+func (s *Store) GetMenuVersions(ctx context.Context, menuID primitive.ObjectID) ([]models.MenuVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := []models.MenuVersion{}
+	for i := len(s.menuVersions) - 1; i >= 0; i-- {
+		if version := s.menuVersions[i]; version.MenuID == menuID {
+			version.Items = nil
+			version.CategoryOrder = nil
+			versions = append(versions, clone(version))
+		}
+	}
+	return versions, nil
+}
+
+func (s *Store) GetMenuVersion(ctx context.Context, menuID primitive.ObjectID, version int) (models.MenuVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.menuVersion(menuID, version)
+}
+
+func (s *Store) RollbackMenu(ctx context.Context, menuID primitive.ObjectID, version int) (models.MenuV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target, err := s.menuVersion(menuID, version)
+	if err != nil {
+		return models.MenuV2{}, err
+	}
+	menu, ok := s.menus[menuID]
+	if !ok || menu.DeletedAt != nil {
+		return models.MenuV2{}, repositories.ErrMenuNotFound
+	}
+
+	menu.Name = target.Name
+	menu.Items = models.KeepLiveState(target.Items, menu.Items)
+	menu.CategoryOrder = target.CategoryOrder
+	menu.Version++
+	s.menus[menuID] = menu
+	s.recordVersion(menu, models.MenuChangeRolledBack, version)
+
+	return clone(menu), nil
+}
+
+func (s *Store) menuVersion(menuID primitive.ObjectID, version int) (models.MenuVersion, error) {
+	for _, menuVersion := range s.menuVersions {
+		if menuVersion.MenuID == menuID && menuVersion.Version == version {
+			return clone(menuVersion), nil
+		}
+	}
+	return models.MenuVersion{}, repositories.ErrMenuVersionNotFound
+}
+
+// recordVersion keeps a copy of the menu as it is after a change, which has counted up its version
+func (s *Store) recordVersion(menu models.MenuV2, change string, rolledBackTo int) {
+	version := models.NewMenuVersion(clone(menu), change)
+	version.RolledBackTo = rolledBackTo
+	s.menuVersions = append(s.menuVersions, version)
+}
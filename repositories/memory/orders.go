@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetOrderByID(ctx context.Context, orderID primitive.ObjectID) (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return models.Order{}, repositories.ErrOrderNotFound
+	}
+	return clone(order), nil
+}
+
+func (s *Store) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.orders, nil), nil
+}
+
+func (s *Store) GetOrdersByVenueID(ctx context.Context, venueID primitive.ObjectID, statuses []models.OrderStatus) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := sorted(s.orders, func(order models.Order) bool {
+		if order.VenueID != venueID || order.DeletedAt != nil {
+			return false
+		}
+		if len(statuses) == 0 {
+			return true
+		}
+		for _, status := range statuses {
+			if order.Status == status {
+				return true
+			}
+		}
+		return false
+	})
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].Timestamp < orders[j].Timestamp })
+
+	return orders, nil
+}
+
+func (s *Store) CreateOrder(ctx context.Context, order models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order = clone(order)
+	s.orders[order.ID] = order
+	s.recordOrderEvent(models.OrderEventCreated, order)
+
+	return nil
+}
+
+func (s *Store) UpdateOrderItems(ctx context.Context, orderID primitive.ObjectID, items []models.OrderItem, total models.Money, menuVersion int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return repositories.ErrOrderNotFound
+	}
+	if !order.Status.IsUnpaid() {
+		return repositories.ErrOrderPaid
+	}
+
+	order, err := update(order, repositories.Fields{"items": items, "total": total, "menu_version": menuVersion})
+	if err != nil {
+		return err
+	}
+	s.orders[orderID] = order
+
+	return nil
+}
+
+func (s *Store) SoftDeleteOrder(ctx context.Context, orderID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if order, ok := s.orders[orderID]; ok {
+		order.DeletedAt = now()
+		s.orders[orderID] = order
+	}
+	return nil
+}
+
+func (s *Store) TransitionOrder(ctx context.Context, orderID primitive.ObjectID, to models.OrderStatus, trigger string, actor string) (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transitionOrder(orderID, to, trigger, actor)
+}
+
+// transitionOrder expects s.mu to be held
+func (s *Store) transitionOrder(orderID primitive.ObjectID, to models.OrderStatus, trigger string, actor string) (models.Order, error) {
+	order, ok := s.orders[orderID]
+	if !ok {
+		return models.Order{}, repositories.ErrOrderNotFound
+	}
+	if !order.CanTransitionTo(to, trigger) {
+		return clone(order), fmt.Errorf("%w: %s to %s", repositories.ErrIllegalTransition, order.Status, to)
+	}
+
+	order.StatusHistory = append(order.StatusHistory, models.OrderStatusChange{
+		From:    order.Status,
+		To:      to,
+		At:      *now(),
+		Trigger: trigger,
+		Actor:   actor,
+	})
+	order.Status = to
+	s.orders[orderID] = order
+	s.recordOrderEvent(models.TransitionEventType(to), order)
+	order = s.moveStock(order, to)
+
+	return clone(order), nil
+}
+
+func (s *Store) NextOrderNumber(ctx context.Context, venueID primitive.ObjectID, businessDay string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := models.OrderCounterID(venueID, businessDay)
+	s.orderCounters[id]++
+
+	return s.orderCounters[id], nil
+}
+
+func (s *Store) GetOrderEventsAfter(ctx context.Context, venueID primitive.ObjectID, afterSequence int64, limit int64) ([]models.OrderEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []models.OrderEvent{}
+	for _, event := range s.orderEvents {
+		if int64(len(events)) == limit {
+			break
+		}
+		if event.VenueID == venueID && event.Sequence > afterSequence {
+			events = append(events, clone(event))
+		}
+	}
+	return events, nil
+}
+
+// recordOrderEvent expects s.mu to be held
+func (s *Store) recordOrderEvent(eventType string, order models.Order) {
+	s.eventSequences[order.VenueID]++
+	event := models.OrderEvent{
+		ID:        primitive.NewObjectID(),
+		VenueID:   order.VenueID,
+		Sequence:  s.eventSequences[order.VenueID],
+		OrderID:   order.ID,
+		Type:      eventType,
+		Order:     clone(order),
+		Timestamp: *now(),
+	}
+	s.orderEvents = append(s.orderEvents, event)
+
+	if s.broker != nil {
+		s.broker.Publish(clone(event))
+	}
+}
+
+// recordStockEvent expects s.mu to be held
+func (s *Store) recordStockEvent(order models.Order, alert models.StockAlert) {
+	s.eventSequences[order.VenueID]++
+	event := models.OrderEvent{
+		ID:        primitive.NewObjectID(),
+		VenueID:   order.VenueID,
+		Sequence:  s.eventSequences[order.VenueID],
+		OrderID:   order.ID,
+		Type:      models.OrderEventLowStock,
+		Order:     clone(order),
+		Stock:     &alert,
+		Timestamp: *now(),
+	}
+	s.orderEvents = append(s.orderEvents, event)
+
+	if s.broker != nil {
+		s.broker.Publish(clone(event))
+	}
+}
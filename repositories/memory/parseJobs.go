@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) CreateParseJob(ctx context.Context, job models.ParseJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.parseJobs[job.ID] = clone(job)
+
+	return nil
+}
+
+func (s *Store) GetParseJob(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.parseJobs[jobID]
+	if !ok || job.VenueID != venueID {
+		return models.ParseJob{}, repositories.ErrParseJobNotFound
+	}
+
+	job = clone(job)
+	job.File = nil
+	return job, nil
+}
+
+func (s *Store) ClaimParseJob(ctx context.Context, leaseUntil time.Time) (models.ParseJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := primitive.NewDateTimeFromTime(time.Now())
+	claimable := sorted(s.parseJobs, func(job models.ParseJob) bool {
+		return job.Status == models.ParseJobQueued || (job.Status == models.ParseJobRunning && job.LeaseUntil != nil && *job.LeaseUntil < current)
+	})
+	if len(claimable) == 0 {
+		return models.ParseJob{}, repositories.ErrParseJobNotFound
+	}
+	sort.SliceStable(claimable, func(i, j int) bool { return claimable[i].CreatedAt < claimable[j].CreatedAt })
+
+	job := claimable[0]
+	lease := primitive.NewDateTimeFromTime(leaseUntil)
+	job.Status = models.ParseJobRunning
+	job.StartedAt = &current
+	job.LeaseUntil = &lease
+	job.Attempts++
+	s.parseJobs[job.ID] = job
+
+	return clone(job), nil
+}
+
+func (s *Store) FinishParseJob(ctx context.Context, job models.ParseJob) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.parseJobs[job.ID]
+	if !ok || stored.Status != models.ParseJobRunning || stored.Attempts != job.Attempts {
+		return false, nil
+	}
+
+	stored.Status = job.Status
+	if !job.DraftID.IsZero() {
+		stored.DraftID = job.DraftID
+	}
+	if job.Error != "" {
+		stored.Error = job.Error
+	}
+	if len(job.Problems) > 0 {
+		stored.Problems = job.Problems
+	}
+	stored.FinishedAt = now()
+	stored.File = nil
+	stored.LeaseUntil = nil
+	s.parseJobs[job.ID] = stored
+
+	return true, nil
+}
+
+func (s *Store) CancelParseJob(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.parseJobs[jobID]
+	if !ok || job.VenueID != venueID {
+		return models.ParseJob{}, repositories.ErrParseJobNotFound
+	}
+	if job.Finished() {
+		return clone(job), repositories.ErrParseJobFinished
+	}
+
+	job.Status = models.ParseJobCancelled
+	job.FinishedAt = now()
+	job.File = nil
+	job.LeaseUntil = nil
+	s.parseJobs[job.ID] = job
+
+	return clone(job), nil
+}
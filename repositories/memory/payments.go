@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetPaymentByID(ctx context.Context, paymentID primitive.ObjectID) (models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[paymentID]
+	if !ok || payment.DeletedAt != nil {
+		return models.Payment{}, repositories.ErrPaymentNotFound
+	}
+	return clone(payment), nil
+}
+
+func (s *Store) GetAllPayments(ctx context.Context) ([]models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.payments, func(payment models.Payment) bool { return payment.DeletedAt == nil }), nil
+}
+
+func (s *Store) CreatePayment(ctx context.Context, payment models.Payment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.payments[payment.ID] = clone(payment)
+
+	return nil
+}
+
+func (s *Store) UpdatePayment(ctx context.Context, paymentID primitive.ObjectID, fields repositories.Fields) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[paymentID]
+	if !ok || payment.DeletedAt != nil {
+		return repositories.ErrPaymentNotFound
+	}
+
+	payment, err := update(payment, fields)
+	if err != nil {
+		return err
+	}
+	s.payments[paymentID] = payment
+
+	return nil
+}
+
+func (s *Store) SoftDeletePayment(ctx context.Context, paymentID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if payment, ok := s.payments[paymentID]; ok {
+		payment.DeletedAt = now()
+		s.payments[paymentID] = payment
+	}
+	return nil
+}
+
+func (s *Store) ApplyPaymentEvent(ctx context.Context, event models.StripeEvent, update repositories.PaymentEventUpdate) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, seen := s.stripeEvents[event.ID]; seen {
+		return false, nil
+	}
+
+	var matched bool
+	var payment models.Payment
+	for _, candidate := range s.payments {
+		if !update.Match.Matches(candidate) {
+			continue
+		}
+		matched = true
+		if candidate.DeletedAt != nil || !contains(update.FromStatuses, candidate.Status) {
+			continue
+		}
+		if payment.ID.IsZero() || candidate.Timestamp > payment.Timestamp {
+			payment = candidate
+		}
+	}
+	if !matched {
+		// Nothing is recorded, like the aborted transaction, so Stripe's retry is processed again
+		return false, repositories.ErrPaymentNotFound
+	}
+
+	s.stripeEvents[event.ID] = event
+	if payment.ID.IsZero() {
+		return false, nil
+	}
+
+	from := payment.Status
+	payment.Status = update.Status
+	payment.UpdatedAt = now()
+	if update.PaymentIntentID != "" {
+		payment.PaymentIntentID = update.PaymentIntentID
+	}
+	if update.RefundedAmount > payment.RefundedAmount.Amount {
+		payment.RefundedAmount.Amount = update.RefundedAmount
+	}
+	s.payments[payment.ID] = payment
+
+	if update.OrderStatus != "" && from != update.Status {
+		_, err := s.transitionOrder(payment.OrderID, update.OrderStatus, models.OrderTriggerStripe, event.ID)
+		if errors.Is(err, repositories.ErrIllegalTransition) {
+			log.Println("[memory]", "order", payment.OrderID.Hex(), "not moved by", event.ID, err)
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (s *Store) GetCapturedPaymentForOrder(ctx context.Context, orderID primitive.ObjectID) (models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var captured models.Payment
+	for _, payment := range s.payments {
+		if payment.OrderID != orderID || payment.DeletedAt != nil {
+			continue
+		}
+		if payment.Status != models.PaymentStatusComplete && payment.Status != models.PaymentStatusPartiallyRefunded {
+			continue
+		}
+		if captured.ID.IsZero() || payment.Timestamp > captured.Timestamp {
+			captured = payment
+		}
+	}
+	if captured.ID.IsZero() {
+		return models.Payment{}, repositories.ErrPaymentNotFound
+	}
+	return clone(captured), nil
+}
+
+func (s *Store) GetRefundsByOrderID(ctx context.Context, orderID primitive.ObjectID) ([]models.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refunds := sorted(s.refunds, func(refund models.Refund) bool { return refund.OrderID == orderID })
+	sort.SliceStable(refunds, func(i, j int) bool { return refunds[i].Timestamp < refunds[j].Timestamp })
+
+	return refunds, nil
+}
+
+func (s *Store) ReserveRefund(ctx context.Context, refund models.Refund) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[refund.PaymentID]
+	if !ok || payment.Amount.Currency != refund.Amount.Currency {
+		return false, nil
+	}
+	if payment.RefundedAmount.Amount+refund.Amount.Amount > payment.Amount.Amount {
+		return false, nil
+	}
+
+	payment.RefundedAmount.Amount += refund.Amount.Amount
+	payment.RefundedAmount.Currency = refund.Amount.Currency
+	s.payments[payment.ID] = payment
+	s.refunds[refund.ID] = clone(refund)
+
+	return true, nil
+}
+
+func (s *Store) CompleteRefund(ctx context.Context, refund models.Refund) (models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.refunds[refund.ID]; ok {
+		stored.Status = models.RefundStatusSucceeded
+		stored.StripeRefundID = refund.StripeRefundID
+		s.refunds[refund.ID] = stored
+	}
+
+	payment, ok := s.payments[refund.PaymentID]
+	if !ok {
+		return models.Payment{}, repositories.ErrPaymentNotFound
+	}
+
+	from := payment.Status
+	payment.Status = models.PaymentStatusPartiallyRefunded
+	orderStatus := models.OrderStatusPartiallyRefunded
+	if payment.RefundedAmount.Amount >= payment.Amount.Amount {
+		payment.Status = models.PaymentStatusRefunded
+		orderStatus = models.OrderStatusRefunded
+	}
+	payment.UpdatedAt = now()
+	s.payments[payment.ID] = payment
+
+	if order, ok := s.orders[refund.OrderID]; ok && len(refund.Items) > 0 {
+		s.returnStock(order, models.RefundStockLines(refund.Items))
+	}
+
+	if from == payment.Status {
+		return clone(payment), nil
+	}
+	_, err := s.transitionOrder(refund.OrderID, orderStatus, models.OrderTriggerRefund, refund.ID.Hex())
+	if errors.Is(err, repositories.ErrIllegalTransition) {
+		log.Println("[memory]", "order", refund.OrderID.Hex(), "not moved by refund", refund.ID.Hex(), err)
+		err = nil
+	}
+
+	return clone(payment), err
+}
+
+func (s *Store) FailRefund(ctx context.Context, refund models.Refund, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.refunds[refund.ID]; ok {
+		stored.Status = models.RefundStatusFailed
+		stored.Error = reason
+		s.refunds[refund.ID] = stored
+	}
+
+	if payment, ok := s.payments[refund.PaymentID]; ok {
+		payment.RefundedAmount.Amount -= refund.Amount.Amount
+		s.payments[payment.ID] = payment
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"context"
+	"log"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) SetMenuItemStock(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID, stock *int, lowStockAt int) (models.MenuItemV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	menu, i, ok := s.menuItem(menuID, itemID)
+	if !ok {
+		return models.MenuItemV2{}, repositories.ErrMenuItemNotFound
+	}
+
+	item := &menu.Items[i]
+	item.Stock = nil
+	if stock != nil {
+		count := *stock
+		item.Stock = &count
+	}
+	item.LowStockAt = lowStockAt
+	syncSoldOut(item)
+	s.menus[menuID] = menu
+
+	return clone(*item), nil
+}
+
+// moveStock expects s.mu to be held
+func (s *Store) moveStock(order models.Order, to models.OrderStatus) models.Order {
+	switch to {
+	case models.OrderStatusPaid:
+		return s.takeStock(order)
+	case models.OrderStatusCancelled, models.OrderStatusRefunded:
+		return s.returnStock(order, order.Stock)
+	}
+	return order
+}
+
+// takeStock expects s.mu to be held
+func (s *Store) takeStock(order models.Order) models.Order {
+	menu, ok := s.menus[order.MenuID]
+	if !ok {
+		return order
+	}
+
+	var taken []models.StockLine
+	for _, line := range order.StockLines() {
+		for i := range menu.Items {
+			item := &menu.Items[i]
+			if item.ID != line.MenuItemID || item.Stock == nil || *item.Stock <= 0 {
+				continue
+			}
+
+			before := *item.Stock
+			quantity := line.Quantity
+			if quantity > before {
+				log.Println("[memory]", "order", order.ID.Hex(), "paid for", quantity, item.Name, "with", before, "left")
+				quantity = before
+			}
+			left := before - quantity
+			item.Stock = &left
+			taken = append(taken, models.StockLine{MenuItemID: item.ID, Quantity: quantity})
+
+			syncSoldOut(item)
+			if item.LowOnStock(before) {
+				s.recordStockEvent(order, item.StockAlert(menu.ID))
+			}
+		}
+	}
+	s.menus[menu.ID] = menu
+
+	if len(taken) > 0 {
+		order.Stock = taken
+		s.orders[order.ID] = order
+	}
+	return order
+}
+
+// returnStock expects s.mu to be held
+func (s *Store) returnStock(order models.Order, lines []models.StockLine) models.Order {
+	returned, kept := models.ReturnStock(order.Stock, lines)
+	if len(returned) == 0 {
+		return order
+	}
+
+	if menu, ok := s.menus[order.MenuID]; ok {
+		for _, line := range returned {
+			for i := range menu.Items {
+				item := &menu.Items[i]
+				if item.ID != line.MenuItemID || item.Stock == nil {
+					continue
+				}
+				stock := *item.Stock + line.Quantity
+				item.Stock = &stock
+				syncSoldOut(item)
+			}
+		}
+		s.menus[menu.ID] = menu
+	}
+
+	order.Stock = kept
+	s.orders[order.ID] = order
+	return order
+}
+
+// syncSoldOut sells out a counted item that has none left and puts it back once it has some again, like the
+// MongoDB store does
+func syncSoldOut(item *models.MenuItemV2) {
+	switch {
+	case item.Stock == nil:
+	case *item.Stock <= 0 && item.Availability != models.ItemSoldOut && item.Availability != models.ItemHidden:
+		item.Availability = models.ItemSoldOut
+		item.SoldOutUntil = nil
+	case *item.Stock > 0 && item.Availability == models.ItemSoldOut && item.SoldOutUntil == nil:
+		item.Availability = models.ItemAvailable
+	}
+}
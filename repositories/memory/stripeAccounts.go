@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetStripeAccounts(ctx context.Context) ([]models.StripeAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.stripeAccounts, nil), nil
+}
+
+func (s *Store) AddStripeAccount(ctx context.Context, stripeAccountID string) (models.StripeAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := models.StripeAccount{
+		ID:              primitive.NewObjectID(),
+		StripeAccountID: stripeAccountID,
+	}
+	s.stripeAccounts[account.ID] = account
+
+	return account, nil
+}
+
+func (s *Store) GetStripeAccountByVenueID(ctx context.Context, venueID primitive.ObjectID) (models.StripeAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.stripeAccounts {
+		if account.VenueID == venueID || account.LegacyVenueID == venueID {
+			return account, nil
+		}
+	}
+	return models.StripeAccount{}, repositories.ErrStripeAccountNotFound
+}
+
+// PutStripeAccount stores the account as it is, for tests of accounts written by older versions
+func (s *Store) PutStripeAccount(account models.StripeAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stripeAccounts[account.ID] = account
+}
+
+func (s *Store) LinkVenue(ctx context.Context, venueID primitive.ObjectID, stripeAccountID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var account models.StripeAccount
+	for _, candidate := range s.stripeAccounts {
+		if candidate.StripeAccountID == stripeAccountID {
+			account = candidate
+			break
+		}
+	}
+	if account.ID.IsZero() {
+		return repositories.ErrStripeAccountNotFound
+	}
+
+	venue, ok := s.venues[venueID]
+	if !ok {
+		return repositories.ErrVenueNotFound
+	}
+	venue.StripeAccountID = stripeAccountID
+	s.venues[venueID] = venue
+
+	// Unlink whatever this venue was linked to before, and the venue this account was linked to before
+	for id, other := range s.stripeAccounts {
+		if other.VenueID == venueID && other.StripeAccountID != stripeAccountID {
+			other.VenueID = primitive.NilObjectID
+			s.stripeAccounts[id] = other
+		}
+	}
+	if previous, ok := s.venues[account.VenueID]; ok && account.VenueID != venueID {
+		previous.StripeAccountID = ""
+		s.venues[previous.ID] = previous
+	}
+
+	account.VenueID = venueID
+	account.LegacyVenueID = primitive.NilObjectID
+	s.stripeAccounts[account.ID] = account
+
+	return nil
+}
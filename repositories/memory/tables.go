@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetTablesByVenueID(ctx context.Context, venueID primitive.ObjectID) ([]models.Table, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tables := sorted(s.tables, func(table models.Table) bool { return table.VenueID == venueID && table.DeletedAt == nil })
+	sort.SliceStable(tables, func(i, j int) bool {
+		if tables[i].Zone != tables[j].Zone {
+			return tables[i].Zone < tables[j].Zone
+		}
+		return tables[i].Name < tables[j].Name
+	})
+
+	return tables, nil
+}
+
+func (s *Store) GetVenueTable(ctx context.Context, venueID primitive.ObjectID, tableID primitive.ObjectID) (models.Table, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, ok := s.venueTable(venueID, tableID)
+	if !ok {
+		return models.Table{}, repositories.ErrTableNotFound
+	}
+	return clone(table), nil
+}
+
+func (s *Store) CreateTable(ctx context.Context, table models.Table) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tables[table.ID] = clone(table)
+
+	return nil
+}
+
+func (s *Store) UpdateTable(ctx context.Context, table models.Table) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.venueTable(table.VenueID, table.ID)
+	if !ok {
+		return repositories.ErrTableNotFound
+	}
+	stored.Name = table.Name
+	stored.Zone = table.Zone
+	s.tables[stored.ID] = stored
+
+	return nil
+}
+
+func (s *Store) SoftDeleteTable(ctx context.Context, venueID primitive.ObjectID, tableID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, ok := s.venueTable(venueID, tableID)
+	if !ok {
+		return repositories.ErrTableNotFound
+	}
+	table.DeletedAt = now()
+	s.tables[tableID] = table
+
+	return nil
+}
+
+// venueTable expects s.mu to be held
+func (s *Store) venueTable(venueID primitive.ObjectID, tableID primitive.ObjectID) (models.Table, bool) {
+	table, ok := s.tables[tableID]
+	if !ok || table.VenueID != venueID || table.DeletedAt != nil {
+		return models.Table{}, false
+	}
+	return table, true
+}
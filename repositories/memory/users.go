@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetUserByUserID(ctx context.Context, userID string) (models.UserV2, error) {
+	return s.findUser(func(user models.UserV2) bool { return user.UserID == userID })
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id primitive.ObjectID) (models.UserV2, error) {
+	return s.findUser(func(user models.UserV2) bool { return user.ID == id })
+}
+
+func (s *Store) findUser(match func(models.UserV2) bool) (models.UserV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := sorted(s.users, match)
+	if len(users) == 0 {
+		return models.UserV2{}, repositories.ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+func (s *Store) GetAllUsers(ctx context.Context) ([]models.UserV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.users, nil), nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, user models.UserV2) (models.UserV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	s.users[user.ID] = clone(user)
+
+	return user, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id primitive.ObjectID, fields repositories.Fields) (models.UserV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.UserV2{}, repositories.ErrUserNotFound
+	}
+
+	user, err := update(user, fields)
+	if err != nil {
+		return models.UserV2{}, err
+	}
+	s.users[id] = user
+
+	return clone(user), nil
+}
+
+func (s *Store) SoftDeleteUser(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[id]; ok {
+		user.DeletedAt = now()
+		s.users[id] = user
+	}
+	return nil
+}
+
+func (s *Store) FollowUser(ctx context.Context, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[id]; ok && !containsID(user.Following, followingID) {
+		user.Following = append(user.Following, followingID)
+		s.users[id] = user
+	}
+
+	followed, ok := s.users[followingID]
+	if !ok {
+		return models.UserV2{}, repositories.ErrUserNotFound
+	}
+	if !containsID(followed.Followers, id) {
+		followed.Followers = append(followed.Followers, id)
+		s.users[followingID] = followed
+	}
+
+	return clone(followed), nil
+}
+
+func (s *Store) UnfollowUser(ctx context.Context, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[id]; ok {
+		user.Following = removeID(user.Following, followingID)
+		s.users[id] = user
+	}
+
+	followed, ok := s.users[followingID]
+	if !ok {
+		return models.UserV2{}, repositories.ErrUserNotFound
+	}
+	followed.Followers = removeID(followed.Followers, id)
+	s.users[followingID] = followed
+
+	return clone(followed), nil
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	kept := []primitive.ObjectID{}
+	for _, v := range ids {
+		if v != id {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
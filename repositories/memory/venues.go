@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/SaplingPay/server/models"
+	"github.com/SaplingPay/server/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Store) GetVenueByID(ctx context.Context, venueID primitive.ObjectID) (models.Venue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	venue, ok := s.venues[venueID]
+	if !ok {
+		return models.Venue{}, repositories.ErrVenueNotFound
+	}
+	return clone(venue), nil
+}
+
+func (s *Store) GetAllVenues(ctx context.Context) ([]models.Venue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.venues, notDeletedVenue), nil
+}
+
+func (s *Store) GetVenuesByIDs(ctx context.Context, venueIDs []primitive.ObjectID) ([]models.Venue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sorted(s.venues, func(venue models.Venue) bool { return containsID(venueIDs, venue.ID) && notDeletedVenue(venue) }), nil
+}
+
+func (s *Store) CreateVenue(ctx context.Context, venue models.Venue) (models.Venue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if venue.ID.IsZero() {
+		venue.ID = primitive.NewObjectID()
+	}
+	s.venues[venue.ID] = clone(venue)
+
+	return venue, nil
+}
+
+func (s *Store) UpdateVenue(ctx context.Context, venueID primitive.ObjectID, fields repositories.Fields) (models.Venue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	venue, ok := s.venues[venueID]
+	if !ok {
+		return models.Venue{}, repositories.ErrVenueNotFound
+	}
+
+	venue, err := update(venue, fields)
+	if err != nil {
+		return models.Venue{}, err
+	}
+	s.venues[venueID] = venue
+
+	return clone(venue), nil
+}
+
+func (s *Store) SoftDeleteVenue(ctx context.Context, venueID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if venue, ok := s.venues[venueID]; ok {
+		venue.DeletedAt = now()
+		s.venues[venueID] = venue
+	}
+	return nil
+}
+
+func (s *Store) GetNearbyVenues(ctx context.Context, query repositories.NearbyVenuesQuery) ([]repositories.NearbyVenue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	venues := []repositories.NearbyVenue{}
+	for _, venue := range sorted(s.venues, notDeletedVenue) {
+		point := venue.Location.Point
+		if point == nil {
+			continue
+		}
+		if query.City != "" && !strings.EqualFold(venue.Location.City, query.City) {
+			continue
+		}
+		if query.OrderingSupported && !venue.OrderingSupported {
+			continue
+		}
+
+		nearby := repositories.NearbyVenue{Venue: venue, Distance: query.Point.DistanceTo(*point)}
+		if nearby.Distance > query.Radius {
+			continue
+		}
+		if query.After != nil && !nearby.Follows(*query.After) {
+			continue
+		}
+		venues = append(venues, nearby)
+	}
+
+	sort.SliceStable(venues, func(i, j int) bool { return venues[j].Follows(venues[i]) })
+	if len(venues) > query.Limit {
+		venues = venues[:query.Limit]
+	}
+	return venues, nil
+}
+
+func notDeletedVenue(venue models.Venue) bool {
+	return venue.DeletedAt == nil
+}
@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrMenuDraftNotFound = errors.New("menu draft not found")
+var ErrMenuDraftClosed = errors.New("menu draft already published or discarded")
+
+func (m *Mongo) CreateMenuDraft(ctx context.Context, draft models.MenuDraft) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db.Collection(db.CollectionNameMenuDrafts).InsertOne(ctx, draft)
+
+	return err
+}
+
+func (m *Mongo) GetMenuDraft(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID) (models.MenuDraft, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var draft models.MenuDraft
+	err := m.db.Collection(db.CollectionNameMenuDrafts).FindOne(ctx, bson.M{"_id": draftID, "venue_id": venueID}).Decode(&draft)
+
+	return draft, notFound(err, ErrMenuDraftNotFound)
+}
+
+func (m *Mongo) GetOpenMenuDrafts(ctx context.Context, venueID primitive.ObjectID) ([]models.MenuDraft, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	drafts := []models.MenuDraft{}
+
+	filter := bson.M{"venue_id": venueID, "status": models.MenuDraftOpen}
+	cursor, err := m.db.Collection(db.CollectionNameMenuDrafts).Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return drafts, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &drafts)
+
+	return drafts, err
+}
+
+func (m *Mongo) UpdateMenuDraft(ctx context.Context, draft models.MenuDraft) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": draft.ID, "venue_id": draft.VenueID, "status": models.MenuDraftOpen}
+	update := bson.M{"$set": bson.M{
+		"name":       draft.Name,
+		"items":      draft.Items,
+		"warnings":   draft.Warnings,
+		"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+	}}
+
+	result, err := m.db.Collection(db.CollectionNameMenuDrafts).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return m.closedOrMissing(ctx, draft.VenueID, draft.ID)
+	}
+
+	return nil
+}
+
+func (m *Mongo) CloseMenuDraft(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID, status string, menuID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": draftID, "venue_id": venueID, "status": models.MenuDraftOpen}
+	set := bson.M{"status": status, "updated_at": primitive.NewDateTimeFromTime(time.Now())}
+	if !menuID.IsZero() {
+		set["menu_id"] = menuID
+	}
+
+	result, err := m.db.Collection(db.CollectionNameMenuDrafts).UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return m.closedOrMissing(ctx, venueID, draftID)
+	}
+
+	return nil
+}
+
+// closedOrMissing tells why a draft didn't match the open draft filter
+func (m *Mongo) closedOrMissing(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID) error {
+	if _, err := m.GetMenuDraft(ctx, venueID, draftID); err != nil {
+		return err
+	}
+	return ErrMenuDraftClosed
+}
@@ -2,61 +2,270 @@ package repositories
 
 import (
 	"context"
+	"time"
+
 	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"log"
-	"time"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func AddMenuItem(menuId primitive.ObjectID, menuItem models.MenuItemV2) (models.MenuItemV2, error) {
-	log.Println(menuItem)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (m *Mongo) GetMenuByID(ctx context.Context, menuID primitive.ObjectID) (models.MenuV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var menu models.MenuV2
+	err := m.db.Collection(db.CollectionNameMenuV2).FindOne(ctx, bson.M{"_id": menuID}).Decode(&menu)
+
+	return menu, notFound(err, ErrMenuNotFound)
+}
+
+// GetMenuByLegacyID returns the MenuV2 the V1 menu was migrated to
+func (m *Mongo) GetMenuByLegacyID(ctx context.Context, legacyMenuID primitive.ObjectID) (models.MenuV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var menu models.MenuV2
+	err := m.db.Collection(db.CollectionNameMenuV2).FindOne(ctx, bson.M{"legacy_menu_id": legacyMenuID}).Decode(&menu)
+
+	return menu, notFound(err, ErrMenuNotFound)
+}
+
+func (m *Mongo) GetAllMenus(ctx context.Context) ([]models.MenuV2, error) {
+	return m.findMenus(ctx, bson.M{"deleted_at": nil})
+}
+
+func (m *Mongo) GetMenusByVenueID(ctx context.Context, venueID primitive.ObjectID) ([]models.MenuV2, error) {
+	return m.findMenus(ctx, bson.M{"venue_id": venueID, "deleted_at": nil})
+}
+
+func (m *Mongo) GetMenusByVenueIDs(ctx context.Context, venueIDs []primitive.ObjectID) ([]models.MenuV2, error) {
+	return m.findMenus(ctx, bson.M{"venue_id": bson.M{"$in": venueIDs}, "deleted_at": nil})
+}
+
+func (m *Mongo) findMenus(ctx context.Context, filter bson.M) ([]models.MenuV2, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	menus := []models.MenuV2{}
+
+	cursor, err := m.db.Collection(db.CollectionNameMenuV2).Find(ctx, filter)
+	if err != nil {
+		return menus, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &menus)
+
+	return menus, err
+}
+
+// CreateMenu inserts the menu as its first version and adds it to its venue, in one transaction
+func (m *Mongo) CreateMenu(ctx context.Context, menu models.MenuV2) (models.MenuV2, error) {
+	menu.Version = 1
+
+	_, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := m.db.Collection(db.CollectionNameMenuV2).InsertOne(sc, menu); err != nil {
+			return nil, err
+		}
+
+		venueUpdate := bson.M{"$push": bson.M{"menu_ids": menu.ID}}
+		if _, err := m.db.Collection(db.CollectionNameVenue).UpdateOne(sc, bson.M{"_id": menu.VenueID}, venueUpdate); err != nil {
+			return nil, err
+		}
+
+		_, err := m.db.Collection(db.CollectionNameMenuVersions).InsertOne(sc, models.NewMenuVersion(menu, models.MenuChangeCreated))
+		return nil, err
+	})
+	if err != nil {
+		return models.MenuV2{}, err
+	}
+
+	return menu, nil
+}
+
+func (m *Mongo) UpdateMenu(ctx context.Context, menuID primitive.ObjectID, fields Fields) (models.MenuV2, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	log.Println(menuId)
+	set := bson.M{}
+	for field, value := range fields {
+		// The version only ever counts up
+		if field != "version" {
+			set[field] = value
+		}
+	}
+	if len(set) == 0 {
+		return m.GetMenuByID(ctx, menuID)
+	}
 
-	// Generate a new ObjectID for the menu item
-	menuItem.ID = primitive.NewObjectID()
+	menu, err := m.changeMenu(ctx, bson.M{"_id": menuID}, bson.M{"$set": set}, models.MenuChangeUpdated, 0)
 
-	// Add the new menu item to the menu document
-	filter := bson.M{"_id": menuId}
-	update := bson.M{"$push": bson.M{"items": menuItem}}
-	_, err := db.DB.Collection(db.CollectionNameMenuV2).UpdateOne(ctx, filter, update)
+	return menu, notFound(err, ErrMenuNotFound)
+}
 
-	return menuItem, err
+func (m *Mongo) SoftDeleteMenu(ctx context.Context, menuID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	update := bson.M{"$set": bson.M{"deleted_at": now, "items.$[].deleted_at": now}}
+	_, err := m.changeMenu(ctx, bson.M{"_id": menuID, "deleted_at": nil}, update, models.MenuChangeDeleted, 0)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	return err
 }
 
-func AddAllMenuItems(menuId primitive.ObjectID, items []models.MenuItemV2) ([]models.MenuItemV2, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (m *Mongo) AddMenuItem(ctx context.Context, menuID primitive.ObjectID, item models.MenuItemV2) (models.MenuItemV2, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	// Set all object ids
-	for idx := range items {
-		items[idx].ID = primitive.NewObjectID()
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
 	}
 
-	filter := bson.M{"_id": menuId}
-	update := bson.M{"$push": bson.M{"items": bson.M{"$each": items}}}
-	_, err := db.DB.Collection(db.CollectionNameMenuV2).UpdateOne(ctx, filter, update)
+	update := bson.M{"$push": bson.M{"items": item}}
+	_, err := m.changeMenu(ctx, bson.M{"_id": menuID}, update, models.MenuChangeItemAdded, 0)
 
-	return items, err
+	return item, notFound(err, ErrMenuNotFound)
 }
 
-func CreateMenu(menu models.MenuV2) (models.MenuV2, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (m *Mongo) UpdateMenuItem(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID, fields Fields) error {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	result, err := db.DB.Collection("menusV2").InsertOne(ctx, menu)
+	set := bson.M{}
+	for field, value := range fields {
+		set["items.$."+field] = value
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"_id": menuID, "items._id": itemID}
+	_, err := m.changeMenu(ctx, filter, bson.M{"$set": set}, models.MenuChangeItemUpdated, 0)
+
+	return notFound(err, ErrMenuItemNotFound)
+}
+
+func (m *Mongo) SoftDeleteMenuItem(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"items.$.deleted_at": primitive.NewDateTimeFromTime(time.Now())}}
+	filter := bson.M{"_id": menuID, "items._id": itemID}
+	_, err := m.changeMenu(ctx, filter, update, models.MenuChangeItemDeleted, 0)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	return err
+}
+
+func (m *Mongo) SetMenuItemAvailability(ctx context.Context, menuID primitive.ObjectID, itemIDs []primitive.ObjectID, availability string, until *primitive.DateTime) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"items.$[item].availability": availability}}
+	if until != nil {
+		update["$set"].(bson.M)["items.$[item].sold_out_until"] = *until
+	} else {
+		update["$unset"] = bson.M{"items.$[item].sold_out_until": ""}
+	}
+
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"item._id": bson.M{"$in": itemIDs}}},
+	})
+	result, err := m.db.Collection(db.CollectionNameMenuV2).UpdateOne(ctx, bson.M{"_id": menuID}, update, opts)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrMenuNotFound
+	}
+
+	return nil
+}
+
+func (m *Mongo) GetMenuVersions(ctx context.Context, menuID primitive.ObjectID) ([]models.MenuVersion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	versions := []models.MenuVersion{}
+
+	opts := options.Find().SetSort(bson.M{"version": -1}).SetProjection(bson.M{"items": 0, "category_order": 0})
+	cursor, err := m.db.Collection(db.CollectionNameMenuVersions).Find(ctx, bson.M{"menu_id": menuID}, opts)
+	if err != nil {
+		return versions, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &versions)
+
+	return versions, err
+}
+
+func (m *Mongo) GetMenuVersion(ctx context.Context, menuID primitive.ObjectID, version int) (models.MenuVersion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var menuVersion models.MenuVersion
+	err := m.db.Collection(db.CollectionNameMenuVersions).FindOne(ctx, bson.M{"menu_id": menuID, "version": version}).Decode(&menuVersion)
+
+	return menuVersion, notFound(err, ErrMenuVersionNotFound)
+}
+
+func (m *Mongo) RollbackMenu(ctx context.Context, menuID primitive.ObjectID, version int) (models.MenuV2, error) {
+	target, err := m.GetMenuVersion(ctx, menuID, version)
 	if err != nil {
 		return models.MenuV2{}, err
 	}
 
-	log.Println(result.InsertedID)
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"name": target.Name, "items": target.Items, "category_order": target.CategoryOrder}}
+	menu, err := m.changeMenu(ctx, bson.M{"_id": menuID, "deleted_at": nil}, update, models.MenuChangeRolledBack, version)
+
+	return menu, notFound(err, ErrMenuNotFound)
+}
+
+// changeMenu applies the update and counts up the menu's version, and records the menu as it is after the update
+// as that version, in one transaction. Items the update replaces keep their live stock and availability, an order
+// taking stock in between makes the transaction retry.
+func (m *Mongo) changeMenu(ctx context.Context, filter bson.M, update bson.M, change string, rolledBackTo int) (models.MenuV2, error) {
+	update["$inc"] = bson.M{"version": 1}
+
+	changed, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if set, ok := update["$set"].(bson.M); ok {
+			if items, ok := set["items"].([]models.MenuItemV2); ok {
+				var current models.MenuV2
+				if err := m.db.Collection(db.CollectionNameMenuV2).FindOne(sc, filter).Decode(&current); err != nil {
+					return nil, err
+				}
+				set["items"] = models.KeepLiveState(items, current.Items)
+			}
+		}
 
-	venueUpdate := bson.M{"$push": bson.M{"menu_ids": menu.ID}}
-	_, err = db.DB.Collection("venues").UpdateOne(ctx, bson.M{"_id": menu.VenueID}, venueUpdate)
+		var menu models.MenuV2
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := m.db.Collection(db.CollectionNameMenuV2).FindOneAndUpdate(sc, filter, update, opts).Decode(&menu); err != nil {
+			return nil, err
+		}
+
+		version := models.NewMenuVersion(menu, change)
+		version.RolledBackTo = rolledBackTo
+		_, err := m.db.Collection(db.CollectionNameMenuVersions).InsertOne(sc, version)
+
+		return menu, err
+	})
+	if err != nil {
+		return models.MenuV2{}, err
+	}
 
-	return menu, err
+	return changed.(models.MenuV2), nil
 }
@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mongo is the Store the server runs on
+type Mongo struct {
+	db *mongo.Database
+}
+
+var _ Store = (*Mongo)(nil)
+
+func NewMongo(database *mongo.Database) *Mongo {
+	return &Mongo{db: database}
+}
+
+// withTimeout bounds a single query, on top of whatever deadline the request already has
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 5*time.Second)
+}
+
+// transaction runs fn in a transaction, which needs MongoDB to run as a replica set
+func (m *Mongo) transaction(ctx context.Context, fn func(sc mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	session, err := m.db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, fn)
+}
+
+// notFound turns the driver's no documents error into the repository's own
+func notFound(err error, notFoundErr error) error {
+	if err == mongo.ErrNoDocuments {
+		return notFoundErr
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NextOrderNumber atomically takes the next order number of the venue's business day, starting at 1
+func (m *Mongo) NextOrderNumber(ctx context.Context, venueID primitive.ObjectID, businessDay string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	counters := m.db.Collection(db.CollectionNameOrderCounters)
+
+	filter := bson.M{"_id": models.OrderCounterID(venueID, businessDay)}
+	update := bson.M{
+		"$inc":         bson.M{"seq": 1},
+		"$setOnInsert": bson.M{"venue_id": venueID, "business_day": businessDay, "created_at": primitive.NewDateTimeFromTime(time.Now())},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter models.OrderCounter
+	err := counters.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// Two orders raced to create the day's counter, it exists now so incrementing it again can't conflict
+		err = counters.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	}
+
+	return counter.Seq, err
+}
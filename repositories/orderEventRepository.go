@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetOrderEventsAfter returns the venue's feed events that came after the given sequence number, oldest first
+func (m *Mongo) GetOrderEventsAfter(ctx context.Context, venueID primitive.ObjectID, afterSequence int64, limit int64) ([]models.OrderEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	events := []models.OrderEvent{}
+
+	filter := bson.M{"venue_id": venueID, "sequence": bson.M{"$gt": afterSequence}}
+	cursor, err := m.db.Collection(db.CollectionNameOrderEvents).Find(ctx, filter, options.Find().SetSort(bson.M{"sequence": 1}).SetLimit(limit))
+	if err != nil {
+		return events, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &events)
+
+	return events, err
+}
+
+// nextEventSequence numbers the venue's next feed event. Callers are inside the transaction that records the
+// event: two transactions bumping the same counter conflict until one commits, so a venue's events commit in
+// sequence order and a client that has seen one has seen every event before it.
+func (m *Mongo) nextEventSequence(ctx context.Context, venueID primitive.ObjectID) (int64, error) {
+	var counter models.OrderEventCounter
+	err := m.db.Collection(db.CollectionNameOrderEventCounters).FindOneAndUpdate(ctx,
+		bson.M{"_id": venueID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+
+	return counter.Seq, err
+}
+
+// recordOrderEvent appends the order's current state to the venue's feed, ctx is the session context of the
+// transaction that changed the order
+func (m *Mongo) recordOrderEvent(ctx context.Context, eventType string, order models.Order) error {
+	sequence, err := m.nextEventSequence(ctx, order.VenueID)
+	if err != nil {
+		return err
+	}
+
+	event := models.OrderEvent{
+		ID:        primitive.NewObjectID(),
+		VenueID:   order.VenueID,
+		Sequence:  sequence,
+		OrderID:   order.ID,
+		Type:      eventType,
+		Order:     order,
+		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	_, err = m.db.Collection(db.CollectionNameOrderEvents).InsertOne(ctx, event)
+
+	return err
+}
+
+// recordStockEvent puts a low stock alert on the venue's feed, along with the order that brought the stock down
+func (m *Mongo) recordStockEvent(ctx context.Context, order models.Order, alert models.StockAlert) error {
+	sequence, err := m.nextEventSequence(ctx, order.VenueID)
+	if err != nil {
+		return err
+	}
+
+	event := models.OrderEvent{
+		ID:        primitive.NewObjectID(),
+		VenueID:   order.VenueID,
+		Sequence:  sequence,
+		OrderID:   order.ID,
+		Type:      models.OrderEventLowStock,
+		Order:     order,
+		Stock:     &alert,
+		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	_, err = m.db.Collection(db.CollectionNameOrderEvents).InsertOne(ctx, event)
+
+	return err
+}
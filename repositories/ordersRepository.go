@@ -2,19 +2,174 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"time"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func GetOrderByID(orderId primitive.ObjectID) (models.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+var ErrOrderNotFound = errors.New("order not found")
+var ErrIllegalTransition = errors.New("illegal order status transition")
+var ErrOrderPaid = errors.New("items can't be changed once the order is paid")
+
+// How often a transition is retried when the order changes status between reading and writing it
+const transitionAttempts = 3
+
+func (m *Mongo) GetOrderByID(ctx context.Context, orderID primitive.ObjectID) (models.Order, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var order models.Order
-	err := db.DB.Collection(db.CollectionNameOrders).FindOne(ctx, bson.M{"_id": orderId}).Decode(&order)
+	err := m.db.Collection(db.CollectionNameOrders).FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+
+	return order, notFound(err, ErrOrderNotFound)
+}
+
+func (m *Mongo) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	return m.findOrders(ctx, bson.M{}, nil)
+}
+
+// GetOrdersByVenueID returns the venue's orders that aren't deleted, oldest first, limited to the given statuses if any
+func (m *Mongo) GetOrdersByVenueID(ctx context.Context, venueID primitive.ObjectID, statuses []models.OrderStatus) ([]models.Order, error) {
+	filter := bson.M{"venue_id": venueID, "deleted_at": bson.M{"$exists": false}}
+	if len(statuses) > 0 {
+		filter["status"] = bson.M{"$in": statuses}
+	}
+
+	return m.findOrders(ctx, filter, options.Find().SetSort(bson.M{"timestamp": 1}))
+}
+
+func (m *Mongo) findOrders(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	orders := []models.Order{}
+
+	cursor, err := m.db.Collection(db.CollectionNameOrders).Find(ctx, filter, opts)
+	if err != nil {
+		return orders, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &orders)
+
+	return orders, err
+}
+
+// CreateOrder inserts the order and announces it on the venue's feed
+func (m *Mongo) CreateOrder(ctx context.Context, order models.Order) error {
+	_, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := m.db.Collection(db.CollectionNameOrders).InsertOne(sc, order); err != nil {
+			return nil, err
+		}
+		return nil, m.recordOrderEvent(sc, models.OrderEventCreated, order)
+	})
+
+	return err
+}
+
+func (m *Mongo) UpdateOrderItems(ctx context.Context, orderID primitive.ObjectID, items []models.OrderItem, total models.Money, menuVersion int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	orders := m.db.Collection(db.CollectionNameOrders)
+
+	// The status is part of the filter so an order paid for since the caller read it keeps the items it was paid for
+	filter := bson.M{"_id": orderID, "status": bson.M{"$in": models.UnpaidOrderStatuses}}
+	update := bson.M{"$set": bson.M{"items": items, "total": total, "menu_version": menuVersion}}
+	result, err := orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := orders.CountDocuments(ctx, bson.M{"_id": orderID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrOrderNotFound
+	}
+	return ErrOrderPaid
+}
+
+func (m *Mongo) SoftDeleteOrder(ctx context.Context, orderID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())}}
+	_, err := m.db.Collection(db.CollectionNameOrders).UpdateOne(ctx, bson.M{"_id": orderID}, update)
+
+	return err
+}
+
+// TransitionOrder moves the order to a new status if its current status allows it and records the change in its
+// history. The status, the feed event and the stock the move takes or gives back are written in one transaction.
+func (m *Mongo) TransitionOrder(ctx context.Context, orderID primitive.ObjectID, to models.OrderStatus, trigger string, actor string) (models.Order, error) {
+	order, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return m.transitionOrder(sc, orderID, to, trigger, actor)
+	})
+	if order == nil {
+		return models.Order{}, err
+	}
+
+	return order.(models.Order), err
+}
+
+// transitionOrder is TransitionOrder for callers that are already inside a transaction
+func (m *Mongo) transitionOrder(ctx context.Context, orderID primitive.ObjectID, to models.OrderStatus, trigger string, actor string) (models.Order, error) {
+	orders := m.db.Collection(db.CollectionNameOrders)
+
+	for attempt := 0; attempt < transitionAttempts; attempt++ {
+		var order models.Order
+		err := orders.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			return order, ErrOrderNotFound
+		}
+		if err != nil {
+			return order, err
+		}
+
+		if !order.CanTransitionTo(to, trigger) {
+			return order, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, order.Status, to)
+		}
+
+		change := models.OrderStatusChange{
+			From:    order.Status,
+			To:      to,
+			At:      primitive.NewDateTimeFromTime(time.Now()),
+			Trigger: trigger,
+			Actor:   actor,
+		}
+		update := bson.M{
+			"$set":  bson.M{"status": to},
+			"$push": bson.M{"status_history": change},
+		}
+
+		// Only write if nobody changed the status since we read it
+		filter := bson.M{"_id": orderID, "status": order.Status}
+		err = orders.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return order, err
+		}
+
+		if err := m.recordOrderEvent(ctx, models.TransitionEventType(to), order); err != nil {
+			return order, err
+		}
+
+		return m.moveStock(ctx, order, to)
+	}
 
-	return order, err
+	return models.Order{}, fmt.Errorf("%w: order status kept changing", ErrIllegalTransition)
 }
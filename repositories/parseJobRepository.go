@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrParseJobNotFound = errors.New("parse job not found")
+var ErrParseJobFinished = errors.New("parse job already finished")
+
+func (m *Mongo) CreateParseJob(ctx context.Context, job models.ParseJob) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db.Collection(db.CollectionNameParseJobs).InsertOne(ctx, job)
+
+	return err
+}
+
+func (m *Mongo) GetParseJob(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var job models.ParseJob
+	opts := options.FindOne().SetProjection(bson.M{"file": 0})
+	err := m.db.Collection(db.CollectionNameParseJobs).FindOne(ctx, bson.M{"_id": jobID, "venue_id": venueID}, opts).Decode(&job)
+
+	return job, notFound(err, ErrParseJobNotFound)
+}
+
+func (m *Mongo) ClaimParseJob(ctx context.Context, leaseUntil time.Time) (models.ParseJob, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.ParseJobQueued},
+		bson.M{"status": models.ParseJobRunning, "lease_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": models.ParseJobRunning, "started_at": now, "lease_until": primitive.NewDateTimeFromTime(leaseUntil)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"created_at": 1}).SetReturnDocument(options.After)
+
+	var job models.ParseJob
+	err := m.db.Collection(db.CollectionNameParseJobs).FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+
+	return job, notFound(err, ErrParseJobNotFound)
+}
+
+func (m *Mongo) FinishParseJob(ctx context.Context, job models.ParseJob) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": job.ID, "status": models.ParseJobRunning, "attempts": job.Attempts}
+	set := bson.M{"status": job.Status, "finished_at": primitive.NewDateTimeFromTime(time.Now())}
+	if !job.DraftID.IsZero() {
+		set["draft_id"] = job.DraftID
+	}
+	if job.Error != "" {
+		set["error"] = job.Error
+	}
+	if len(job.Problems) > 0 {
+		set["problems"] = job.Problems
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"file": "", "lease_until": ""}}
+
+	result, err := m.db.Collection(db.CollectionNameParseJobs).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (m *Mongo) CancelParseJob(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": jobID, "venue_id": venueID, "status": bson.M{"$in": bson.A{models.ParseJobQueued, models.ParseJobRunning}}}
+	update := bson.M{
+		"$set":   bson.M{"status": models.ParseJobCancelled, "finished_at": primitive.NewDateTimeFromTime(time.Now())},
+		"$unset": bson.M{"file": "", "lease_until": ""},
+	}
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"file": 0}).SetReturnDocument(options.After)
+
+	var job models.ParseJob
+	err := m.db.Collection(db.CollectionNameParseJobs).FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == nil {
+		return job, nil
+	}
+	if notFound(err, ErrParseJobNotFound) != ErrParseJobNotFound {
+		return job, err
+	}
+
+	// Tell a job that doesn't exist from one that's done already
+	job, err = m.GetParseJob(ctx, venueID, jobID)
+	if err != nil {
+		return job, err
+	}
+	return job, ErrParseJobFinished
+}
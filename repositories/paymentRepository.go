@@ -2,27 +2,191 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"log"
 	"time"
 
 	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
-	"github.com/stripe/stripe-go/v78"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func CreatePayment(order *models.Order, session *stripe.CheckoutSession) (models.Payment, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// ErrPaymentNotFound is returned when a Stripe event doesn't match any payment we know of
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// PaymentMatch selects the payment a Stripe event belongs to, by checkout session or by payment intent
+type PaymentMatch struct {
+	StripeID        string
+	PaymentIntentID string
+	// OrderID matches the order's payments that aren't linked to an intent yet, for intent events that arrive
+	// before the checkout session completes
+	OrderID primitive.ObjectID
+}
+
+// Matches tells whether the payment is the one the event belongs to
+func (match PaymentMatch) Matches(payment models.Payment) bool {
+	if match.StripeID != "" {
+		return payment.StripeID == match.StripeID
+	}
+	if payment.PaymentIntentID != "" {
+		return payment.PaymentIntentID == match.PaymentIntentID
+	}
+	return !match.OrderID.IsZero() && payment.OrderID == match.OrderID
+}
+
+func (match PaymentMatch) filter() bson.M {
+	if match.StripeID != "" {
+		return bson.M{"stripe_id": match.StripeID}
+	}
+
+	or := []bson.M{{"payment_intent_id": match.PaymentIntentID}}
+	if !match.OrderID.IsZero() {
+		or = append(or, bson.M{"order_id": match.OrderID, "payment_intent_id": bson.M{"$exists": false}})
+	}
+	return bson.M{"$or": or}
+}
+
+// PaymentEventUpdate describes the state a Stripe event moves a payment and its order into
+type PaymentEventUpdate struct {
+	Match PaymentMatch
+	// FromStatuses are the payment statuses the transition is allowed from, anything else is stale
+	FromStatuses    []string
+	Status          string
+	PaymentIntentID string
+	// RefundedAmount only ever raises the payment's refunded amount, refunds we issued ourselves are already counted
+	RefundedAmount int64
+	// OrderStatus is left untouched when empty
+	OrderStatus models.OrderStatus
+}
+
+func (m *Mongo) GetPaymentByID(ctx context.Context, paymentID primitive.ObjectID) (models.Payment, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": paymentID, "deleted_at": bson.M{"$exists": false}}
+
+	var payment models.Payment
+	err := m.db.Collection(db.CollectionNamePayments).FindOne(ctx, filter).Decode(&payment)
+
+	return payment, notFound(err, ErrPaymentNotFound)
+}
+
+func (m *Mongo) GetAllPayments(ctx context.Context) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	payments := []models.Payment{}
+
+	cursor, err := m.db.Collection(db.CollectionNamePayments).Find(ctx, bson.M{"deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		return payments, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &payments)
+
+	return payments, err
+}
+
+func (m *Mongo) CreatePayment(ctx context.Context, payment models.Payment) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db.Collection(db.CollectionNamePayments).InsertOne(ctx, payment)
+
+	return err
+}
+
+func (m *Mongo) UpdatePayment(ctx context.Context, paymentID primitive.ObjectID, fields Fields) error {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	payment := models.Payment{
-		ID:       primitive.NewObjectID(),
-		Amount:   float64(session.AmountTotal) / 100,
-		Status:   string(session.Status),
-		OrderID:  order.ID,
-		StripeID: session.ID,
+	filter := bson.M{"_id": paymentID, "deleted_at": bson.M{"$exists": false}}
+	result, err := m.db.Collection(db.CollectionNamePayments).UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return err
 	}
+	if result.MatchedCount == 0 {
+		return ErrPaymentNotFound
+	}
+
+	return nil
+}
 
-	_, err := db.DB.Collection(db.CollectionNamePayments).InsertOne(ctx, payment)
+func (m *Mongo) SoftDeletePayment(ctx context.Context, paymentID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())}}
+	_, err := m.db.Collection(db.CollectionNamePayments).UpdateOne(ctx, bson.M{"_id": paymentID}, update)
+
+	return err
+}
+
+// ApplyPaymentEvent records the Stripe event and moves the matching payment and its order in one transaction.
+// It returns false without changing anything when the event was already processed or arrives out of order.
+func (m *Mongo) ApplyPaymentEvent(ctx context.Context, event models.StripeEvent, update PaymentEventUpdate) (bool, error) {
+	applied, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		_, err := m.db.Collection(db.CollectionNameStripeEvents).InsertOne(sc, event)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		now := primitive.NewDateTimeFromTime(time.Now())
+		set := bson.M{"status": update.Status, "updated_at": now}
+		if update.PaymentIntentID != "" {
+			set["payment_intent_id"] = update.PaymentIntentID
+		}
+
+		filter := update.Match.filter()
+		filter["deleted_at"] = bson.M{"$exists": false}
+		filter["status"] = bson.M{"$in": update.FromStatuses}
+
+		change := bson.M{"$set": set}
+		if update.RefundedAmount > 0 {
+			change["$max"] = bson.M{"refunded_amount.amount": update.RefundedAmount}
+		}
+
+		var payment models.Payment
+		err = m.db.Collection(db.CollectionNamePayments).FindOneAndUpdate(sc, filter, change,
+			options.FindOneAndUpdate().SetSort(bson.M{"timestamp": -1}).SetReturnDocument(options.Before)).Decode(&payment)
+		if err == mongo.ErrNoDocuments {
+			// The payment exists but already moved past this event, keep the event record so it's not reapplied
+			count, err := m.db.Collection(db.CollectionNamePayments).CountDocuments(sc, update.Match.filter())
+			if err != nil {
+				return false, err
+			}
+			if count == 0 {
+				return false, ErrPaymentNotFound
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		// A further partial refund, or one already recorded by CompleteRefund, only raises the refunded amount
+		if update.OrderStatus != "" && payment.Status != update.Status {
+			_, err = m.transitionOrder(sc, payment.OrderID, update.OrderStatus, models.OrderTriggerStripe, event.ID)
+			if errors.Is(err, ErrIllegalTransition) {
+				// The money moved regardless, keep the payment in sync and leave the order for staff to resolve
+				log.Println("[paymentRepository]", "order", payment.OrderID.Hex(), "not moved by", event.ID, err)
+			} else if err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
 
-	return payment, err
+	return applied.(bool), nil
 }
@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetCapturedPaymentForOrder returns the most recent payment on the order that has money on it
+func (m *Mongo) GetCapturedPaymentForOrder(ctx context.Context, orderID primitive.ObjectID) (models.Payment, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"order_id":   orderID,
+		"status":     bson.M{"$in": []string{models.PaymentStatusComplete, models.PaymentStatusPartiallyRefunded}},
+		"deleted_at": bson.M{"$exists": false},
+	}
+
+	var payment models.Payment
+	err := m.db.Collection(db.CollectionNamePayments).FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"timestamp": -1})).Decode(&payment)
+
+	return payment, notFound(err, ErrPaymentNotFound)
+}
+
+func (m *Mongo) GetRefundsByOrderID(ctx context.Context, orderID primitive.ObjectID) ([]models.Refund, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	refunds := []models.Refund{}
+
+	cursor, err := m.db.Collection(db.CollectionNameRefunds).Find(ctx, bson.M{"order_id": orderID}, options.Find().SetSort(bson.M{"timestamp": 1}))
+	if err != nil {
+		return refunds, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &refunds)
+
+	return refunds, err
+}
+
+// ReserveRefund inserts a pending refund and adds its amount to the payment's refunded amount, as long as the
+// total stays within what was captured. It returns false when the refund would exceed the captured amount.
+func (m *Mongo) ReserveRefund(ctx context.Context, refund models.Refund) (bool, error) {
+	reserved, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		filter := bson.M{
+			"_id":             refund.PaymentID,
+			"amount.currency": refund.Amount.Currency,
+			"$expr": bson.M{"$lte": bson.A{
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refunded_amount.amount", 0}}, refund.Amount.Amount}},
+				"$amount.amount",
+			}},
+		}
+		update := bson.M{"$inc": bson.M{"refunded_amount.amount": refund.Amount.Amount}, "$set": bson.M{"refunded_amount.currency": refund.Amount.Currency}}
+		result, err := m.db.Collection(db.CollectionNamePayments).UpdateOne(sc, filter, update)
+		if err != nil {
+			return false, err
+		}
+		if result.ModifiedCount == 0 {
+			return false, nil
+		}
+
+		_, err = m.db.Collection(db.CollectionNameRefunds).InsertOne(sc, refund)
+
+		return err == nil, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return reserved.(bool), nil
+}
+
+// CompleteRefund marks the refund as succeeded and moves the payment and order to refunded or partially refunded
+func (m *Mongo) CompleteRefund(ctx context.Context, refund models.Refund) (models.Payment, error) {
+	payment, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		update := bson.M{"$set": bson.M{"status": models.RefundStatusSucceeded, "stripe_refund_id": refund.StripeRefundID}}
+		_, err := m.db.Collection(db.CollectionNameRefunds).UpdateOne(sc, bson.M{"_id": refund.ID}, update)
+		if err != nil {
+			return models.Payment{}, err
+		}
+
+		var payment models.Payment
+		err = m.db.Collection(db.CollectionNamePayments).FindOne(sc, bson.M{"_id": refund.PaymentID}).Decode(&payment)
+		if err != nil {
+			return models.Payment{}, err
+		}
+
+		from := payment.Status
+		payment.Status = models.PaymentStatusPartiallyRefunded
+		orderStatus := models.OrderStatusPartiallyRefunded
+		if payment.RefundedAmount.Amount >= payment.Amount.Amount {
+			payment.Status = models.PaymentStatusRefunded
+			orderStatus = models.OrderStatusRefunded
+		}
+
+		now := primitive.NewDateTimeFromTime(time.Now())
+		payment.UpdatedAt = &now
+		_, err = m.db.Collection(db.CollectionNamePayments).UpdateOne(sc, bson.M{"_id": payment.ID}, bson.M{"$set": bson.M{"status": payment.Status, "updated_at": now}})
+		if err != nil {
+			return models.Payment{}, err
+		}
+
+		// Refunded items go back in stock, a refund of everything gives back the rest when the order moves to refunded
+		if len(refund.Items) > 0 {
+			var order models.Order
+			err = m.db.Collection(db.CollectionNameOrders).FindOne(sc, bson.M{"_id": refund.OrderID}).Decode(&order)
+			if err != nil {
+				return models.Payment{}, notFound(err, ErrOrderNotFound)
+			}
+			if _, err := m.returnStock(sc, order, models.RefundStockLines(refund.Items)); err != nil {
+				return models.Payment{}, err
+			}
+		}
+
+		// A further partial refund, or one the charge.refunded webhook already recorded, leaves the order as it is
+		if from == payment.Status {
+			return payment, nil
+		}
+		_, err = m.transitionOrder(sc, refund.OrderID, orderStatus, models.OrderTriggerRefund, refund.ID.Hex())
+		if errors.Is(err, ErrIllegalTransition) {
+			log.Println("[refundRepository]", "order", refund.OrderID.Hex(), "not moved by refund", refund.ID.Hex(), err)
+			err = nil
+		}
+
+		return payment, err
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment.(models.Payment), nil
+}
+
+// FailRefund marks the refund as failed and gives its amount back to the payment
+func (m *Mongo) FailRefund(ctx context.Context, refund models.Refund, reason string) error {
+	_, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		update := bson.M{"$set": bson.M{"status": models.RefundStatusFailed, "error": reason}}
+		_, err := m.db.Collection(db.CollectionNameRefunds).UpdateOne(sc, bson.M{"_id": refund.ID}, update)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = m.db.Collection(db.CollectionNamePayments).UpdateOne(sc, bson.M{"_id": refund.PaymentID}, bson.M{"$inc": bson.M{"refunded_amount.amount": -refund.Amount.Amount}})
+
+		return nil, err
+	})
+
+	return err
+}
@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fields is a partial update, bson field names to their new value. Handlers build it with utils.UpdateFields.
+type Fields map[string]interface{}
+
+var ErrMenuNotFound = errors.New("menu not found")
+var ErrMenuItemNotFound = errors.New("menu item not found")
+var ErrMenuVersionNotFound = errors.New("menu version not found")
+var ErrUserNotFound = errors.New("user not found")
+
+type VenueRepository interface {
+	GetVenueByID(ctx context.Context, venueID primitive.ObjectID) (models.Venue, error)
+	// GetAllVenues and GetVenuesByIDs leave out deleted venues
+	GetAllVenues(ctx context.Context) ([]models.Venue, error)
+	GetVenuesByIDs(ctx context.Context, venueIDs []primitive.ObjectID) ([]models.Venue, error)
+	// GetNearbyVenues returns the venues within the query's radius that aren't deleted, nearest first
+	GetNearbyVenues(ctx context.Context, query NearbyVenuesQuery) ([]NearbyVenue, error)
+	CreateVenue(ctx context.Context, venue models.Venue) (models.Venue, error)
+	UpdateVenue(ctx context.Context, venueID primitive.ObjectID, fields Fields) (models.Venue, error)
+	SoftDeleteVenue(ctx context.Context, venueID primitive.ObjectID) error
+}
+
+type MenuRepository interface {
+	GetMenuByID(ctx context.Context, menuID primitive.ObjectID) (models.MenuV2, error)
+	GetMenuByLegacyID(ctx context.Context, legacyMenuID primitive.ObjectID) (models.MenuV2, error)
+	// GetAllMenus, GetMenusByVenueID and GetMenusByVenueIDs leave out deleted menus, but not deleted items
+	GetAllMenus(ctx context.Context) ([]models.MenuV2, error)
+	GetMenusByVenueID(ctx context.Context, venueID primitive.ObjectID) ([]models.MenuV2, error)
+	GetMenusByVenueIDs(ctx context.Context, venueIDs []primitive.ObjectID) ([]models.MenuV2, error)
+	// CreateMenu also adds the menu to its venue's menu_ids. It and the other changes to a menu's contents below
+	// count up its version and record the menu as that version.
+	CreateMenu(ctx context.Context, menu models.MenuV2) (models.MenuV2, error)
+	UpdateMenu(ctx context.Context, menuID primitive.ObjectID, fields Fields) (models.MenuV2, error)
+	// SoftDeleteMenu deletes the menu along with all its items
+	SoftDeleteMenu(ctx context.Context, menuID primitive.ObjectID) error
+	AddMenuItem(ctx context.Context, menuID primitive.ObjectID, item models.MenuItemV2) (models.MenuItemV2, error)
+	UpdateMenuItem(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID, fields Fields) error
+	SoftDeleteMenuItem(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID) error
+	// SetMenuItemAvailability marks the items available, sold out until a time or for good with a nil until, or
+	// hidden. It's an everyday change during service and doesn't make a new version of the menu.
+	SetMenuItemAvailability(ctx context.Context, menuID primitive.ObjectID, itemIDs []primitive.ObjectID, availability string, until *primitive.DateTime) error
+	// SetMenuItemStock counts the item's stock from now on, or stops counting it with a nil stock. Paying for an order
+	// counts it down and cancelling or refunding the order counts it back up, the item is sold out while none are left.
+	SetMenuItemStock(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID, stock *int, lowStockAt int) (models.MenuItemV2, error)
+	// GetMenuVersions returns the menu's versions newest first, without their items
+	GetMenuVersions(ctx context.Context, menuID primitive.ObjectID) ([]models.MenuVersion, error)
+	GetMenuVersion(ctx context.Context, menuID primitive.ObjectID, version int) (models.MenuVersion, error)
+	// RollbackMenu puts back the name, items and category order of an earlier version, as a new version
+	RollbackMenu(ctx context.Context, menuID primitive.ObjectID, version int) (models.MenuV2, error)
+}
+
+type OrderRepository interface {
+	GetOrderByID(ctx context.Context, orderID primitive.ObjectID) (models.Order, error)
+	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	GetOrdersByVenueID(ctx context.Context, venueID primitive.ObjectID, statuses []models.OrderStatus) ([]models.Order, error)
+	// CreateOrder inserts the order and announces it on the venue's feed
+	CreateOrder(ctx context.Context, order models.Order) error
+	// UpdateOrderItems replaces the order's items with ones priced from the given menu version, as long as the order
+	// hasn't been paid for. Status changes go through TransitionOrder.
+	UpdateOrderItems(ctx context.Context, orderID primitive.ObjectID, items []models.OrderItem, total models.Money, menuVersion int) error
+	SoftDeleteOrder(ctx context.Context, orderID primitive.ObjectID) error
+	// TransitionOrder moves the order to a new status if its current status allows it and records the change in
+	// its history and on the venue's feed. Paying for the order takes its counted items out of stock, cancelling or
+	// refunding it puts them back.
+	TransitionOrder(ctx context.Context, orderID primitive.ObjectID, to models.OrderStatus, trigger string, actor string) (models.Order, error)
+	// NextOrderNumber atomically takes the next order number of the venue's business day, starting at 1
+	NextOrderNumber(ctx context.Context, venueID primitive.ObjectID, businessDay string) (int, error)
+	// GetOrderEventsAfter returns the venue's feed events that came after the given sequence number, oldest first
+	GetOrderEventsAfter(ctx context.Context, venueID primitive.ObjectID, afterSequence int64, limit int64) ([]models.OrderEvent, error)
+}
+
+type PaymentRepository interface {
+	GetPaymentByID(ctx context.Context, paymentID primitive.ObjectID) (models.Payment, error)
+	GetAllPayments(ctx context.Context) ([]models.Payment, error)
+	CreatePayment(ctx context.Context, payment models.Payment) error
+	UpdatePayment(ctx context.Context, paymentID primitive.ObjectID, fields Fields) error
+	SoftDeletePayment(ctx context.Context, paymentID primitive.ObjectID) error
+	// ApplyPaymentEvent records the Stripe event and moves the matching payment and its order at once. It returns
+	// false without changing anything when the event was already processed or arrives out of order.
+	ApplyPaymentEvent(ctx context.Context, event models.StripeEvent, update PaymentEventUpdate) (bool, error)
+
+	// GetCapturedPaymentForOrder returns the most recent payment on the order that has money on it
+	GetCapturedPaymentForOrder(ctx context.Context, orderID primitive.ObjectID) (models.Payment, error)
+	GetRefundsByOrderID(ctx context.Context, orderID primitive.ObjectID) ([]models.Refund, error)
+	// ReserveRefund inserts a pending refund and adds its amount to the payment's refunded amount, as long as the
+	// total stays within what was captured. It returns false when the refund would exceed the captured amount.
+	ReserveRefund(ctx context.Context, refund models.Refund) (bool, error)
+	// CompleteRefund marks the refund as succeeded and moves the payment and order to refunded or partially refunded
+	CompleteRefund(ctx context.Context, refund models.Refund) (models.Payment, error)
+	// FailRefund marks the refund as failed and gives its amount back to the payment
+	FailRefund(ctx context.Context, refund models.Refund, reason string) error
+}
+
+type UserRepository interface {
+	// GetUserByUserID finds the user by the ID of their login, not the document ID
+	GetUserByUserID(ctx context.Context, userID string) (models.UserV2, error)
+	GetUserByID(ctx context.Context, id primitive.ObjectID) (models.UserV2, error)
+	GetAllUsers(ctx context.Context) ([]models.UserV2, error)
+	CreateUser(ctx context.Context, user models.UserV2) (models.UserV2, error)
+	UpdateUser(ctx context.Context, id primitive.ObjectID, fields Fields) (models.UserV2, error)
+	SoftDeleteUser(ctx context.Context, id primitive.ObjectID) error
+	// FollowUser makes the user follow another one and returns the followed user
+	FollowUser(ctx context.Context, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error)
+	UnfollowUser(ctx context.Context, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error)
+}
+
+type StripeAccountRepository interface {
+	GetStripeAccounts(ctx context.Context) ([]models.StripeAccount, error)
+	AddStripeAccount(ctx context.Context, stripeAccountID string) (models.StripeAccount, error)
+	// GetStripeAccountByVenueID also finds accounts linked the way older versions did
+	GetStripeAccountByVenueID(ctx context.Context, venueID primitive.ObjectID) (models.StripeAccount, error)
+	// LinkVenue makes the account the only one linked to the venue, keeping both sides of the link in sync
+	LinkVenue(ctx context.Context, venueID primitive.ObjectID, stripeAccountID string) error
+}
+
+type TableRepository interface {
+	GetTablesByVenueID(ctx context.Context, venueID primitive.ObjectID) ([]models.Table, error)
+	// GetVenueTable returns the table if it belongs to the venue and isn't deleted
+	GetVenueTable(ctx context.Context, venueID primitive.ObjectID, tableID primitive.ObjectID) (models.Table, error)
+	CreateTable(ctx context.Context, table models.Table) error
+	// UpdateTable renames the table or moves it to another zone
+	UpdateTable(ctx context.Context, table models.Table) error
+	SoftDeleteTable(ctx context.Context, venueID primitive.ObjectID, tableID primitive.ObjectID) error
+}
+
+type ParseJobRepository interface {
+	CreateParseJob(ctx context.Context, job models.ParseJob) error
+	// GetParseJob returns the venue's job, without its file
+	GetParseJob(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error)
+	// ClaimParseJob takes the oldest queued job, or a running one whose lease has run out, marks it running until
+	// leaseUntil and counts the attempt. It returns ErrParseJobNotFound when there's nothing to run.
+	ClaimParseJob(ctx context.Context, leaseUntil time.Time) (models.ParseJob, error)
+	// FinishParseJob stores the outcome of the attempt and drops the file. It returns false when the attempt no
+	// longer owns the job, because the job was cancelled or claimed again after its lease ran out.
+	FinishParseJob(ctx context.Context, job models.ParseJob) (bool, error)
+	// CancelParseJob cancels a job that hasn't finished, ErrParseJobFinished if it has
+	CancelParseJob(ctx context.Context, venueID primitive.ObjectID, jobID primitive.ObjectID) (models.ParseJob, error)
+}
+
+type MenuDraftRepository interface {
+	CreateMenuDraft(ctx context.Context, draft models.MenuDraft) error
+	GetMenuDraft(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID) (models.MenuDraft, error)
+	// GetOpenMenuDrafts returns the venue's drafts that are waiting to be reviewed, newest first
+	GetOpenMenuDrafts(ctx context.Context, venueID primitive.ObjectID) ([]models.MenuDraft, error)
+	// UpdateMenuDraft saves the draft's name, items and warnings, ErrMenuDraftClosed once it's published or discarded
+	UpdateMenuDraft(ctx context.Context, draft models.MenuDraft) error
+	// CloseMenuDraft publishes or discards an open draft, ErrMenuDraftClosed if it isn't open anymore
+	CloseMenuDraft(ctx context.Context, venueID primitive.ObjectID, draftID primitive.ObjectID, status string, menuID primitive.ObjectID) error
+}
+
+// Store is everything the handlers read and write, NewMongo is the real one and memory.New the one for tests
+type Store interface {
+	VenueRepository
+	MenuRepository
+	OrderRepository
+	PaymentRepository
+	UserRepository
+	StripeAccountRepository
+	TableRepository
+	ParseJobRepository
+	MenuDraftRepository
+}
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"log"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *Mongo) SetMenuItemStock(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID, stock *int, lowStockAt int) (models.MenuItemV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	set := bson.M{"items.$.low_stock_at": lowStockAt}
+	update := bson.M{"$set": set}
+	if stock != nil {
+		set["items.$.stock"] = *stock
+	} else {
+		update["$unset"] = bson.M{"items.$.stock": ""}
+	}
+
+	filter := bson.M{"_id": menuID, "items._id": itemID}
+	result, err := m.db.Collection(db.CollectionNameMenuV2).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return models.MenuItemV2{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.MenuItemV2{}, ErrMenuItemNotFound
+	}
+
+	if err := m.syncSoldOut(ctx, menuID, itemID); err != nil {
+		return models.MenuItemV2{}, err
+	}
+
+	var menu models.MenuV2
+	err = m.db.Collection(db.CollectionNameMenuV2).FindOne(ctx, bson.M{"_id": menuID}).Decode(&menu)
+	if err != nil {
+		return models.MenuItemV2{}, notFound(err, ErrMenuItemNotFound)
+	}
+	item, _ := menu.Item(itemID)
+
+	return item, nil
+}
+
+// moveStock takes the order's counted items off the menu when it's paid, and gives back what it took when it's
+// cancelled or refunded
+func (m *Mongo) moveStock(ctx context.Context, order models.Order, to models.OrderStatus) (models.Order, error) {
+	switch to {
+	case models.OrderStatusPaid:
+		return m.takeStock(ctx, order)
+	case models.OrderStatusCancelled, models.OrderStatusRefunded:
+		return m.returnStock(ctx, order, order.Stock)
+	}
+	return order, nil
+}
+
+// takeStock counts down the menu's counted items by what the order has, sells out what runs out and puts an alert
+// on the venue's feed for what runs low. Counters only move by atomic updates so concurrent checkouts can't take
+// the same portion twice.
+func (m *Mongo) takeStock(ctx context.Context, order models.Order) (models.Order, error) {
+	var taken []models.StockLine
+	for _, line := range order.StockLines() {
+		item, quantity, err := m.takeItemStock(ctx, order.MenuID, line)
+		if err != nil {
+			return order, err
+		}
+		if quantity == 0 {
+			continue
+		}
+		if quantity < line.Quantity {
+			log.Println("[stockRepository]", "order", order.ID.Hex(), "paid for", line.Quantity, item.Name, "with", quantity, "left")
+		}
+		taken = append(taken, models.StockLine{MenuItemID: line.MenuItemID, Quantity: quantity})
+
+		if *item.Stock <= 0 {
+			if err := m.syncSoldOut(ctx, order.MenuID, item.ID); err != nil {
+				return order, err
+			}
+		}
+		if item.LowOnStock(*item.Stock + quantity) {
+			if err := m.recordStockEvent(ctx, order, item.StockAlert(order.MenuID)); err != nil {
+				return order, err
+			}
+		}
+	}
+	if len(taken) == 0 {
+		return order, nil
+	}
+
+	order.Stock = taken
+	_, err := m.db.Collection(db.CollectionNameOrders).UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$set": bson.M{"stock": taken}})
+
+	return order, err
+}
+
+// takeItemStock takes the line's quantity of a counted item, or what's left of it when there's less. The guest has
+// paid by now, so the order stands either way. It returns the item as it is afterwards and how many were taken,
+// none when the item isn't counted or sold out.
+func (m *Mongo) takeItemStock(ctx context.Context, menuID primitive.ObjectID, line models.StockLine) (models.MenuItemV2, int, error) {
+	menus := m.db.Collection(db.CollectionNameMenuV2)
+	withStock := func(stock bson.M) bson.M {
+		return bson.M{"_id": menuID, "items": bson.M{"$elemMatch": bson.M{"_id": line.MenuItemID, "stock": stock}}}
+	}
+
+	var menu models.MenuV2
+	update := bson.M{"$inc": bson.M{"items.$.stock": -line.Quantity}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := menus.FindOneAndUpdate(ctx, withStock(bson.M{"$gte": line.Quantity}), update, opts).Decode(&menu)
+	if err == nil {
+		item, _ := menu.Item(line.MenuItemID)
+		return item, line.Quantity, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.MenuItemV2{}, 0, err
+	}
+
+	// The menu as it was before, to know how many were left
+	update = bson.M{"$set": bson.M{"items.$.stock": 0}}
+	err = menus.FindOneAndUpdate(ctx, withStock(bson.M{"$gt": 0, "$lt": line.Quantity}), update).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		return models.MenuItemV2{}, 0, nil
+	}
+	if err != nil {
+		return models.MenuItemV2{}, 0, err
+	}
+
+	item, _ := menu.Item(line.MenuItemID)
+	left := *item.Stock
+	none := 0
+	item.Stock = &none
+
+	return item, left, nil
+}
+
+// returnStock gives back the lines of what the order took, and keeps track of what it still has
+func (m *Mongo) returnStock(ctx context.Context, order models.Order, lines []models.StockLine) (models.Order, error) {
+	returned, kept := models.ReturnStock(order.Stock, lines)
+	if len(returned) == 0 {
+		return order, nil
+	}
+
+	for _, line := range returned {
+		filter := bson.M{"_id": order.MenuID, "items": bson.M{"$elemMatch": bson.M{"_id": line.MenuItemID, "stock": bson.M{"$exists": true}}}}
+		_, err := m.db.Collection(db.CollectionNameMenuV2).UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"items.$.stock": line.Quantity}})
+		if err != nil {
+			return order, err
+		}
+		if err := m.syncSoldOut(ctx, order.MenuID, line.MenuItemID); err != nil {
+			return order, err
+		}
+	}
+
+	order.Stock = kept
+	update := bson.M{"$set": bson.M{"stock": kept}}
+	if len(kept) == 0 {
+		update = bson.M{"$unset": bson.M{"stock": ""}}
+	}
+	_, err := m.db.Collection(db.CollectionNameOrders).UpdateOne(ctx, bson.M{"_id": order.ID}, update)
+
+	return order, err
+}
+
+// syncSoldOut sells out a counted item that has none left, and puts it back once it has some again. Items staff sold
+// out until a time or hid stay the way they are.
+func (m *Mongo) syncSoldOut(ctx context.Context, menuID primitive.ObjectID, itemID primitive.ObjectID) error {
+	menus := m.db.Collection(db.CollectionNameMenuV2)
+
+	filter := bson.M{"_id": menuID, "items": bson.M{"$elemMatch": bson.M{
+		"_id":          itemID,
+		"stock":        bson.M{"$lte": 0},
+		"availability": bson.M{"$nin": []string{models.ItemSoldOut, models.ItemHidden}},
+	}}}
+	update := bson.M{"$set": bson.M{"items.$.availability": models.ItemSoldOut}, "$unset": bson.M{"items.$.sold_out_until": ""}}
+	if _, err := menus.UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+
+	filter = bson.M{"_id": menuID, "items": bson.M{"$elemMatch": bson.M{
+		"_id":            itemID,
+		"stock":          bson.M{"$gt": 0},
+		"availability":   models.ItemSoldOut,
+		"sold_out_until": bson.M{"$exists": false},
+	}}}
+	_, err := menus.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"items.$.availability": models.ItemAvailable}})
+
+	return err
+}
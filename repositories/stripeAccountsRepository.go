@@ -2,70 +2,108 @@ package repositories
 
 import (
 	"context"
+	"errors"
+
 	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"time"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GetStripeAccounts() ([]models.StripeAccount, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+var ErrStripeAccountNotFound = errors.New("stripe account not found")
+
+func (m *Mongo) GetStripeAccounts(ctx context.Context) ([]models.StripeAccount, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	var accounts []models.StripeAccount
+	accounts := []models.StripeAccount{}
 
-	cursor, err := db.DB.Collection(db.CollectionNameStripeAccounts).Find(ctx, bson.M{})
+	cursor, err := m.db.Collection(db.CollectionNameStripeAccounts).Find(ctx, bson.M{})
 	if err != nil {
 		return accounts, err
 	}
 	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var account models.StripeAccount
-		if err := cursor.Decode(&account); err != nil {
-			return accounts, err
-		}
-		accounts = append(accounts, account)
-	}
+	err = cursor.All(ctx, &accounts)
 
 	return accounts, err
 }
 
-func AddStripeAccount(stripeAccountNumber string) (models.StripeAccount, error) {
+func (m *Mongo) AddStripeAccount(ctx context.Context, stripeAccountNumber string) (models.StripeAccount, error) {
 	objId := primitive.NewObjectID()
 	account := models.StripeAccount{
 		ID:              objId,
 		StripeAccountID: stripeAccountNumber,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	_, err := db.DB.Collection(db.CollectionNameStripeAccounts).InsertOne(ctx, &account)
+	_, err := m.db.Collection(db.CollectionNameStripeAccounts).InsertOne(ctx, &account)
 
 	return account, err
 }
 
-func GetStripeAccountByVenueId(venueId primitive.ObjectID) (models.StripeAccount, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GetStripeAccountByVenueID also finds accounts linked before venue_id, under venueId
+func (m *Mongo) GetStripeAccountByVenueID(ctx context.Context, venueId primitive.ObjectID) (models.StripeAccount, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var account models.StripeAccount
-	err := db.DB.Collection(db.CollectionNameOrders).FindOne(ctx, bson.M{"venueId": venueId}).Decode(&account)
+	filter := bson.M{"$or": bson.A{bson.M{"venue_id": venueId}, bson.M{"venueId": venueId}}}
+	err := m.db.Collection(db.CollectionNameStripeAccounts).FindOne(ctx, filter).Decode(&account)
 
-	return account, err
+	return account, notFound(err, ErrStripeAccountNotFound)
 }
 
-func LinkVenue(venueId primitive.ObjectID, accountNumber string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// LinkVenue makes the account the only one linked to the venue, keeping stripeAccounts.venue_id and
+// venues.stripe_account_id in sync
+func (m *Mongo) LinkVenue(ctx context.Context, venueId primitive.ObjectID, accountNumber string) error {
+	_, err := m.transaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		accounts := m.db.Collection(db.CollectionNameStripeAccounts)
+		venues := m.db.Collection(db.CollectionNameVenue)
 
-	update := bson.M{
-		"$set": bson.M{"venueId": venueId},
-	}
+		var account models.StripeAccount
+		err := accounts.FindOne(sc, bson.M{"stripe_account_id": accountNumber}).Decode(&account)
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrStripeAccountNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := venues.UpdateOne(sc, bson.M{"_id": venueId}, bson.M{"$set": bson.M{"stripe_account_id": accountNumber}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrVenueNotFound
+		}
+
+		// Unlink whatever this venue was linked to before
+		_, err = accounts.UpdateMany(sc, bson.M{"venue_id": venueId, "stripe_account_id": bson.M{"$ne": accountNumber}}, bson.M{"$unset": bson.M{"venue_id": ""}})
+		if err != nil {
+			return nil, err
+		}
+
+		// And the venue this account was linked to before
+		if !account.VenueID.IsZero() && account.VenueID != venueId {
+			_, err = venues.UpdateOne(sc, bson.M{"_id": account.VenueID}, bson.M{"$unset": bson.M{"stripe_account_id": ""}})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// venueId is the field older versions of this function wrote
+		update := bson.M{
+			"$set":   bson.M{"venue_id": venueId},
+			"$unset": bson.M{"venueId": ""},
+		}
+		_, err = accounts.UpdateOne(sc, bson.M{"_id": account.ID}, update)
 
-	_, err := db.DB.Collection(db.CollectionNameStripeAccounts).UpdateOne(ctx, &bson.M{"stripe_account_id": accountNumber}, update)
+		return nil, err
+	})
 
 	return err
 }
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTableNotFound = errors.New("table not found")
+
+func (m *Mongo) GetTablesByVenueID(ctx context.Context, venueID primitive.ObjectID) ([]models.Table, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tables := []models.Table{}
+
+	filter := bson.M{"venue_id": venueID, "deleted_at": bson.M{"$exists": false}}
+	cursor, err := m.db.Collection(db.CollectionNameTables).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "zone", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return tables, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &tables)
+
+	return tables, err
+}
+
+// GetVenueTable returns the table if it belongs to the venue and isn't deleted
+func (m *Mongo) GetVenueTable(ctx context.Context, venueID primitive.ObjectID, tableID primitive.ObjectID) (models.Table, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": tableID, "venue_id": venueID, "deleted_at": bson.M{"$exists": false}}
+
+	var table models.Table
+	err := m.db.Collection(db.CollectionNameTables).FindOne(ctx, filter).Decode(&table)
+
+	return table, notFound(err, ErrTableNotFound)
+}
+
+func (m *Mongo) CreateTable(ctx context.Context, table models.Table) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db.Collection(db.CollectionNameTables).InsertOne(ctx, table)
+
+	return err
+}
+
+// UpdateTable renames the table or moves it to another zone
+func (m *Mongo) UpdateTable(ctx context.Context, table models.Table) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": table.ID, "venue_id": table.VenueID, "deleted_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"name": table.Name, "zone": table.Zone}}
+
+	result, err := m.db.Collection(db.CollectionNameTables).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTableNotFound
+	}
+
+	return nil
+}
+
+func (m *Mongo) SoftDeleteTable(ctx context.Context, venueID primitive.ObjectID, tableID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": tableID, "venue_id": venueID, "deleted_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())}}
+
+	result, err := m.db.Collection(db.CollectionNameTables).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTableNotFound
+	}
+
+	return nil
+}
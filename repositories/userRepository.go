@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/SaplingPay/server/db"
+	"github.com/SaplingPay/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetUserByUserID finds the user by the ID of their login, not the document ID
+func (m *Mongo) GetUserByUserID(ctx context.Context, userID string) (models.UserV2, error) {
+	return m.findUser(ctx, bson.M{"user_id": userID})
+}
+
+func (m *Mongo) GetUserByID(ctx context.Context, id primitive.ObjectID) (models.UserV2, error) {
+	return m.findUser(ctx, bson.M{"_id": id})
+}
+
+func (m *Mongo) findUser(ctx context.Context, filter bson.M) (models.UserV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var user models.UserV2
+	err := m.db.Collection(db.CollectionNameUserV2).FindOne(ctx, filter).Decode(&user)
+
+	return user, notFound(err, ErrUserNotFound)
+}
+
+func (m *Mongo) GetAllUsers(ctx context.Context) ([]models.UserV2, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	users := []models.UserV2{}
+
+	cursor, err := m.db.Collection(db.CollectionNameUserV2).Find(ctx, bson.M{})
+	if err != nil {
+		return users, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &users)
+
+	return users, err
+}
+
+func (m *Mongo) CreateUser(ctx context.Context, user models.UserV2) (models.UserV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+
+	_, err := m.db.Collection(db.CollectionNameUserV2).InsertOne(ctx, user)
+
+	return user, err
+}
+
+func (m *Mongo) UpdateUser(ctx context.Context, id primitive.ObjectID, fields Fields) (models.UserV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if len(fields) > 0 {
+		result, err := m.db.Collection(db.CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+		if err != nil {
+			return models.UserV2{}, err
+		}
+		if result.MatchedCount == 0 {
+			return models.UserV2{}, ErrUserNotFound
+		}
+	}
+
+	return m.GetUserByID(ctx, id)
+}
+
+func (m *Mongo) SoftDeleteUser(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())}}
+	_, err := m.db.Collection(db.CollectionNameUserV2).UpdateOne(ctx, bson.M{"_id": id}, update)
+
+	return err
+}
+
+// FollowUser makes the user follow another one and returns the followed user. The IDs are stored as hex strings,
+// which is what the apps have always written.
+func (m *Mongo) FollowUser(ctx context.Context, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error) {
+	return m.setFollowing(ctx, "$addToSet", id, followingID)
+}
+
+func (m *Mongo) UnfollowUser(ctx context.Context, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error) {
+	return m.setFollowing(ctx, "$pull", id, followingID)
+}
+
+func (m *Mongo) setFollowing(ctx context.Context, operator string, id primitive.ObjectID, followingID primitive.ObjectID) (models.UserV2, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	users := m.db.Collection(db.CollectionNameUserV2)
+
+	_, err := users.UpdateOne(ctx, bson.M{"_id": id}, bson.M{operator: bson.M{"following": followingID.Hex()}})
+	if err != nil {
+		return models.UserV2{}, err
+	}
+
+	_, err = users.UpdateOne(ctx, bson.M{"_id": followingID}, bson.M{operator: bson.M{"followers": id.Hex()}})
+	if err != nil {
+		return models.UserV2{}, err
+	}
+
+	return m.GetUserByID(ctx, followingID)
+}
@@ -1,20 +1,168 @@
 package repositories
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"regexp"
+	"time"
+
 	"github.com/SaplingPay/server/db"
 	"github.com/SaplingPay/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"time"
 )
 
-func GetVenueByID(venueID primitive.ObjectID) (models.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+var ErrVenueNotFound = errors.New("venue not found")
+
+// NearbyVenuesQuery is a page of venues around a point. Venues come nearest first, ties by ID, and After is where the
+// previous page left off.
+type NearbyVenuesQuery struct {
+	Point             models.GeoPoint
+	Radius            float64 // meters
+	City              string  // matched ignoring case, any city if empty
+	OrderingSupported bool    // only venues that take orders
+	After             *NearbyVenue
+	Limit             int
+}
+
+// NearbyVenue is a venue and how far it is from the query's point in meters
+type NearbyVenue struct {
+	models.Venue `bson:",inline"`
+	Distance     float64 `bson:"distance" json:"distance"`
+}
+
+// Follows tells if the venue comes after the other one, nearest first and ties by ID
+func (v NearbyVenue) Follows(other NearbyVenue) bool {
+	if v.Distance != other.Distance {
+		return v.Distance > other.Distance
+	}
+	return bytes.Compare(v.ID[:], other.ID[:]) > 0
+}
+
+func (m *Mongo) GetVenueByID(ctx context.Context, venueID primitive.ObjectID) (models.Venue, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var venue models.Venue
+	err := m.db.Collection(db.CollectionNameVenue).FindOne(ctx, bson.M{"_id": venueID}).Decode(&venue)
+
+	return venue, notFound(err, ErrVenueNotFound)
+}
+
+func (m *Mongo) GetAllVenues(ctx context.Context) ([]models.Venue, error) {
+	return m.findVenues(ctx, bson.M{"deleted_at": nil})
+}
+
+func (m *Mongo) GetVenuesByIDs(ctx context.Context, venueIDs []primitive.ObjectID) ([]models.Venue, error) {
+	return m.findVenues(ctx, bson.M{"_id": bson.M{"$in": venueIDs}, "deleted_at": nil})
+}
+
+func (m *Mongo) findVenues(ctx context.Context, filter bson.M) ([]models.Venue, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	venues := []models.Venue{}
+
+	cursor, err := m.db.Collection(db.CollectionNameVenue).Find(ctx, filter)
+	if err != nil {
+		return venues, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &venues)
+
+	return venues, err
+}
+
+func (m *Mongo) GetNearbyVenues(ctx context.Context, query NearbyVenuesQuery) ([]NearbyVenue, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	venues := []NearbyVenue{}
+
+	filter := bson.M{"deleted_at": nil}
+	if query.City != "" {
+		filter["location.city"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.City) + "$", Options: "i"}
+	}
+	if query.OrderingSupported {
+		filter["ordering_supported"] = true
+	}
+
+	geoNear := bson.M{
+		"near":          query.Point,
+		"key":           "location.point",
+		"distanceField": "distance",
+		"maxDistance":   query.Radius,
+		"spherical":     true,
+		"query":         filter,
+	}
+	pipeline := []bson.M{{"$geoNear": geoNear}}
+	if query.After != nil {
+		// minDistance skips the nearer venues in the index, the match skips the ones at the same distance already seen
+		geoNear["minDistance"] = query.After.Distance
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": []bson.M{
+			{"distance": bson.M{"$gt": query.After.Distance}},
+			{"distance": query.After.Distance, "_id": bson.M{"$gt": query.After.ID}},
+		}}})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$sort": bson.D{{Key: "distance", Value: 1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": query.Limit},
+	)
+
+	cursor, err := m.db.Collection(db.CollectionNameVenue).Aggregate(ctx, pipeline)
+	if err != nil {
+		return venues, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &venues)
+
+	return venues, err
+}
+
+func (m *Mongo) CreateVenue(ctx context.Context, venue models.Venue) (models.Venue, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if venue.ID.IsZero() {
+		venue.ID = primitive.NewObjectID()
+	}
+
+	_, err := m.db.Collection(db.CollectionNameVenue).InsertOne(ctx, venue)
+
+	return venue, err
+}
+
+func (m *Mongo) UpdateVenue(ctx context.Context, venueID primitive.ObjectID, fields Fields) (models.Venue, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	venues := m.db.Collection(db.CollectionNameVenue)
+
+	if len(fields) > 0 {
+		result, err := venues.UpdateOne(ctx, bson.M{"_id": venueID}, bson.M{"$set": fields})
+		if err != nil {
+			return models.Venue{}, err
+		}
+		if result.MatchedCount == 0 {
+			return models.Venue{}, ErrVenueNotFound
+		}
+	}
+
+	var venue models.Venue
+	err := venues.FindOne(ctx, bson.M{"_id": venueID}).Decode(&venue)
+
+	return venue, notFound(err, ErrVenueNotFound)
+}
+
+func (m *Mongo) SoftDeleteVenue(ctx context.Context, venueID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	var order models.Order
-	err := db.DB.Collection(db.CollectionNameVenue).FindOne(ctx, bson.M{"_id": venueID}).Decode(&order)
+	update := bson.M{"$set": bson.M{"deleted_at": primitive.NewDateTimeFromTime(time.Now())}}
+	_, err := m.db.Collection(db.CollectionNameVenue).UpdateOne(ctx, bson.M{"_id": venueID}, update)
 
-	return order, err
+	return err
 }
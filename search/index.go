@@ -0,0 +1,59 @@
+package search
+
+import "sort"
+
+// Index finds the documents a query can match without scoring every one of them. It keeps which documents each
+// word is in, so the terms of a query are only compared to the distinct words rather than to every document.
+type Index struct {
+	documents map[string][]int // the documents each word is in, in order
+}
+
+// NewIndex indexes the documents, each one is the fields it can be found by and is known by its position
+func NewIndex(documents [][]Field) *Index {
+	index := &Index{documents: map[string][]int{}}
+	for i, fields := range documents {
+		for _, field := range fields {
+			for _, word := range Words(field.Text) {
+				found := index.documents[word]
+				if len(found) == 0 || found[len(found)-1] != i {
+					index.documents[word] = append(found, i)
+				}
+			}
+		}
+	}
+	return index
+}
+
+// Candidates returns the documents that have a word matching each term of the query, in order. The query's Score
+// of any other document is 0.
+func (index *Index) Candidates(q Query) []int {
+	if q.Empty() {
+		return nil
+	}
+
+	var candidates map[int]bool
+	for _, term := range q.terms {
+		matching := map[int]bool{}
+		for word, documents := range index.documents {
+			if match(term, word) == 0 {
+				continue
+			}
+			for _, i := range documents {
+				if candidates == nil || candidates[i] {
+					matching[i] = true
+				}
+			}
+		}
+		if len(matching) == 0 {
+			return nil
+		}
+		candidates = matching
+	}
+
+	found := make([]int, 0, len(candidates))
+	for i := range candidates {
+		found = append(found, i)
+	}
+	sort.Ints(found)
+	return found
+}
@@ -0,0 +1,34 @@
+package search
+
+import "testing"
+
+func TestIndexCandidates(t *testing.T) {
+	index := NewIndex([][]Field{
+		{{Text: "Beyond Burger", Weight: 1}, {Text: "vegan", Weight: 0.5}},
+		{{Text: "Cheeseburger", Weight: 1}, {Text: "Burger Bar", Weight: 0.5, Context: true}},
+		{{Text: "Margherita", Weight: 1}, {Text: "Trattoria", Weight: 0.5, Context: true}},
+	})
+
+	for _, test := range []struct {
+		query string
+		want  []int
+	}{
+		{"burgr", []int{0, 1}},
+		{"vegan burger", []int{0}},
+		{"chese", []int{1}},
+		{"margeritha trattoria", []int{2}},
+		{"sushi", nil},
+		{"vegan sushi", nil},
+		{" ", nil},
+	} {
+		got := index.Candidates(NewQuery(test.query))
+		if len(got) != len(test.want) {
+			t.Fatalf("Candidates(%q) = %v, expected %v", test.query, got, test.want)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("Candidates(%q) = %v, expected %v", test.query, got, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package search matches free text against venues and menu items. MongoDB's text index only finds whole words
+// (after stemming), so guests typing "burgr" or "tiramisú" would find nothing. Matching happens here instead,
+// ignoring case and accents and allowing a typo or two in longer words, and an Index narrows down the documents
+// worth matching.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// How much a term counts for when it matches a word exactly, as the start of a word or with typos
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.8
+	fuzzyMatch  = 0.6
+)
+
+// Terms shorter than this are only matched exactly, there are too many words a letter away from them
+const minPrefixLength = 3
+
+// Field is text a document can be found by, matches in fields with a higher weight rank the document higher.
+// Context is text about where the document is, like an item's venue, it helps a document match but a document
+// with only context matching isn't found.
+type Field struct {
+	Text    string
+	Weight  float64
+	Context bool
+}
+
+// Query is the words searched for
+type Query struct {
+	terms []string
+}
+
+func NewQuery(text string) Query {
+	return Query{terms: Words(text)}
+}
+
+func (q Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// Score is how well the fields match the query, 0 unless every term matches one of them and one term matches
+// more than context. Each term counts for its best match, weighted by the field it's in.
+func (q Query) Score(fields ...Field) float64 {
+	if q.Empty() {
+		return 0
+	}
+
+	type word struct {
+		text string
+		Field
+	}
+	var words []word
+	for _, field := range fields {
+		for _, text := range Words(field.Text) {
+			words = append(words, word{text, field})
+		}
+	}
+
+	total := 0.0
+	found := false
+	for _, term := range q.terms {
+		best := 0.0
+		for _, w := range words {
+			m := match(term, w.text)
+			if m > 0 && !w.Context {
+				found = true
+			}
+			if score := m * w.Weight; score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	if !found {
+		return 0
+	}
+	return total / float64(len(q.terms))
+}
+
+// Words splits text into lower case words without accents
+func Words(text string) []string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.FieldsFunc(b.String(), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// Fold is text as Words sees it, for comparing tags and names
+func Fold(text string) string {
+	return strings.Join(Words(text), " ")
+}
+
+func match(term, word string) float64 {
+	switch {
+	case term == word:
+		return exactMatch
+	case len([]rune(term)) >= minPrefixLength && strings.HasPrefix(word, term):
+		return prefixMatch
+	}
+
+	edits := allowedEdits(term)
+	if edits == 0 {
+		return 0
+	}
+	if distance(term, word, edits) <= edits {
+		return fuzzyMatch
+	}
+
+	// Typing a word halfway with a typo in it still finds the word, if the term is long enough to be a prefix
+	runes, n := []rune(word), len([]rune(term))
+	for length := n - edits; length <= n+edits && length < len(runes); length++ {
+		if length >= minPrefixLength && distance(term, string(runes[:length]), edits) <= edits {
+			return fuzzyMatch * prefixMatch
+		}
+	}
+	return 0
+}
+
+// allowedEdits is how many typos a term can have, none in short words
+func allowedEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// distance is the number of letters inserted, deleted, changed or swapped with the next one to turn a into b.
+// It stops counting past limit and returns limit+1 then.
+func distance(a, b string, limit int) int {
+	s, t := []rune(a), []rune(b)
+	if abs(len(s)-len(t)) > limit {
+		return limit + 1
+	}
+
+	// Three rows of the table, the one before the previous one is needed for swaps
+	before := make([]int, len(t)+1)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		lowest := current[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				current[j] = min(current[j], before[j-2]+1)
+			}
+			if current[j] < lowest {
+				lowest = current[j]
+			}
+		}
+		if lowest > limit {
+			return limit + 1
+		}
+		before, previous, current = previous, current, before
+	}
+	return previous[len(t)]
+}
+
+func min(values ...int) int {
+	lowest := values[0]
+	for _, v := range values[1:] {
+		if v < lowest {
+			lowest = v
+		}
+	}
+	return lowest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
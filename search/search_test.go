@@ -0,0 +1,70 @@
+package search
+
+import "testing"
+
+func TestWords(t *testing.T) {
+	got := Words("Crème Brûlée & CAFÉ-au-lait, 2x")
+	want := []string{"creme", "brulee", "cafe", "au", "lait", "2x"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		term, word string
+		score      float64
+	}{
+		{"burger", "burger", exactMatch},
+		{"burg", "burger", prefixMatch},
+		{"burgr", "burger", fuzzyMatch},
+		{"buregr", "burger", fuzzyMatch},         // swapped letters
+		{"margherta", "margherita", fuzzyMatch},  // missing letter
+		{"margeritha", "margherita", fuzzyMatch}, // two of them
+		{"chese", "cheeseburger", fuzzyMatch * prefixMatch},
+		{"tea", "pea", 0}, // short words have to be exact
+		{"be", "beer", 0}, // or long enough to be a prefix
+		{"salad", "pasta", 0},
+		{"burgers", "bur", 0},
+	} {
+		if score := match(test.term, test.word); score != test.score {
+			t.Errorf("match(%q, %q) = %v, expected %v", test.term, test.word, score, test.score)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	query := NewQuery("vegan burgr")
+
+	name := Field{Text: "Vegan Burger", Weight: 1}
+	if score := query.Score(name); score != (exactMatch+fuzzyMatch)/2 {
+		t.Fatalf("unexpected score %v", score)
+	}
+
+	// Every term has to match, but they can match different fields
+	if score := query.Score(Field{Text: "Beef Burger", Weight: 1}); score != 0 {
+		t.Fatalf("expected no match without vegan, got %v", score)
+	}
+	tagged := query.Score(Field{Text: "Burger", Weight: 1}, Field{Text: "vegan", Weight: 0.5})
+	if tagged == 0 || tagged >= query.Score(name) {
+		t.Fatalf("expected a tagged burger to rank below a vegan one by name, got %v", tagged)
+	}
+
+	// Context alone doesn't make a match
+	venue := Field{Text: "Vegan Burger Bar", Weight: 0.5, Context: true}
+	if score := query.Score(Field{Text: "Fries", Weight: 1}, venue); score != 0 {
+		t.Fatalf("expected no match on the venue alone, got %v", score)
+	}
+	if score := query.Score(Field{Text: "Burger", Weight: 1}, venue); score == 0 {
+		t.Fatal("expected the venue to help a burger match")
+	}
+
+	if score := NewQuery(" ,. ").Score(name); score != 0 {
+		t.Fatalf("expected an empty query to match nothing, got %v", score)
+	}
+}
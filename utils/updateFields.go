@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+)
+
+// UpdateFields turns a partially filled struct into a map of bson field names to values, for a partial update.
+// Zero fields are left out, except bools which are always set. The document ID never is.
+func UpdateFields(v interface{}) map[string]interface{} {
+	update := map[string]interface{}{}
+
+	valueType := reflect.TypeOf(v)
+	value := reflect.ValueOf(v)
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		fieldValue := value.Field(i).Interface()
+
+		if field.Type.Kind() == reflect.Bool || !reflect.DeepEqual(fieldValue, reflect.Zero(field.Type).Interface()) {
+			name, _, _ := strings.Cut(field.Tag.Get("bson"), ",")
+			// Skip if bson tag is not set or is "-"
+			if name == "" || name == "-" || name == "_id" {
+				continue
+			}
+
+			update[name] = fieldValue
+		}
+	}
+
+	return update
+}